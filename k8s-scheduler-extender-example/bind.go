@@ -1,7 +1,13 @@
 package main
 
 import (
+	"fmt"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
 	schedulerapi "k8s.io/kubernetes/pkg/scheduler/apis/extender/v1"
 )
 
@@ -10,8 +16,38 @@ type Bind struct {
 }
 
 func (b Bind) Handler(args schedulerapi.ExtenderBindingArgs) *schedulerapi.ExtenderBindingResult {
-	err := b.Func(args.PodName, args.PodNamespace, args.PodUID, args.Node)
-	return &schedulerapi.ExtenderBindingResult{
-		Error: err.Error(),
+	result := &schedulerapi.ExtenderBindingResult{}
+	if err := b.Func(args.PodName, args.PodNamespace, args.PodUID, args.Node); err != nil {
+		result.Error = err.Error()
+		bindings.WithLabelValues("failure").Inc()
+	} else {
+		bindings.WithLabelValues("success").Inc()
+	}
+	return result
+}
+
+// NewClientBind returns a Bind that binds pods by creating a v1.Binding
+// through client. Conflicting writes are retried, and the binding is refused
+// when the pod was replaced by one with a different UID in the meantime.
+func NewClientBind(client kubernetes.Interface) Bind {
+	return Bind{
+		Func: func(podName string, podNamespace string, podUID types.UID, node string) error {
+			return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+				pod, err := client.CoreV1().Pods(podNamespace).Get(podName, metav1.GetOptions{})
+				if err != nil {
+					return err
+				}
+				if pod.UID != podUID {
+					return fmt.Errorf("pod %s/%s has UID %s, expected %s", podNamespace, podName, pod.UID, podUID)
+				}
+				if pod.Spec.NodeName != "" {
+					return fmt.Errorf("pod %s/%s is already bound to %s", podNamespace, podName, pod.Spec.NodeName)
+				}
+				return client.CoreV1().Pods(podNamespace).Bind(&v1.Binding{
+					ObjectMeta: metav1.ObjectMeta{Namespace: podNamespace, Name: podName, UID: podUID},
+					Target:     v1.ObjectReference{Kind: "Node", Name: node},
+				})
+			})
+		},
 	}
 }
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	schedulerapi "k8s.io/kubernetes/pkg/scheduler/apis/extender/v1"
+)
+
+func TestBindHandler(t *testing.T) {
+	ok := Bind{Func: func(string, string, types.UID, string) error { return nil }}
+	if result := ok.Handler(schedulerapi.ExtenderBindingArgs{}); result.Error != "" {
+		t.Errorf("Error = %q, want empty", result.Error)
+	}
+
+	failing := Bind{Func: func(string, string, types.UID, string) error { return fmt.Errorf("boom") }}
+	if result := failing.Handler(schedulerapi.ExtenderBindingArgs{}); result.Error != "boom" {
+		t.Errorf("Error = %q, want boom", result.Error)
+	}
+}
+
+func TestClientBind(t *testing.T) {
+	tests := []struct {
+		name      string
+		uid       types.UID
+		nodeName  string
+		conflicts int
+		wantErr   bool
+		wantBinds int
+	}{
+		{name: "binds", uid: "uid-1", wantBinds: 1},
+		{name: "retries conflicts", uid: "uid-1", conflicts: 2, wantBinds: 3},
+		{name: "uid mismatch", uid: "uid-2", wantErr: true},
+		{name: "already bound", uid: "uid-1", nodeName: "other", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := makePod("p", "", "")
+			pod.UID = "uid-1"
+			pod.Spec.NodeName = tt.nodeName
+			client := fake.NewSimpleClientset(&pod)
+
+			var bindings []*v1.Binding
+			client.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				if action.GetSubresource() != "binding" {
+					return false, nil, nil
+				}
+				binding := action.(k8stesting.CreateAction).GetObject().(*v1.Binding)
+				bindings = append(bindings, binding)
+				if len(bindings) <= tt.conflicts {
+					return true, nil, apierrors.NewConflict(schema.GroupResource{Resource: "pods"}, binding.Name, fmt.Errorf("conflict"))
+				}
+				return true, binding, nil
+			})
+
+			err := NewClientBind(client).Func("p", "default", tt.uid, "node-1")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(bindings) != tt.wantBinds {
+				t.Fatalf("%d bindings created, want %d", len(bindings), tt.wantBinds)
+			}
+			if tt.wantBinds > 0 {
+				b := bindings[len(bindings)-1]
+				if b.Target.Name != "node-1" || b.UID != tt.uid || b.Namespace != "default" {
+					t.Errorf("unexpected binding %+v", b)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	ResourceFitName   = "resource_fit"
+	LabelAffinityName = "label_affinity"
+	MaxPodsName       = "max_pods"
+
+	// DefaultNodeSelectorAnnotation holds a label selector, in kubectl syntax,
+	// that candidate nodes must match.
+	DefaultNodeSelectorAnnotation = "extender.example.com/node-selector"
+	// DefaultAvoidTaintsAnnotation holds a comma separated list of taint keys;
+	// nodes carrying any of them are filtered out.
+	DefaultAvoidTaintsAnnotation = "extender.example.com/avoid-taints"
+
+	ReasonInsufficientResources = "InsufficientResources"
+	ReasonInvalidNodeSelector   = "InvalidNodeSelector"
+	ReasonNodeSelectorMismatch  = "NodeSelectorMismatch"
+	ReasonAvoidedTaint          = "AvoidedTaint"
+	ReasonTooManyPods           = "TooManyPods"
+)
+
+type ResourceFitArgs struct {
+	// Resources are the resource names compared against the node's
+	// allocatable. Defaults to cpu and memory.
+	Resources []v1.ResourceName `json:"resources,omitempty"`
+}
+
+// NewResourceFitPredicate filters out nodes whose allocatable capacity is
+// smaller than the pod's effective request.
+func NewResourceFitPredicate(rawArgs json.RawMessage, _ kubernetes.Interface) (Predicate, error) {
+	args := ResourceFitArgs{
+		Resources: []v1.ResourceName{v1.ResourceCPU, v1.ResourceMemory},
+	}
+	if err := decodeArgs(rawArgs, &args); err != nil {
+		return Predicate{}, err
+	}
+	if len(args.Resources) == 0 {
+		return Predicate{}, fmt.Errorf("resources must not be empty")
+	}
+
+	return Predicate{
+		Name: ResourceFitName,
+		Func: func(pod *v1.Pod, node *v1.Node) (bool, error) {
+			requests := podRequests(pod)
+			var insufficient []string
+			for _, name := range args.Resources {
+				request, ok := requests[name]
+				if !ok || request.IsZero() {
+					continue
+				}
+				allocatable := node.Status.Allocatable[name]
+				if request.Cmp(allocatable) > 0 {
+					insufficient = append(insufficient, string(name))
+				}
+			}
+			if len(insufficient) > 0 {
+				return false, NewPredicateFailure(ReasonInsufficientResources, "Insufficient %s", strings.Join(insufficient, ", "))
+			}
+			return true, nil
+		},
+	}, nil
+}
+
+// podRequests returns the effective resource request of a pod: the sum of its
+// containers, raised to the largest init container and increased by the pod
+// overhead.
+func podRequests(pod *v1.Pod) v1.ResourceList {
+	requests := v1.ResourceList{}
+	for _, c := range pod.Spec.Containers {
+		for name, q := range c.Resources.Requests {
+			total := requests[name]
+			total.Add(q)
+			requests[name] = total
+		}
+	}
+	for _, c := range pod.Spec.InitContainers {
+		for name, q := range c.Resources.Requests {
+			if current, ok := requests[name]; !ok || q.Cmp(current) > 0 {
+				requests[name] = q.DeepCopy()
+			}
+		}
+	}
+	for name, q := range pod.Spec.Overhead {
+		total := requests[name]
+		total.Add(q)
+		requests[name] = total
+	}
+	return requests
+}
+
+type LabelAffinityArgs struct {
+	// NodeSelectorAnnotation is the pod annotation read for the node label
+	// selector.
+	NodeSelectorAnnotation string `json:"nodeSelectorAnnotation,omitempty"`
+	// AvoidTaintsAnnotation is the pod annotation read for the taint keys the
+	// pod refuses to land on.
+	AvoidTaintsAnnotation string `json:"avoidTaintsAnnotation,omitempty"`
+}
+
+// NewLabelAffinityPredicate matches node labels and taints against rules the
+// pod declares through annotations. Pods without the annotations pass.
+func NewLabelAffinityPredicate(rawArgs json.RawMessage, _ kubernetes.Interface) (Predicate, error) {
+	args := LabelAffinityArgs{
+		NodeSelectorAnnotation: DefaultNodeSelectorAnnotation,
+		AvoidTaintsAnnotation:  DefaultAvoidTaintsAnnotation,
+	}
+	if err := decodeArgs(rawArgs, &args); err != nil {
+		return Predicate{}, err
+	}
+
+	return Predicate{
+		Name: LabelAffinityName,
+		Func: func(pod *v1.Pod, node *v1.Node) (bool, error) {
+			if expr, ok := pod.Annotations[args.NodeSelectorAnnotation]; ok && expr != "" {
+				selector, err := labels.Parse(expr)
+				if err != nil {
+					return false, NewPredicateFailure(ReasonInvalidNodeSelector, "invalid %s annotation: %v", args.NodeSelectorAnnotation, err)
+				}
+				if !selector.Matches(labels.Set(node.Labels)) {
+					return false, NewPredicateFailure(ReasonNodeSelectorMismatch, "node labels do not match %q", expr)
+				}
+			}
+			if keys, ok := pod.Annotations[args.AvoidTaintsAnnotation]; ok && keys != "" {
+				for _, key := range strings.Split(keys, ",") {
+					key = strings.TrimSpace(key)
+					for _, taint := range node.Spec.Taints {
+						if taint.Key == key {
+							return false, NewPredicateFailure(ReasonAvoidedTaint, "node has avoided taint %s", taint.ToString())
+						}
+					}
+				}
+			}
+			return true, nil
+		},
+	}, nil
+}
+
+type MaxPodsArgs struct {
+	// MaxPods caps the number of non-terminated pods per node. The node's
+	// allocatable pods is used when it is lower or when MaxPods is zero.
+	MaxPods int64 `json:"maxPods,omitempty"`
+}
+
+// NewMaxPodsPredicate filters out nodes that already run the maximum number of
+// pods. Counting pods needs a Kubernetes client, pods are read from the shared
+// pod cache once it has been started with StartPodCache.
+func NewMaxPodsPredicate(rawArgs json.RawMessage, client kubernetes.Interface) (Predicate, error) {
+	var args MaxPodsArgs
+	if err := decodeArgs(rawArgs, &args); err != nil {
+		return Predicate{}, err
+	}
+	if args.MaxPods < 0 {
+		return Predicate{}, fmt.Errorf("maxPods must not be negative")
+	}
+	if client == nil {
+		return Predicate{}, fmt.Errorf("a Kubernetes client is required")
+	}
+	pods, err := sharedPodCache(client)
+	if err != nil {
+		return Predicate{}, err
+	}
+
+	return Predicate{
+		Name: MaxPodsName,
+		Func: func(pod *v1.Pod, node *v1.Node) (bool, error) {
+			limit := args.MaxPods
+			if allocatable, ok := node.Status.Allocatable[v1.ResourcePods]; ok {
+				if limit == 0 || allocatable.Value() < limit {
+					limit = allocatable.Value()
+				}
+			}
+			if limit == 0 {
+				return true, nil
+			}
+			podsOnNode, err := pods.podsOnNode(node.Name)
+			if err != nil {
+				return false, err
+			}
+			count := int64(len(podsOnNode))
+			if count >= limit {
+				return false, NewPredicateFailure(ReasonTooManyPods, "Too many pods (%d/%d)", count, limit)
+			}
+			return true, nil
+		},
+		Ready: pods.ready,
+	}, nil
+}
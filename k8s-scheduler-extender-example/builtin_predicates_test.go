@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func makeNode(name string, cpu, memory string) v1.Node {
+	return v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: v1.NodeStatus{
+			Allocatable: v1.ResourceList{
+				v1.ResourceCPU:    resource.MustParse(cpu),
+				v1.ResourceMemory: resource.MustParse(memory),
+				v1.ResourcePods:   resource.MustParse("110"),
+			},
+		},
+	}
+}
+
+func makePod(name string, cpu, memory string) v1.Pod {
+	requests := v1.ResourceList{}
+	if cpu != "" {
+		requests[v1.ResourceCPU] = resource.MustParse(cpu)
+	}
+	if memory != "" {
+		requests[v1.ResourceMemory] = resource.MustParse(memory)
+	}
+	return v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{{
+				Name:      "c",
+				Resources: v1.ResourceRequirements{Requests: requests},
+			}},
+		},
+	}
+}
+
+func TestResourceFitPredicate(t *testing.T) {
+	withInit := makePod("p", "500m", "")
+	withInit.Spec.InitContainers = []v1.Container{{
+		Name: "init",
+		Resources: v1.ResourceRequirements{Requests: v1.ResourceList{
+			v1.ResourceCPU: resource.MustParse("3"),
+		}},
+	}}
+
+	tests := []struct {
+		name string
+		args string
+		pod  v1.Pod
+		node v1.Node
+		fit  bool
+	}{
+		{"fits", "", makePod("p", "1", "1Gi"), makeNode("n", "2", "4Gi"), true},
+		{"exact fit", "", makePod("p", "2", "4Gi"), makeNode("n", "2", "4Gi"), true},
+		{"insufficient cpu", "", makePod("p", "3", "1Gi"), makeNode("n", "2", "4Gi"), false},
+		{"insufficient memory", "", makePod("p", "1", "8Gi"), makeNode("n", "2", "4Gi"), false},
+		{"no requests", "", makePod("p", "", ""), makeNode("n", "2", "4Gi"), true},
+		{"init container dominates", "", withInit, makeNode("n", "2", "4Gi"), false},
+		{"memory only", `{"resources":["memory"]}`, makePod("p", "3", "1Gi"), makeNode("n", "2", "4Gi"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewResourceFitPredicate(json.RawMessage(tt.args), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fit, err := p.Func(&tt.pod, &tt.node)
+			if fit != tt.fit {
+				t.Errorf("fit = %v (%v), want %v", fit, err, tt.fit)
+			}
+			if !fit && err == nil {
+				t.Error("expected a failure reason")
+			}
+		})
+	}
+}
+
+func TestLabelAffinityPredicate(t *testing.T) {
+	node := makeNode("n", "2", "4Gi")
+	node.Labels = map[string]string{"disktype": "ssd", "zone": "a"}
+	node.Spec.Taints = []v1.Taint{{Key: "dedicated", Value: "gpu", Effect: v1.TaintEffectNoSchedule}}
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		fit         bool
+	}{
+		{"no annotations", nil, true},
+		{"selector matches", map[string]string{DefaultNodeSelectorAnnotation: "disktype=ssd,zone in (a,b)"}, true},
+		{"selector mismatch", map[string]string{DefaultNodeSelectorAnnotation: "disktype=hdd"}, false},
+		{"selector negation", map[string]string{DefaultNodeSelectorAnnotation: "!gpu"}, true},
+		{"invalid selector", map[string]string{DefaultNodeSelectorAnnotation: "a=b=c"}, false},
+		{"avoided taint", map[string]string{DefaultAvoidTaintsAnnotation: "spot, dedicated"}, false},
+		{"unrelated taint", map[string]string{DefaultAvoidTaintsAnnotation: "spot"}, true},
+	}
+	p, err := NewLabelAffinityPredicate(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := makePod("p", "", "")
+			pod.Annotations = tt.annotations
+			if fit, err := p.Func(&pod, &node); fit != tt.fit {
+				t.Errorf("fit = %v (%v), want %v", fit, err, tt.fit)
+			}
+		})
+	}
+}
+
+func TestMaxPodsPredicate(t *testing.T) {
+	running := makePod("running", "", "")
+	running.Spec.NodeName = "n"
+	other := makePod("other", "", "")
+	other.Spec.NodeName = "n"
+	done := makePod("done", "", "")
+	done.Spec.NodeName = "n"
+	done.Status.Phase = v1.PodSucceeded
+	client := fake.NewSimpleClientset(&running, &other, &done)
+	if _, err := NewMaxPodsPredicate(nil, client); err != nil {
+		t.Fatal(err)
+	}
+	startPodCache(t, client)
+
+	tests := []struct {
+		name string
+		args string
+		fit  bool
+	}{
+		{"below limit", `{"maxPods": 3}`, true},
+		{"at limit", `{"maxPods": 2}`, false},
+		{"allocatable only", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewMaxPodsPredicate(json.RawMessage(tt.args), client)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pod, node := makePod("p", "", ""), makeNode("n", "2", "4Gi")
+			if fit, err := p.Func(&pod, &node); fit != tt.fit {
+				t.Errorf("fit = %v (%v), want %v", fit, err, tt.fit)
+			}
+		})
+	}
+
+	// Pods are read from the shared cache, listed once when it starts
+	lists := 0
+	for _, action := range client.Actions() {
+		if action.Matches("list", "pods") {
+			lists++
+		}
+	}
+	if lists != 1 {
+		t.Errorf("pods were listed %d times, want once", lists)
+	}
+
+	if _, err := NewMaxPodsPredicate(nil, nil); err == nil {
+		t.Error("expected an error without a client")
+	}
+}
+
+func TestBuildPredicates(t *testing.T) {
+	config, err := ParseConfig([]byte(`
+predicates:
+- name: resource_fit
+  args:
+    resources: [cpu]
+- name: label_affinity
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	predicates, err := BuildPredicates(config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(predicates) != 2 || predicates[0].Name != ResourceFitName || predicates[1].Name != LabelAffinityName {
+		t.Errorf("unexpected predicates %v", predicates)
+	}
+
+	for _, doc := range []string{
+		`predicates: [{name: unknown}]`,
+		`predicates: [{name: resource_fit, args: {bogus: true}}]`,
+		`predicates: [{args: {}}]`,
+		`predicates: {name: resource_fit}`,
+	} {
+		config, err := ParseConfig([]byte(doc))
+		if err == nil {
+			_, err = BuildPredicates(config, nil)
+		}
+		if err == nil {
+			t.Errorf("expected an error for %q", doc)
+		}
+	}
+}
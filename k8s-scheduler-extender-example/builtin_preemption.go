@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"k8s.io/api/core/v1"
+	policy "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	policylisters "k8s.io/client-go/listers/policy/v1beta1"
+	"k8s.io/client-go/tools/cache"
+	schedulerapi "k8s.io/kubernetes/pkg/scheduler/apis/extender/v1"
+)
+
+const (
+	EchoPreemptionName       = "echo"
+	VictimSelectionName      = "victim_selection"
+	DefaultNoEvictAnnotation = "extender.example.com/no-evict"
+)
+
+type VictimSelectionArgs struct {
+	// NoEvictAnnotation protects pods annotated with it set to "true": nodes
+	// where such a pod would be a victim are vetoed.
+	NoEvictAnnotation string `json:"noEvictAnnotation,omitempty"`
+	// RespectPDBs vetoes nodes where evicting the victims would exceed the
+	// disruptions allowed by a PodDisruptionBudget.
+	RespectPDBs bool `json:"respectPDBs,omitempty"`
+	// PreferFewestVictims keeps only the nodes whose victims have the lowest
+	// sum of priorities.
+	PreferFewestVictims bool `json:"preferFewestVictims,omitempty"`
+}
+
+// PodByUID looks up a pod by UID. It backs the nodeCacheCapable mode, where
+// the scheduler only sends the UIDs of the victims.
+type PodByUID func(uid string) (*v1.Pod, bool)
+
+// NewVictimSelectionPreemption builds the victim selection policy from its
+// args. Victims are looked up in the shared pod cache, next to which a
+// PodDisruptionBudget informer is registered when args.RespectPDBs is set.
+// Both are started by StartPodCache, requests fail until they have synced.
+func NewVictimSelectionPreemption(rawArgs json.RawMessage, client kubernetes.Interface) (Preemption, error) {
+	args := VictimSelectionArgs{
+		NoEvictAnnotation: DefaultNoEvictAnnotation,
+	}
+	if err := decodeArgs(rawArgs, &args); err != nil {
+		return Preemption{}, err
+	}
+	if client == nil {
+		if args.RespectPDBs {
+			return Preemption{}, fmt.Errorf("respectPDBs requires a Kubernetes client")
+		}
+		return NewVictimSelection(args, nil, nil), nil
+	}
+
+	pods, err := sharedPodCache(client)
+	if err != nil {
+		return Preemption{}, err
+	}
+	var pdbLister policylisters.PodDisruptionBudgetLister
+	ready := pods.ready
+	if args.RespectPDBs {
+		var pdbsSynced cache.InformerSynced
+		pdbLister, pdbsSynced = pods.pdbs()
+		ready = func() error {
+			if err := pods.ready(); err != nil {
+				return err
+			}
+			if !pdbsSynced() {
+				return fmt.Errorf("the PodDisruptionBudget cache has not synced yet")
+			}
+			return nil
+		}
+	}
+	p := NewVictimSelection(args, pods.podByUID, pdbLister)
+	p.Ready = ready
+	return p, nil
+}
+
+// NewVictimSelection returns a preemption policy that trims terminating and
+// deleted pods from the victims, vetoes nodes where protected pods would be
+// evicted or PodDisruptionBudgets would be violated, and optionally keeps only
+// the nodes with the cheapest victims. podByUID is required to resolve
+// MetaVictims, pdbLister is required when args.RespectPDBs is set.
+func NewVictimSelection(args VictimSelectionArgs, podByUID PodByUID, pdbLister policylisters.PodDisruptionBudgetLister) Preemption {
+	return Preemption{
+		Func: func(
+			_ v1.Pod,
+			nodeNameToVictims map[string]*schedulerapi.Victims,
+			nodeNameToMetaVictims map[string]*schedulerapi.MetaVictims,
+		) map[string]*schedulerapi.MetaVictims {
+			result := make(map[string]*schedulerapi.MetaVictims, len(nodeNameToMetaVictims))
+			prioritySums := make(map[string]int64, len(nodeNameToMetaVictims))
+
+			for nodeName, metaVictims := range nodeNameToMetaVictims {
+				var known []*v1.Pod
+				if victims, ok := nodeNameToVictims[nodeName]; ok {
+					known = victims.Pods
+				}
+				pods, err := resolveVictims(metaVictims, known, podByUID)
+				if err != nil {
+					log.Printf("warning: preemption: vetoing node %s: %v", nodeName, err)
+					continue
+				}
+				if reason := vetoReason(args, pods, pdbLister); reason != "" {
+					log.Printf("info: preemption: vetoing node %s: %s", nodeName, reason)
+					continue
+				}
+
+				trimmed := &schedulerapi.MetaVictims{
+					Pods:             make([]*schedulerapi.MetaPod, 0, len(pods)),
+					NumPDBViolations: metaVictims.NumPDBViolations,
+				}
+				var prioritySum int64
+				for _, pod := range pods {
+					trimmed.Pods = append(trimmed.Pods, &schedulerapi.MetaPod{UID: string(pod.UID)})
+					if pod.Spec.Priority != nil {
+						prioritySum += int64(*pod.Spec.Priority)
+					}
+				}
+				result[nodeName] = trimmed
+				prioritySums[nodeName] = prioritySum
+			}
+
+			if args.PreferFewestVictims && len(result) > 1 {
+				var min int64
+				first := true
+				for _, sum := range prioritySums {
+					if first || sum < min {
+						min, first = sum, false
+					}
+				}
+				for nodeName, sum := range prioritySums {
+					if sum > min {
+						delete(result, nodeName)
+					}
+				}
+			}
+			return result
+		},
+	}
+}
+
+// resolveVictims returns the pods behind metaVictims, dropping pods that are
+// already gone or terminating since they need not be preempted. Pods are
+// taken from known when the scheduler sent them, from podByUID otherwise.
+func resolveVictims(metaVictims *schedulerapi.MetaVictims, known []*v1.Pod, podByUID PodByUID) ([]*v1.Pod, error) {
+	byUID := make(map[string]*v1.Pod, len(known))
+	for _, pod := range known {
+		byUID[string(pod.UID)] = pod
+	}
+
+	pods := make([]*v1.Pod, 0, len(metaVictims.Pods))
+	for _, metaPod := range metaVictims.Pods {
+		pod, ok := byUID[metaPod.UID]
+		if !ok {
+			if podByUID == nil {
+				return nil, fmt.Errorf("cannot resolve victim %s without a pod cache", metaPod.UID)
+			}
+			if pod, ok = podByUID(metaPod.UID); !ok {
+				continue
+			}
+		}
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		pods = append(pods, pod)
+	}
+	return pods, nil
+}
+
+// vetoReason explains why the victims must not be evicted, or returns an
+// empty string when they may.
+func vetoReason(args VictimSelectionArgs, pods []*v1.Pod, pdbLister policylisters.PodDisruptionBudgetLister) string {
+	for _, pod := range pods {
+		if pod.Annotations[args.NoEvictAnnotation] == "true" {
+			return fmt.Sprintf("pod %s/%s is protected by %s", pod.Namespace, pod.Name, args.NoEvictAnnotation)
+		}
+	}
+	if !args.RespectPDBs || pdbLister == nil {
+		return ""
+	}
+
+	evictions := make(map[*policy.PodDisruptionBudget]int32)
+	for _, pod := range pods {
+		pdbs, err := pdbLister.PodDisruptionBudgets(pod.Namespace).List(labels.Everything())
+		if err != nil {
+			return err.Error()
+		}
+		for _, pdb := range pdbs {
+			selector, err := metav1.LabelSelectorAsSelector(pdb.Spec.Selector)
+			if err != nil || selector.Empty() || !selector.Matches(labels.Set(pod.Labels)) {
+				continue
+			}
+			evictions[pdb]++
+			if evictions[pdb] > pdb.Status.PodDisruptionsAllowed {
+				return fmt.Sprintf("evicting pod %s/%s would violate PodDisruptionBudget %s", pod.Namespace, pod.Name, pdb.Name)
+			}
+		}
+	}
+	return ""
+}
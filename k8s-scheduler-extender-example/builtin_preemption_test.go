@@ -0,0 +1,194 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"k8s.io/api/core/v1"
+	policy "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	policylisters "k8s.io/client-go/listers/policy/v1beta1"
+	"k8s.io/client-go/tools/cache"
+	schedulerapi "k8s.io/kubernetes/pkg/scheduler/apis/extender/v1"
+)
+
+func victim(name string, priority int32, modify func(*v1.Pod)) *v1.Pod {
+	pod := makePod(name, "", "")
+	pod.UID = types.UID(name + "-uid")
+	pod.Spec.Priority = &priority
+	if modify != nil {
+		modify(&pod)
+	}
+	return &pod
+}
+
+func protected(pod *v1.Pod) {
+	pod.Annotations = map[string]string{DefaultNoEvictAnnotation: "true"}
+}
+
+func terminating(pod *v1.Pod) {
+	now := metav1.Now()
+	pod.DeletionTimestamp = &now
+}
+
+func labelled(pod *v1.Pod) {
+	pod.Labels = map[string]string{"app": "db"}
+}
+
+func pdbLister(t *testing.T, pdbs ...*policy.PodDisruptionBudget) policylisters.PodDisruptionBudgetLister {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, pdb := range pdbs {
+		if err := indexer.Add(pdb); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return policylisters.NewPodDisruptionBudgetLister(indexer)
+}
+
+// victimUIDs flattens a preemption result into node name -> sorted victim UIDs.
+func victimUIDs(result *schedulerapi.ExtenderPreemptionResult) map[string][]string {
+	out := make(map[string][]string, len(result.NodeNameToMetaVictims))
+	for nodeName, victims := range result.NodeNameToMetaVictims {
+		uids := []string{}
+		for _, p := range victims.Pods {
+			uids = append(uids, p.UID)
+		}
+		sort.Strings(uids)
+		out[nodeName] = uids
+	}
+	return out
+}
+
+func TestVictimSelection(t *testing.T) {
+	dbBudget := &policy.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "default"},
+		Spec: policy.PodDisruptionBudgetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "db"}},
+		},
+		Status: policy.PodDisruptionBudgetStatus{PodDisruptionsAllowed: 1},
+	}
+
+	tests := []struct {
+		name    string
+		args    VictimSelectionArgs
+		victims map[string][]*v1.Pod
+		want    map[string][]string
+	}{
+		{
+			name: "passes unprotected victims through",
+			victims: map[string][]*v1.Pod{
+				"a": {victim("a1", 10, nil), victim("a2", 10, nil)},
+				"b": {},
+			},
+			want: map[string][]string{"a": {"a1-uid", "a2-uid"}, "b": {}},
+		},
+		{
+			name: "vetoes nodes with protected victims",
+			victims: map[string][]*v1.Pod{
+				"a": {victim("a1", 10, protected)},
+				"b": {victim("b1", 10, nil)},
+			},
+			want: map[string][]string{"b": {"b1-uid"}},
+		},
+		{
+			name: "trims terminating victims",
+			victims: map[string][]*v1.Pod{
+				"a": {victim("a1", 10, terminating), victim("a2", 10, nil)},
+			},
+			want: map[string][]string{"a": {"a2-uid"}},
+		},
+		{
+			name: "terminating protected pods do not veto",
+			victims: map[string][]*v1.Pod{
+				"a": {victim("a1", 10, func(p *v1.Pod) { protected(p); terminating(p) })},
+			},
+			want: map[string][]string{"a": {}},
+		},
+		{
+			name: "respects pod disruption budgets",
+			args: VictimSelectionArgs{RespectPDBs: true},
+			victims: map[string][]*v1.Pod{
+				"a": {victim("a1", 10, labelled), victim("a2", 10, labelled)},
+				"b": {victim("b1", 10, labelled), victim("b2", 10, nil)},
+			},
+			want: map[string][]string{"b": {"b1-uid", "b2-uid"}},
+		},
+		{
+			name: "prefers the lowest priority sum",
+			args: VictimSelectionArgs{PreferFewestVictims: true},
+			victims: map[string][]*v1.Pod{
+				"a": {victim("a1", 100, nil)},
+				"b": {victim("b1", 10, nil), victim("b2", 20, nil)},
+				"c": {victim("c1", 30, nil)},
+			},
+			want: map[string][]string{"b": {"b1-uid", "b2-uid"}, "c": {"c1-uid"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.args.NoEvictAnnotation = DefaultNoEvictAnnotation
+			preemptor := makePod("preemptor", "", "")
+
+			nodeNameToVictims := make(map[string]*schedulerapi.Victims)
+			podByUID := make(map[string]*v1.Pod)
+			for nodeName, pods := range tt.victims {
+				nodeNameToVictims[nodeName] = &schedulerapi.Victims{Pods: pods}
+				for _, pod := range pods {
+					podByUID[string(pod.UID)] = pod
+				}
+			}
+			nodeNameToMetaVictims := toMetaVictims(nodeNameToVictims)
+			selection := NewVictimSelection(tt.args, func(uid string) (*v1.Pod, bool) {
+				pod, ok := podByUID[uid]
+				return pod, ok
+			}, pdbLister(t, dbBudget))
+
+			// the scheduler sends full victims unless it is nodeCacheCapable
+			full := selection.Handler(schedulerapi.ExtenderPreemptionArgs{Pod: &preemptor, NodeNameToVictims: nodeNameToVictims})
+			if got := victimUIDs(full); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("with Victims: got %v, want %v", got, tt.want)
+			}
+			meta := selection.Handler(schedulerapi.ExtenderPreemptionArgs{Pod: &preemptor, NodeNameToMetaVictims: nodeNameToMetaVictims})
+			if got := victimUIDs(meta); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("with MetaVictims: got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVictimSelectionUnknownVictims(t *testing.T) {
+	preemptor := makePod("preemptor", "", "")
+	args := schedulerapi.ExtenderPreemptionArgs{
+		Pod: &preemptor,
+		NodeNameToMetaVictims: map[string]*schedulerapi.MetaVictims{
+			"a": {Pods: []*schedulerapi.MetaPod{{UID: "deleted"}}},
+		},
+	}
+
+	withoutCache := NewVictimSelection(VictimSelectionArgs{}, nil, nil)
+	if got := withoutCache.Handler(args).NodeNameToMetaVictims; len(got) != 0 {
+		t.Errorf("expected nodes to be vetoed without a pod cache, got %v", got)
+	}
+
+	withCache := NewVictimSelection(VictimSelectionArgs{}, func(string) (*v1.Pod, bool) { return nil, false }, nil)
+	got := withCache.Handler(args).NodeNameToMetaVictims
+	if victims, ok := got["a"]; !ok || len(victims.Pods) != 0 {
+		t.Errorf("expected the deleted victim to be trimmed, got %v", got)
+	}
+}
+
+func TestEchoPreemptionWithVictims(t *testing.T) {
+	preemptor := makePod("preemptor", "", "")
+	result := EchoPreemption.Handler(schedulerapi.ExtenderPreemptionArgs{
+		Pod: &preemptor,
+		NodeNameToVictims: map[string]*schedulerapi.Victims{
+			"a": {Pods: []*v1.Pod{victim("a1", 0, nil)}, NumPDBViolations: 1},
+		},
+	})
+	victims, ok := result.NodeNameToMetaVictims["a"]
+	if !ok || len(victims.Pods) != 1 || victims.Pods[0].UID != "a1-uid" || victims.NumPDBViolations != 1 {
+		t.Errorf("unexpected result %v", result.NodeNameToMetaVictims)
+	}
+}
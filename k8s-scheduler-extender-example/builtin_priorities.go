@@ -0,0 +1,279 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	schedulerapi "k8s.io/kubernetes/pkg/scheduler/apis/extender/v1"
+)
+
+const (
+	LeastAllocatedName     = "least_allocated"
+	MostAllocatedName      = "most_allocated"
+	BalancedAllocationName = "balanced_allocation"
+	TopologySpreadName     = "topology_spread"
+	WeightedPriorityName   = "weighted"
+)
+
+type AllocationArgs struct {
+	// Resources are the resources taken into account, with equal weight.
+	// Defaults to cpu and memory.
+	Resources []v1.ResourceName `json:"resources,omitempty"`
+}
+
+// NewLeastAllocatedPrioritize favors nodes with the most free capacity left
+// after placing the pod.
+func NewLeastAllocatedPrioritize(rawArgs json.RawMessage, client kubernetes.Interface) (Prioritize, error) {
+	return newAllocationPrioritize(LeastAllocatedName, rawArgs, client, func(fractions []float64) float64 {
+		var sum float64
+		for _, f := range fractions {
+			sum += 1 - f
+		}
+		return sum / float64(len(fractions))
+	})
+}
+
+// NewMostAllocatedPrioritize favors the fullest nodes, packing pods onto as
+// few nodes as possible.
+func NewMostAllocatedPrioritize(rawArgs json.RawMessage, client kubernetes.Interface) (Prioritize, error) {
+	return newAllocationPrioritize(MostAllocatedName, rawArgs, client, func(fractions []float64) float64 {
+		var sum float64
+		for _, f := range fractions {
+			sum += f
+		}
+		return sum / float64(len(fractions))
+	})
+}
+
+// NewBalancedAllocationPrioritize favors nodes whose resources would be used
+// evenly, i.e. where the requested fractions are closest to each other.
+func NewBalancedAllocationPrioritize(rawArgs json.RawMessage, client kubernetes.Interface) (Prioritize, error) {
+	return newAllocationPrioritize(BalancedAllocationName, rawArgs, client, func(fractions []float64) float64 {
+		min, max := 1.0, 0.0
+		for _, f := range fractions {
+			min = math.Min(min, f)
+			max = math.Max(max, f)
+		}
+		return 1 - (max - min)
+	})
+}
+
+// newAllocationPrioritize scores nodes by the fractions of their allocatable
+// resources that would be requested once the pod is placed. score maps the
+// per resource fractions, each in [0, 1], to a value in [0, 1].
+func newAllocationPrioritize(
+	name string,
+	rawArgs json.RawMessage,
+	client kubernetes.Interface,
+	score func(fractions []float64) float64,
+) (Prioritize, error) {
+	args := AllocationArgs{
+		Resources: []v1.ResourceName{v1.ResourceCPU, v1.ResourceMemory},
+	}
+	if err := decodeArgs(rawArgs, &args); err != nil {
+		return Prioritize{}, err
+	}
+	if len(args.Resources) == 0 {
+		return Prioritize{}, fmt.Errorf("resources must not be empty")
+	}
+	// Without a client no pods are known and only the pod itself is counted
+	var pods *podCache
+	if client != nil {
+		var err error
+		if pods, err = sharedPodCache(client); err != nil {
+			return Prioritize{}, err
+		}
+	}
+
+	return Prioritize{
+		Name: name,
+		Func: func(pod v1.Pod, nodes []v1.Node) (*schedulerapi.HostPriorityList, error) {
+			podRequest := podRequests(&pod)
+
+			priorityList := make(schedulerapi.HostPriorityList, len(nodes))
+			for i, node := range nodes {
+				podsOnNode, err := pods.podsOnNode(node.Name)
+				if err != nil {
+					return nil, err
+				}
+				requested := podRequest.DeepCopy()
+				for _, p := range podsOnNode {
+					addResourceList(requested, podRequests(p))
+				}
+				fractions := make([]float64, len(args.Resources))
+				for j, resourceName := range args.Resources {
+					fractions[j] = requestedFraction(resourceName, requested, node.Status.Allocatable)
+				}
+				priorityList[i] = schedulerapi.HostPriority{
+					Host:  node.Name,
+					Score: toExtenderScore(score(fractions)),
+				}
+			}
+			return &priorityList, nil
+		},
+	}, nil
+}
+
+// requestedFraction returns requested/allocatable for a resource clamped to
+// [0, 1]. A node without the resource counts as fully requested.
+func requestedFraction(name v1.ResourceName, requested, allocatable v1.ResourceList) float64 {
+	capacity := allocatable[name]
+	request := requested[name]
+	if capacity.IsZero() {
+		return 1
+	}
+	fraction := float64(request.MilliValue()) / float64(capacity.MilliValue())
+	return math.Max(0, math.Min(1, fraction))
+}
+
+func addResourceList(total, add v1.ResourceList) {
+	for name, q := range add {
+		sum := total[name]
+		sum.Add(q)
+		total[name] = sum
+	}
+}
+
+// toExtenderScore maps a value in [0, 1] to the extender score range.
+func toExtenderScore(v float64) int64 {
+	span := float64(schedulerapi.MaxExtenderPriority - schedulerapi.MinExtenderPriority)
+	return schedulerapi.MinExtenderPriority + int64(math.Round(math.Max(0, math.Min(1, v))*span))
+}
+
+type TopologySpreadArgs struct {
+	// TopologyKey is the node label whose values define the topology domains.
+	TopologyKey string `json:"topologyKey"`
+	// LabelSelector selects the pods counted in each domain. Defaults to the
+	// labels of the pod being scheduled.
+	LabelSelector *metav1.LabelSelector `json:"labelSelector,omitempty"`
+}
+
+// NewTopologySpreadPrioritize favors nodes in topology domains running the
+// fewest matching pods of the pod's namespace. Nodes without the topology
+// label get the minimum score.
+func NewTopologySpreadPrioritize(rawArgs json.RawMessage, client kubernetes.Interface) (Prioritize, error) {
+	var args TopologySpreadArgs
+	if err := decodeArgs(rawArgs, &args); err != nil {
+		return Prioritize{}, err
+	}
+	if args.TopologyKey == "" {
+		return Prioritize{}, fmt.Errorf("topologyKey is required")
+	}
+	var fixedSelector labels.Selector
+	if args.LabelSelector != nil {
+		var err error
+		if fixedSelector, err = metav1.LabelSelectorAsSelector(args.LabelSelector); err != nil {
+			return Prioritize{}, err
+		}
+	}
+	var pods *podCache
+	if client != nil {
+		var err error
+		if pods, err = sharedPodCache(client); err != nil {
+			return Prioritize{}, err
+		}
+	}
+
+	return Prioritize{
+		Name: TopologySpreadName,
+		Func: func(pod v1.Pod, nodes []v1.Node) (*schedulerapi.HostPriorityList, error) {
+			selector := fixedSelector
+			if selector == nil {
+				selector = labels.SelectorFromSet(pod.Labels)
+			}
+
+			counts := make(map[string]int)
+			for _, node := range nodes {
+				if domain, ok := node.Labels[args.TopologyKey]; ok {
+					counts[domain] = 0
+				}
+			}
+			if !selector.Empty() {
+				matching, err := pods.list(pod.Namespace, selector)
+				if err != nil {
+					return nil, err
+				}
+				domainOf := make(map[string]string, len(nodes))
+				for _, node := range nodes {
+					if domain, ok := node.Labels[args.TopologyKey]; ok {
+						domainOf[node.Name] = domain
+					}
+				}
+				for _, p := range matching {
+					if domain, ok := domainOf[p.Spec.NodeName]; ok {
+						counts[domain]++
+					}
+				}
+			}
+
+			maxCount := 0
+			for _, c := range counts {
+				if c > maxCount {
+					maxCount = c
+				}
+			}
+
+			priorityList := make(schedulerapi.HostPriorityList, len(nodes))
+			for i, node := range nodes {
+				score := schedulerapi.MinExtenderPriority
+				if domain, ok := node.Labels[args.TopologyKey]; ok {
+					if maxCount == 0 {
+						score = schedulerapi.MaxExtenderPriority
+					} else {
+						score = toExtenderScore(float64(maxCount-counts[domain]) / float64(maxCount))
+					}
+				}
+				priorityList[i] = schedulerapi.HostPriority{Host: node.Name, Score: score}
+			}
+			return &priorityList, nil
+		},
+	}, nil
+}
+
+// WeightedPrioritize is a Prioritize together with its weight in a
+// weighted combination.
+type WeightedPrioritize struct {
+	Prioritize
+	Weight int64
+}
+
+// NewWeightedPrioritize combines several priorities into one whose score is
+// the weighted average of theirs, so that a single ExtenderConfig
+// prioritizeVerb can serve them all.
+func NewWeightedPrioritize(priorities []WeightedPrioritize) Prioritize {
+	return Prioritize{
+		Name: WeightedPriorityName,
+		Func: func(pod v1.Pod, nodes []v1.Node) (*schedulerapi.HostPriorityList, error) {
+			totals := make(map[string]int64, len(nodes))
+			var totalWeight int64
+			for _, p := range priorities {
+				if p.Weight == 0 {
+					continue
+				}
+				list, err := p.Func(pod, nodes)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %v", p.Name, err)
+				}
+				for _, hp := range *list {
+					totals[hp.Host] += hp.Score * p.Weight
+				}
+				totalWeight += p.Weight
+			}
+
+			priorityList := make(schedulerapi.HostPriorityList, len(nodes))
+			for i, node := range nodes {
+				score := schedulerapi.MinExtenderPriority
+				if totalWeight > 0 {
+					score = int64(math.Round(float64(totals[node.Name]) / float64(totalWeight)))
+				}
+				priorityList[i] = schedulerapi.HostPriority{Host: node.Name, Score: score}
+			}
+			return &priorityList, nil
+		},
+	}
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	schedulerapi "k8s.io/kubernetes/pkg/scheduler/apis/extender/v1"
+)
+
+func boundPod(name, node, cpu, memory string, labels map[string]string) *v1.Pod {
+	pod := makePod(name, cpu, memory)
+	pod.Spec.NodeName = node
+	pod.Labels = labels
+	return &pod
+}
+
+func terminated(pod *v1.Pod) *v1.Pod {
+	pod.Status.Phase = v1.PodSucceeded
+	return pod
+}
+
+func withLabels(node v1.Node, labels map[string]string) v1.Node {
+	node.Labels = labels
+	return node
+}
+
+func scores(list *schedulerapi.HostPriorityList) map[string]int64 {
+	out := make(map[string]int64, len(*list))
+	for _, hp := range *list {
+		out[hp.Host] = hp.Score
+	}
+	return out
+}
+
+func TestPriorities(t *testing.T) {
+	tests := []struct {
+		name    string
+		factory PrioritizeFactory
+		args    string
+		pod     v1.Pod
+		nodes   v1.NodeList
+		pods    []runtime.Object
+		want    map[string]int64
+	}{
+		{
+			name:    "least allocated prefers the emptier node",
+			factory: NewLeastAllocatedPrioritize,
+			pod:     makePod("p", "1", "1Gi"),
+			nodes:   v1.NodeList{Items: []v1.Node{makeNode("big", "4", "4Gi"), makeNode("small", "2", "2Gi")}},
+			want:    map[string]int64{"big": 8, "small": 5},
+		},
+		{
+			name:    "least allocated accounts for bound pods",
+			factory: NewLeastAllocatedPrioritize,
+			pod:     makePod("p", "1", "1Gi"),
+			nodes:   v1.NodeList{Items: []v1.Node{makeNode("a", "4", "4Gi"), makeNode("b", "4", "4Gi")}},
+			pods:    []runtime.Object{boundPod("x", "a", "2", "2Gi", nil)},
+			want:    map[string]int64{"a": 3, "b": 8},
+		},
+		{
+			name:    "least allocated ignores terminated pods",
+			factory: NewLeastAllocatedPrioritize,
+			pod:     makePod("p", "1", "1Gi"),
+			nodes:   v1.NodeList{Items: []v1.Node{makeNode("a", "4", "4Gi"), makeNode("b", "4", "4Gi")}},
+			pods:    []runtime.Object{terminated(boundPod("x", "a", "2", "2Gi", nil))},
+			want:    map[string]int64{"a": 8, "b": 8},
+		},
+		{
+			name:    "least allocated clamps over-requested nodes",
+			factory: NewLeastAllocatedPrioritize,
+			pod:     makePod("p", "8", "8Gi"),
+			nodes:   v1.NodeList{Items: []v1.Node{makeNode("a", "4", "4Gi")}},
+			want:    map[string]int64{"a": 0},
+		},
+		{
+			name:    "most allocated prefers the fuller node",
+			factory: NewMostAllocatedPrioritize,
+			pod:     makePod("p", "1", "1Gi"),
+			nodes:   v1.NodeList{Items: []v1.Node{makeNode("big", "4", "4Gi"), makeNode("small", "2", "2Gi")}},
+			want:    map[string]int64{"big": 3, "small": 5},
+		},
+		{
+			name:    "most allocated on cpu only",
+			factory: NewMostAllocatedPrioritize,
+			args:    `{"resources": ["cpu"]}`,
+			pod:     makePod("p", "1", "1Gi"),
+			nodes:   v1.NodeList{Items: []v1.Node{makeNode("a", "1", "64Gi"), makeNode("b", "10", "1Gi")}},
+			want:    map[string]int64{"a": 10, "b": 1},
+		},
+		{
+			name:    "balanced allocation prefers even usage",
+			factory: NewBalancedAllocationPrioritize,
+			pod:     makePod("p", "1", "1Gi"),
+			nodes:   v1.NodeList{Items: []v1.Node{makeNode("even", "2", "2Gi"), makeNode("skewed", "2", "10Gi")}},
+			want:    map[string]int64{"even": 10, "skewed": 6},
+		},
+		{
+			name:    "topology spread without matching pods",
+			factory: NewTopologySpreadPrioritize,
+			args:    `{"topologyKey": "zone"}`,
+			pod:     *boundPod("p", "", "", "", map[string]string{"app": "web"}),
+			nodes: v1.NodeList{Items: []v1.Node{
+				withLabels(makeNode("a1", "2", "2Gi"), map[string]string{"zone": "a"}),
+				makeNode("unlabelled", "2", "2Gi"),
+			}},
+			want: map[string]int64{"a1": 10, "unlabelled": 0},
+		},
+		{
+			name:    "topology spread prefers the emptier zone",
+			factory: NewTopologySpreadPrioritize,
+			args:    `{"topologyKey": "zone"}`,
+			pod:     *boundPod("p", "", "", "", map[string]string{"app": "web"}),
+			nodes: v1.NodeList{Items: []v1.Node{
+				withLabels(makeNode("a1", "2", "2Gi"), map[string]string{"zone": "a"}),
+				withLabels(makeNode("a2", "2", "2Gi"), map[string]string{"zone": "a"}),
+				withLabels(makeNode("b1", "2", "2Gi"), map[string]string{"zone": "b"}),
+				withLabels(makeNode("c1", "2", "2Gi"), map[string]string{"zone": "c"}),
+			}},
+			pods: []runtime.Object{
+				boundPod("w1", "a1", "", "", map[string]string{"app": "web"}),
+				boundPod("w2", "a2", "", "", map[string]string{"app": "web"}),
+				boundPod("w3", "a2", "", "", map[string]string{"app": "web"}),
+				boundPod("w4", "a2", "", "", map[string]string{"app": "web"}),
+				boundPod("w5", "b1", "", "", map[string]string{"app": "web"}),
+				boundPod("db", "c1", "", "", map[string]string{"app": "db"}),
+			},
+			want: map[string]int64{"a1": 0, "a2": 0, "b1": 8, "c1": 10},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var client kubernetes.Interface
+			if tt.pods != nil {
+				client = fake.NewSimpleClientset(tt.pods...)
+			}
+			p, err := tt.factory(json.RawMessage(tt.args), client)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if client != nil {
+				startPodCache(t, client)
+			}
+			list, err := p.Handler(schedulerapi.ExtenderArgs{Pod: &tt.pod, Nodes: &tt.nodes})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := scores(list)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("scores = %v, want %v", got, tt.want)
+			}
+			for host, score := range got {
+				if score < schedulerapi.MinExtenderPriority || score > schedulerapi.MaxExtenderPriority {
+					t.Errorf("score %d of %s is out of range", score, host)
+				}
+			}
+		})
+	}
+}
+
+func TestPrioritiesReadFromCache(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		boundPod("w1", "a", "1", "1Gi", map[string]string{"app": "web"}),
+		boundPod("w2", "b", "1", "1Gi", map[string]string{"app": "web"}),
+	)
+	nodes := v1.NodeList{Items: []v1.Node{
+		withLabels(makeNode("a", "2", "2Gi"), map[string]string{"zone": "a"}),
+		withLabels(makeNode("b", "2", "2Gi"), map[string]string{"zone": "b"}),
+	}}
+	var priorities []Prioritize
+	for _, build := range []struct {
+		factory PrioritizeFactory
+		args    string
+	}{
+		{NewLeastAllocatedPrioritize, ""},
+		{NewTopologySpreadPrioritize, `{"topologyKey": "zone"}`},
+	} {
+		p, err := build.factory(json.RawMessage(build.args), client)
+		if err != nil {
+			t.Fatal(err)
+		}
+		priorities = append(priorities, p)
+	}
+	startPodCache(t, client)
+	before := len(client.Actions())
+
+	pod := boundPod("p", "", "1", "1Gi", map[string]string{"app": "web"})
+	for i := 0; i < 3; i++ {
+		for _, p := range priorities {
+			if _, err := p.Handler(schedulerapi.ExtenderArgs{Pod: pod, Nodes: &nodes}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if after := len(client.Actions()); after != before {
+		t.Errorf("prioritize sent %d requests to the API server, want none", after-before)
+	}
+}
+
+func TestWeightedPrioritize(t *testing.T) {
+	constant := func(name string, score map[string]int64) Prioritize {
+		return Prioritize{
+			Name: name,
+			Func: func(_ v1.Pod, nodes []v1.Node) (*schedulerapi.HostPriorityList, error) {
+				list := make(schedulerapi.HostPriorityList, len(nodes))
+				for i, node := range nodes {
+					list[i] = schedulerapi.HostPriority{Host: node.Name, Score: score[node.Name]}
+				}
+				return &list, nil
+			},
+		}
+	}
+	nodes := v1.NodeList{Items: []v1.Node{makeNode("a", "1", "1Gi"), makeNode("b", "1", "1Gi")}}
+
+	tests := []struct {
+		name       string
+		priorities []WeightedPrioritize
+		want       map[string]int64
+	}{
+		{
+			name:       "no priorities",
+			priorities: nil,
+			want:       map[string]int64{"a": 0, "b": 0},
+		},
+		{
+			name: "equal weights average",
+			priorities: []WeightedPrioritize{
+				{constant("x", map[string]int64{"a": 10, "b": 0}), 1},
+				{constant("y", map[string]int64{"a": 0, "b": 6}), 1},
+			},
+			want: map[string]int64{"a": 5, "b": 3},
+		},
+		{
+			name: "heavier weight dominates",
+			priorities: []WeightedPrioritize{
+				{constant("x", map[string]int64{"a": 10, "b": 0}), 3},
+				{constant("y", map[string]int64{"a": 0, "b": 10}), 1},
+			},
+			want: map[string]int64{"a": 8, "b": 3},
+		},
+		{
+			name: "zero weight is left out",
+			priorities: []WeightedPrioritize{
+				{constant("x", map[string]int64{"a": 10, "b": 0}), 0},
+				{constant("y", map[string]int64{"a": 0, "b": 6}), 1},
+			},
+			want: map[string]int64{"a": 0, "b": 6},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := makePod("p", "", "")
+			list, err := NewWeightedPrioritize(tt.priorities).Handler(schedulerapi.ExtenderArgs{Pod: &pod, Nodes: &nodes})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := scores(list); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("scores = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildPriorities(t *testing.T) {
+	config, err := ParseConfig([]byte(`
+priorities:
+- name: least_allocated
+  weight: 2
+- name: topology_spread
+  args:
+    topologyKey: topology.kubernetes.io/zone
+- name: balanced_allocation
+  weight: 0
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	priorities, err := BuildPriorities(config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(priorities) != 3 || priorities[0].Weight != 2 || priorities[1].Weight != 1 || priorities[2].Weight != 0 {
+		t.Errorf("unexpected priorities %v", priorities)
+	}
+
+	for _, doc := range []string{
+		`priorities: [{name: unknown}]`,
+		`priorities: [{name: topology_spread}]`,
+		`priorities: [{name: weighted}]`,
+		`priorities: [{name: least_allocated, weight: -1}]`,
+		`predicates: [{name: resource_fit, weight: 2}]`,
+	} {
+		config, err := ParseConfig([]byte(doc))
+		if err == nil {
+			_, err = BuildPriorities(config, nil)
+		}
+		if err == nil {
+			t.Errorf("expected an error for %q", doc)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Config is the extender policy file. It selects which registered plugins are
+// served and carries the plugin specific arguments.
+type Config struct {
+	Predicates []PluginConfig `json:"predicates,omitempty"`
+	Priorities []PluginConfig `json:"priorities,omitempty"`
+	// Preemption is the policy served on the preemption route, if any.
+	Preemption *PluginConfig `json:"preemption,omitempty"`
+}
+
+// PluginConfig enables a single registered plugin. Args are decoded by the
+// plugin's factory, so their shape depends on the plugin.
+type PluginConfig struct {
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args,omitempty"`
+	// Weight of a priority in the combined "weighted" priority. Defaults to 1
+	// when unset, 0 leaves the priority out of the combined one. Must not be
+	// set for predicates.
+	Weight *int64 `json:"weight,omitempty"`
+}
+
+// DefaultConfig is used when no policy file is given and mirrors the
+// behaviour of the original example.
+func DefaultConfig() *Config {
+	return &Config{
+		Predicates: []PluginConfig{{Name: TruePredicate.Name}},
+		Priorities: []PluginConfig{{Name: ZeroPriority.Name}},
+		Preemption: &PluginConfig{Name: EchoPreemptionName},
+	}
+}
+
+// LoadConfig reads a YAML or JSON policy file.
+func LoadConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseConfig(data)
+}
+
+// ParseConfig decodes a YAML or JSON policy document.
+func ParseConfig(data []byte) (*Config, error) {
+	jsonData, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	var config Config
+	if err := decodeStrict(jsonData, &config); err != nil {
+		return nil, err
+	}
+	for i, p := range config.Predicates {
+		if p.Name == "" {
+			return nil, fmt.Errorf("predicates[%d]: name is required", i)
+		}
+		if p.Weight != nil {
+			return nil, fmt.Errorf("predicates[%d]: weight is only supported for priorities", i)
+		}
+	}
+	for i, p := range config.Priorities {
+		if p.Name == "" {
+			return nil, fmt.Errorf("priorities[%d]: name is required", i)
+		}
+		if p.Name == WeightedPriorityName {
+			return nil, fmt.Errorf("priorities[%d]: %q is reserved for the combined priority", i, p.Name)
+		}
+		if p.Weight != nil && *p.Weight < 0 {
+			return nil, fmt.Errorf("priorities[%d]: weight must not be negative", i)
+		}
+	}
+	if p := config.Preemption; p != nil {
+		if p.Name == "" {
+			return nil, fmt.Errorf("preemption: name is required")
+		}
+		if p.Weight != nil {
+			return nil, fmt.Errorf("preemption: weight is only supported for priorities")
+		}
+	}
+	return &config, nil
+}
+
+// decodeArgs decodes plugin args into out, leaving out untouched when no
+// args were configured so that factories can pre-populate defaults.
+func decodeArgs(args json.RawMessage, out interface{}) error {
+	if len(args) == 0 || string(args) == "null" {
+		return nil
+	}
+	return decodeStrict(args, out)
+}
+
+func decodeStrict(data []byte, out interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(out)
+}
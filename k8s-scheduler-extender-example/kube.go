@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	policylisters "k8s.io/client-go/listers/policy/v1beta1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// NewClientset builds a clientset from kubeconfig, or from the in-cluster
+// service account when kubeconfig is empty.
+func NewClientset(kubeconfig string) (kubernetes.Interface, error) {
+	var config *rest.Config
+	var err error
+	if kubeconfig == "" {
+		config, err = rest.InClusterConfig()
+	} else {
+		config, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return kubernetes.NewForConfig(config)
+}
+
+const (
+	podNodeNameIndex = "spec.nodeName"
+	podUIDIndex      = "uid"
+)
+
+// podCache is a pod informer cache shared by the built-in plugins, so that
+// filtering and scoring read pods from memory instead of listing them from the
+// API server on every request. A nil cache holds no pods.
+type podCache struct {
+	factory informers.SharedInformerFactory
+	synced  cache.InformerSynced
+	indexer cache.Indexer
+	lister  corelisters.PodLister
+}
+
+var (
+	podCachesMu sync.Mutex
+	podCaches   = make(map[kubernetes.Interface]*podCache)
+)
+
+// sharedPodCache returns the pod cache of client. The first call sets up the
+// pod informer, later calls for the same client reuse it. The informer only
+// runs once StartPodCache is called, reads fail until it has synced.
+func sharedPodCache(client kubernetes.Interface) (*podCache, error) {
+	podCachesMu.Lock()
+	defer podCachesMu.Unlock()
+	if c, ok := podCaches[client]; ok {
+		return c, nil
+	}
+
+	factory := informers.NewSharedInformerFactory(client, 0)
+	pods := factory.Core().V1().Pods()
+	informer := pods.Informer()
+	if err := informer.AddIndexers(cache.Indexers{
+		podNodeNameIndex: func(obj interface{}) ([]string, error) {
+			if nodeName := obj.(*v1.Pod).Spec.NodeName; nodeName != "" {
+				return []string{nodeName}, nil
+			}
+			return nil, nil
+		},
+		podUIDIndex: func(obj interface{}) ([]string, error) {
+			return []string{string(obj.(*v1.Pod).UID)}, nil
+		},
+	}); err != nil {
+		return nil, err
+	}
+
+	c := &podCache{
+		factory: factory,
+		synced:  informer.HasSynced,
+		indexer: informer.GetIndexer(),
+		lister:  pods.Lister(),
+	}
+	podCaches[client] = c
+	return c, nil
+}
+
+// StartPodCache starts the pod informer the built-in plugins of client read
+// from, together with the informers registered next to it, and waits up to
+// timeout for them to sync. It does nothing when none of the plugins reads
+// pods. The informers keep running until stopCh is closed, so a cache that did
+// not sync in time may still catch up later. Closing stopCh also forgets the
+// cache, so that short-lived clients such as the ones of simulations do not
+// pile up.
+func StartPodCache(client kubernetes.Interface, stopCh <-chan struct{}, timeout time.Duration) error {
+	podCachesMu.Lock()
+	c, ok := podCaches[client]
+	podCachesMu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	c.factory.Start(stopCh)
+	go func() {
+		<-stopCh
+		podCachesMu.Lock()
+		defer podCachesMu.Unlock()
+		if podCaches[client] == c {
+			delete(podCaches, client)
+		}
+	}()
+	waitCh := make(chan struct{})
+	go func() {
+		defer close(waitCh)
+		select {
+		case <-stopCh:
+		case <-time.After(timeout):
+		}
+	}()
+	for informerType, synced := range c.factory.WaitForCacheSync(waitCh) {
+		if !synced {
+			return fmt.Errorf("timed out after %v waiting for the %v cache to sync", timeout, informerType)
+		}
+	}
+	return nil
+}
+
+// pdbs registers a PodDisruptionBudget informer next to the pod informer, so
+// that StartPodCache starts it and waits for it as well.
+func (c *podCache) pdbs() (policylisters.PodDisruptionBudgetLister, cache.InformerSynced) {
+	pdbs := c.factory.Policy().V1beta1().PodDisruptionBudgets()
+	return pdbs.Lister(), pdbs.Informer().HasSynced
+}
+
+// ready returns an error until the cache has synced.
+func (c *podCache) ready() error {
+	if c != nil && !c.synced() {
+		return fmt.Errorf("the pod cache has not synced yet")
+	}
+	return nil
+}
+
+// podsOnNode returns the non-terminated pods bound to nodeName.
+func (c *podCache) podsOnNode(nodeName string) ([]*v1.Pod, error) {
+	if c == nil {
+		return nil, nil
+	}
+	if err := c.ready(); err != nil {
+		return nil, err
+	}
+	objs, err := c.indexer.ByIndex(podNodeNameIndex, nodeName)
+	if err != nil {
+		return nil, err
+	}
+	pods := make([]*v1.Pod, 0, len(objs))
+	for _, obj := range objs {
+		if pod := obj.(*v1.Pod); !isTerminated(pod) {
+			pods = append(pods, pod)
+		}
+	}
+	return pods, nil
+}
+
+// list returns the non-terminated pods of namespace matching selector.
+func (c *podCache) list(namespace string, selector labels.Selector) ([]*v1.Pod, error) {
+	if c == nil {
+		return nil, nil
+	}
+	if err := c.ready(); err != nil {
+		return nil, err
+	}
+	all, err := c.lister.Pods(namespace).List(selector)
+	if err != nil {
+		return nil, err
+	}
+	pods := make([]*v1.Pod, 0, len(all))
+	for _, pod := range all {
+		if !isTerminated(pod) {
+			pods = append(pods, pod)
+		}
+	}
+	return pods, nil
+}
+
+// podByUID looks up a pod by UID.
+func (c *podCache) podByUID(uid string) (*v1.Pod, bool) {
+	if c == nil {
+		return nil, false
+	}
+	objs, err := c.indexer.ByIndex(podUIDIndex, uid)
+	if err != nil || len(objs) == 0 {
+		return nil, false
+	}
+	return objs[0].(*v1.Pod), true
+}
+
+func isTerminated(pod *v1.Pod) bool {
+	return pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// startPodCache starts the pod cache of client for the duration of the test.
+func startPodCache(t *testing.T, client kubernetes.Interface) {
+	t.Helper()
+	stopCh := make(chan struct{})
+	t.Cleanup(func() { close(stopCh) })
+	if err := StartPodCache(client, stopCh, 10*time.Second); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStartPodCacheTimesOut(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("list", "pods", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, fmt.Errorf("pods is forbidden")
+	})
+	p, err := NewMaxPodsPredicate(json.RawMessage(`{"maxPods": 1}`), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	start := time.Now()
+	if err := StartPodCache(client, stopCh, 100*time.Millisecond); err == nil {
+		t.Fatal("expected the pod cache not to sync")
+	}
+	if took := time.Since(start); took > 5*time.Second {
+		t.Errorf("StartPodCache returned after %v, want about the timeout", took)
+	}
+
+	router := httprouter.New()
+	AddPredicate(router, p)
+	body := `{"Pod": {"metadata": {"name": "p"}}, "Nodes": {"items": [{"metadata": {"name": "n"}}]}}`
+	req := httptest.NewRequest(http.MethodPost, predicatesPrefix+"/"+p.Name, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+	if !strings.Contains(rec.Body.String(), "not synced") {
+		t.Errorf("body %q does not explain the error", rec.Body.String())
+	}
+}
+
+func TestStartPodCacheWaitsForPDBs(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("list", "poddisruptionbudgets", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, fmt.Errorf("poddisruptionbudgets is forbidden")
+	})
+	p, err := NewVictimSelectionPreemption(json.RawMessage(`{"respectPDBs": true}`), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	if err := StartPodCache(client, stopCh, 100*time.Millisecond); err == nil {
+		t.Fatal("expected the PodDisruptionBudget cache not to sync")
+	}
+	if err := p.Ready(); err == nil || !strings.Contains(err.Error(), "PodDisruptionBudget") {
+		t.Errorf("Ready() = %v, want the PodDisruptionBudget cache not to be ready", err)
+	}
+
+	router := httprouter.New()
+	AddPreemption(router, p)
+	req := httptest.NewRequest(http.MethodPost, preemptionPath, strings.NewReader(`{"Pod": {"metadata": {"name": "p"}}}`))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestStartPodCacheWithoutPlugins(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	if err := StartPodCache(client, make(chan struct{}), time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if actions := client.Actions(); len(actions) != 0 {
+		t.Errorf("no plugin reads pods, but %d requests were sent", len(actions))
+	}
+}
+
+func TestStartPodCacheForgetsStoppedCache(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	if _, err := NewMaxPodsPredicate(json.RawMessage(`{"maxPods": 1}`), client); err != nil {
+		t.Fatal(err)
+	}
+	stopCh := make(chan struct{})
+	if err := StartPodCache(client, stopCh, 10*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	close(stopCh)
+
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		podCachesMu.Lock()
+		_, ok := podCaches[client]
+		podCachesMu.Unlock()
+		if !ok {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the pod cache is still kept after its stop channel was closed")
+		}
+	}
+}
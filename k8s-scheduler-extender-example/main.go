@@ -1,22 +1,29 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/comail/colog"
 	"github.com/julienschmidt/httprouter"
 
 	"k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
 	schedulerapi "k8s.io/kubernetes/pkg/scheduler/apis/extender/v1"
 )
 
 const (
 	versionPath      = "/version"
+	metricsPath      = "/metrics"
 	apiPrefix        = "/scheduler"
 	bindPath         = apiPrefix + "/bind"
 	preemptionPath   = apiPrefix + "/preemption"
@@ -27,9 +34,26 @@ const (
 var (
 	version string // injected via ldflags at build time
 
+	address            = flag.String("address", "", "IP address to listen on. All interfaces are used when empty.")
+	port               = flag.Int("port", 80, "Port to listen on.")
+	tlsCertFile        = flag.String("tls-cert-file", "", "File containing the serving certificate. HTTPS is served when set.")
+	tlsKeyFile         = flag.String("tls-private-key-file", "", "File containing the private key of --tls-cert-file.")
+	clientCAFile       = flag.String("client-ca-file", "", "CA bundle used to verify client certificates. Clients must present a certificate when set.")
+	certReloadInterval = flag.Duration("cert-reload-interval", time.Minute, "How often the certificate files are checked for changes.")
+
+	configFile      = flag.String("config", "", "Path to the extender policy file (YAML or JSON). The always_true predicate is served when empty.")
+	kubeconfig      = flag.String("kubeconfig", "", "Path to a kubeconfig. The in-cluster config is used when empty.")
+	requestIDHeader = flag.String("request-id-header", RequestIDHeader, "Request header carrying an optional request ID that is logged with every line of the request.")
+	nodeCache       = flag.Bool("node-cache", false, "Keep a node informer cache and accept node names from a nodeCacheCapable scheduler.")
+
+	podCacheSyncTimeout = flag.Duration("pod-cache-sync-timeout", 30*time.Second, "How long to wait at startup for the pod and PodDisruptionBudget caches of the built-in policies to sync. Requests reading them fail with a 500 until they have synced.")
+
+	predicateParallelism = flag.Int("predicate-parallelism", PredicateParallelism, "Number of nodes a predicate evaluates concurrently.")
+	predicateTimeout     = flag.Duration("predicate-timeout", 0, "Deadline for evaluating the nodes of a predicate request; nodes not evaluated in time are reported as failed. Keep it below the scheduler's httpTimeout. Zero disables the deadline.")
+
 	TruePredicate = Predicate{
 		Name: "always_true",
-		Func: func(pod v1.Pod, node v1.Node) (bool, error) {
+		Func: func(pod *v1.Pod, node *v1.Node) (bool, error) {
 			return true, nil
 		},
 	}
@@ -87,6 +111,16 @@ func StringToLevel(levelStr string) colog.Level {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "simulate" {
+		if err := runSimulate(os.Args[2:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	flag.Parse()
+
 	colog.SetDefaultLevel(colog.LInfo)
 	colog.SetMinLevel(colog.LInfo)
 	colog.SetFormatter(&colog.StdFormatter{
@@ -98,23 +132,113 @@ func main() {
 	log.Print("Log level was set to ", strings.ToUpper(level.String()))
 	colog.SetMinLevel(level)
 
+	RequestIDHeader = *requestIDHeader
+	if *predicateParallelism < 1 {
+		log.Fatal("error: --predicate-parallelism must be at least 1")
+	}
+	PredicateParallelism = *predicateParallelism
+	PredicateTimeout = *predicateTimeout
+
+	if (*tlsCertFile == "") != (*tlsKeyFile == "") {
+		log.Fatal("error: --tls-cert-file and --tls-private-key-file must be set together")
+	}
+	if *clientCAFile != "" && *tlsCertFile == "" {
+		log.Fatal("error: --client-ca-file requires --tls-cert-file and --tls-private-key-file")
+	}
+
 	router := httprouter.New()
 	AddVersion(router)
+	AddMetrics(router)
+
+	config := DefaultConfig()
+	if *configFile != "" {
+		var err error
+		if config, err = LoadConfig(*configFile); err != nil {
+			log.Fatalf("error: failed to load config %s: %v", *configFile, err)
+		}
+	}
+
+	var client kubernetes.Interface
+	if cs, err := NewClientset(*kubeconfig); err != nil {
+		log.Printf("warning: running without a Kubernetes client: %v", err)
+	} else {
+		client = cs
+	}
 
-	predicates := []Predicate{TruePredicate}
+	if *nodeCache {
+		if client == nil {
+			log.Fatal("error: --node-cache requires a Kubernetes client")
+		}
+		lister, err := StartNodeCache(client, wait.NeverStop)
+		if err != nil {
+			log.Fatal("error: ", err)
+		}
+		UseNodeCache(lister)
+		log.Print("info: node cache synced, accepting node names")
+	}
+
+	predicates, err := BuildPredicates(config, client)
+	if err != nil {
+		log.Fatal("error: ", err)
+	}
 	for _, p := range predicates {
+		log.Print("info: serving predicate ", p.Name)
 		AddPredicate(router, p)
 	}
 
-	priorities := []Prioritize{ZeroPriority}
+	priorities, err := BuildPriorities(config, client)
+	if err != nil {
+		log.Fatal("error: ", err)
+	}
 	for _, p := range priorities {
-		AddPrioritize(router, p)
+		log.Print("info: serving priority ", p.Name, " with weight ", p.Weight)
+		AddPrioritize(router, p.Prioritize)
+	}
+	if len(priorities) > 0 {
+		AddPrioritize(router, NewWeightedPrioritize(priorities))
 	}
 
-	AddBind(router, NoBind)
+	preemption, err := BuildPreemption(config, client)
+	if err != nil {
+		log.Fatal("error: ", err)
+	}
+	if preemption != nil {
+		log.Print("info: serving preemption ", config.Preemption.Name)
+		AddPreemption(router, *preemption)
+	}
 
-	log.Print("info: server starting on the port :80")
-	if err := http.ListenAndServe(":80", router); err != nil {
+	if client != nil {
+		if err := StartPodCache(client, wait.NeverStop, *podCacheSyncTimeout); err != nil {
+			log.Print("warning: ", err, ", requests reading pods fail until it has synced")
+		}
+	}
+
+	if client != nil {
+		AddBind(router, NewClientBind(client))
+	} else {
+		AddBind(router, NoBind)
+	}
+
+	server := &http.Server{
+		Addr:    net.JoinHostPort(*address, strconv.Itoa(*port)),
+		Handler: router,
+	}
+	if *tlsCertFile == "" {
+		log.Print("info: server starting on ", server.Addr)
+		if err := server.ListenAndServe(); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	certs, err := newCertReloader(*tlsCertFile, *tlsKeyFile, *clientCAFile)
+	if err != nil {
+		log.Fatal("error: failed to load certificates: ", err)
+	}
+	go certs.Run(*certReloadInterval, wait.NeverStop)
+	server.TLSConfig = certs.TLSConfig()
+	log.Print("info: HTTPS server starting on ", server.Addr, ", client certificates required: ", *clientCAFile != "")
+	if err := server.ListenAndServeTLS("", ""); err != nil {
 		log.Fatal(err)
 	}
 }
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const metricsNamespace = "scheduler_extender"
+
+var (
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of the extender HTTP requests, by path and status code.",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 16),
+	}, []string{"path", "code"})
+
+	predicateDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "predicate_duration_seconds",
+		Help:      "Time spent evaluating a predicate over all candidate nodes of a request.",
+		Buckets:   prometheus.ExponentialBuckets(0.0001, 2, 16),
+	}, []string{"predicate"})
+
+	predicateNodes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "predicate_nodes_total",
+		Help:      "Number of nodes evaluated by a predicate, by result (passed or filtered).",
+	}, []string{"predicate", "result"})
+
+	predicateFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "predicate_failures_total",
+		Help:      "Number of nodes a predicate reported as failed, by reason.",
+	}, []string{"predicate", "reason"})
+
+	prioritizeDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "priority_duration_seconds",
+		Help:      "Time spent scoring all candidate nodes of a request.",
+		Buckets:   prometheus.ExponentialBuckets(0.0001, 2, 16),
+	}, []string{"priority"})
+
+	prioritizeErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "priority_errors_total",
+		Help:      "Number of prioritize requests that failed.",
+	}, []string{"priority"})
+
+	preemptionDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "preemption_duration_seconds",
+		Help:      "Time spent processing a preemption request.",
+		Buckets:   prometheus.ExponentialBuckets(0.0001, 2, 16),
+	})
+
+	bindings = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "bindings_total",
+		Help:      "Number of bind requests, by result (success or failure).",
+	}, []string{"result"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		httpRequestDuration,
+		predicateDuration,
+		predicateNodes,
+		predicateFailures,
+		prioritizeDuration,
+		prioritizeErrors,
+		preemptionDuration,
+		bindings,
+	)
+}
+
+const (
+	// ReasonOther labels failures of predicates that return plain errors.
+	ReasonOther = "Other"
+	// ReasonNodeNotFound labels node names missing from the node cache.
+	ReasonNodeNotFound = "NodeNotFound"
+	// ReasonTimeout labels nodes not evaluated before the predicate deadline.
+	ReasonTimeout = "Timeout"
+)
+
+// PredicateFailure is a predicate error with a stable, low cardinality reason
+// that is used as metric label, while the message is reported to the
+// scheduler.
+type PredicateFailure struct {
+	Reason  string
+	Message string
+}
+
+func (f *PredicateFailure) Error() string {
+	return f.Message
+}
+
+// NewPredicateFailure formats a PredicateFailure.
+func NewPredicateFailure(reason string, format string, args ...interface{}) error {
+	return &PredicateFailure{Reason: reason, Message: fmt.Sprintf(format, args...)}
+}
+
+func failureReason(err error) string {
+	var failure *PredicateFailure
+	if errors.As(err, &failure) {
+		return failure.Reason
+	}
+	return ReasonOther
+}
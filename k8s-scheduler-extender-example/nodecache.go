@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	schedulerapi "k8s.io/kubernetes/pkg/scheduler/apis/extender/v1"
+)
+
+// nodeLister backs the nodeCacheCapable mode. It is nil unless UseNodeCache
+// was called, in which case requests carrying only node names are served.
+var nodeLister corelisters.NodeLister
+
+// UseNodeCache makes the predicate and priority handlers resolve node names
+// through lister.
+func UseNodeCache(lister corelisters.NodeLister) {
+	nodeLister = lister
+}
+
+// StartNodeCache starts a node informer and waits for its cache to sync.
+func StartNodeCache(client kubernetes.Interface, stopCh <-chan struct{}) (corelisters.NodeLister, error) {
+	factory := informers.NewSharedInformerFactory(client, 0)
+	nodes := factory.Core().V1().Nodes()
+	informer := nodes.Informer()
+	factory.Start(stopCh)
+	if !cache.WaitForCacheSync(stopCh, informer.HasSynced) {
+		return nil, fmt.Errorf("timed out waiting for the node cache to sync")
+	}
+	return nodes.Lister(), nil
+}
+
+// resolveNodes returns the candidate nodes of args. A nodeCacheCapable
+// scheduler only sends node names, which are looked up in the node cache;
+// names missing from it are returned as failed nodes.
+func resolveNodes(args schedulerapi.ExtenderArgs) ([]v1.Node, schedulerapi.FailedNodesMap, error) {
+	failedNodes := make(schedulerapi.FailedNodesMap)
+	if args.Nodes != nil {
+		return args.Nodes.Items, failedNodes, nil
+	}
+	if args.NodeNames == nil {
+		return nil, nil, fmt.Errorf("either Nodes or NodeNames must be set")
+	}
+	if nodeLister == nil {
+		return nil, nil, fmt.Errorf("received NodeNames but the extender is not running with a node cache")
+	}
+
+	nodes := make([]v1.Node, 0, len(*args.NodeNames))
+	for _, name := range *args.NodeNames {
+		node, err := nodeLister.Get(name)
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				failedNodes[name] = "node not found in the extender cache"
+				continue
+			}
+			return nil, nil, err
+		}
+		nodes = append(nodes, *node)
+	}
+	return nodes, failedNodes, nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"k8s.io/api/core/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	schedulerapi "k8s.io/kubernetes/pkg/scheduler/apis/extender/v1"
+)
+
+func withNodeCache(t *testing.T, nodes ...v1.Node) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for i := range nodes {
+		if err := indexer.Add(&nodes[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	UseNodeCache(corelisters.NewNodeLister(indexer))
+}
+
+func TestPredicateHandlerNodeNames(t *testing.T) {
+	withNodeCache(t, makeNode("a", "1", "1Gi"), makeNode("b", "1", "1Gi"), makeNode("c", "1", "1Gi"))
+	defer UseNodeCache(nil)
+
+	predicate := Predicate{
+		Name: "not_b",
+		Func: func(_ *v1.Pod, node *v1.Node) (bool, error) {
+			if node.Name == "b" {
+				return false, fmt.Errorf("b is excluded")
+			}
+			return true, nil
+		},
+	}
+	pod := makePod("p", "", "")
+	names := []string{"a", "b", "c", "gone"}
+	result := predicate.Handler(schedulerapi.ExtenderArgs{Pod: &pod, NodeNames: &names})
+
+	if result.Error != "" || result.Nodes != nil {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	if result.NodeNames == nil || !reflect.DeepEqual(*result.NodeNames, []string{"a", "c"}) {
+		t.Errorf("NodeNames = %v, want [a c]", result.NodeNames)
+	}
+	if len(result.FailedNodes) != 2 || result.FailedNodes["b"] == "" || result.FailedNodes["gone"] == "" {
+		t.Errorf("FailedNodes = %v", result.FailedNodes)
+	}
+}
+
+func TestPrioritizeHandlerNodeNames(t *testing.T) {
+	withNodeCache(t, makeNode("a", "4", "4Gi"), makeNode("b", "2", "2Gi"))
+	defer UseNodeCache(nil)
+
+	p, err := NewLeastAllocatedPrioritize(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pod := makePod("p", "1", "1Gi")
+	names := []string{"a", "gone", "b"}
+	list, err := p.Handler(schedulerapi.ExtenderArgs{Pod: &pod, NodeNames: &names})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int64{"a": 8, "b": 5, "gone": 0}
+	if got := scores(list); !reflect.DeepEqual(got, want) {
+		t.Errorf("scores = %v, want %v", got, want)
+	}
+}
+
+func TestPrioritizeHandlerNilList(t *testing.T) {
+	withNodeCache(t)
+	defer UseNodeCache(nil)
+
+	p := Prioritize{
+		Name: "nil_list",
+		Func: func(v1.Pod, []v1.Node) (*schedulerapi.HostPriorityList, error) {
+			return nil, nil
+		},
+	}
+	pod := makePod("p", "", "")
+	names := []string{"gone"}
+	list, err := p.Handler(schedulerapi.ExtenderArgs{Pod: &pod, NodeNames: &names})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := scores(list), map[string]int64{"gone": 0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("scores = %v, want %v", got, want)
+	}
+}
+
+func TestNodeNamesWithoutCache(t *testing.T) {
+	pod := makePod("p", "", "")
+	names := []string{"a"}
+	if result := TruePredicate.Handler(schedulerapi.ExtenderArgs{Pod: &pod, NodeNames: &names}); result.Error == "" {
+		t.Error("expected an error without a node cache")
+	}
+	if result := TruePredicate.Handler(schedulerapi.ExtenderArgs{Pod: &pod}); result.Error == "" {
+		t.Error("expected an error without nodes")
+	}
+}
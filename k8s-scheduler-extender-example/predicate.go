@@ -1,38 +1,171 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
 	"k8s.io/api/core/v1"
 	schedulerapi "k8s.io/kubernetes/pkg/scheduler/apis/extender/v1"
 )
 
+var (
+	// PredicateParallelism is the number of nodes evaluated concurrently by a
+	// predicate request.
+	PredicateParallelism = 16
+	// PredicateTimeout bounds the time a predicate request spends evaluating
+	// nodes. Nodes not evaluated in time are reported as failed. Zero means
+	// no deadline.
+	PredicateTimeout time.Duration
+)
+
 type Predicate struct {
 	Name string
-	Func func(pod v1.Pod, node v1.Node) (bool, error)
+	// Func must not modify pod or node and must be safe for concurrent use.
+	Func func(pod *v1.Pod, node *v1.Node) (bool, error)
+	// Ready, when set, returns an error until the caches read by Func have
+	// synced. Requests fail with a 500 meanwhile.
+	Ready func() error
+}
+
+// nodeResult is the outcome of evaluating the predicate on a single node.
+type nodeResult struct {
+	evaluated bool
+	fit       bool
+	err       error
 }
 
 func (p Predicate) Handler(args schedulerapi.ExtenderArgs) *schedulerapi.ExtenderFilterResult {
+	start := time.Now()
+	defer func() {
+		predicateDuration.WithLabelValues(p.Name).Observe(time.Since(start).Seconds())
+	}()
+
 	pod := args.Pod
-	canSchedule := make([]v1.Node, 0, len(args.Nodes.Items))
-	canNotSchedule := make(map[string]string)
-
-	for _, node := range args.Nodes.Items {
-		result, err := p.Func(*pod, node)
-		if err != nil {
-			canNotSchedule[node.Name] = err.Error()
-		} else {
-			if result {
-				canSchedule = append(canSchedule, node)
-			}
+	nodes, canNotSchedule, err := resolveNodes(args)
+	if err != nil {
+		return &schedulerapi.ExtenderFilterResult{
+			Error: err.Error(),
 		}
 	}
+	canSchedule := make([]v1.Node, 0, len(nodes))
+	if len(canNotSchedule) > 0 {
+		predicateFailures.WithLabelValues(p.Name, ReasonNodeNotFound).Add(float64(len(canNotSchedule)))
+	}
+
+	ctx := context.Background()
+	if PredicateTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, PredicateTimeout)
+		defer cancel()
+	}
+
+	// results are collected in node order so the response does not depend on
+	// the scheduling of the workers
+	for i, result := range p.evaluate(ctx, pod, nodes) {
+		node := nodes[i]
+		switch {
+		case !result.evaluated:
+			canNotSchedule[node.Name] = fmt.Sprintf("predicate %s did not evaluate the node within %v", p.Name, PredicateTimeout)
+			predicateFailures.WithLabelValues(p.Name, ReasonTimeout).Inc()
+		case result.err != nil:
+			canNotSchedule[node.Name] = result.err.Error()
+			predicateFailures.WithLabelValues(p.Name, failureReason(result.err)).Inc()
+		case result.fit:
+			canSchedule = append(canSchedule, node)
+		}
+	}
+
+	predicateNodes.WithLabelValues(p.Name, "passed").Add(float64(len(canSchedule)))
+	predicateNodes.WithLabelValues(p.Name, "filtered").Add(float64(len(nodes) - len(canSchedule)))
 
 	result := schedulerapi.ExtenderFilterResult{
-		Nodes: &v1.NodeList{
-			Items: canSchedule,
-		},
 		FailedNodes: canNotSchedule,
 		Error:       "",
 	}
+	if args.Nodes != nil {
+		result.Nodes = &v1.NodeList{
+			Items: canSchedule,
+		}
+	} else {
+		nodeNames := make([]string, len(canSchedule))
+		for i, node := range canSchedule {
+			nodeNames[i] = node.Name
+		}
+		result.NodeNames = &nodeNames
+	}
 
 	return &result
 }
+
+// evaluate runs the predicate on nodes with up to PredicateParallelism
+// workers and returns one result per node. It returns when all nodes were
+// evaluated or when ctx is done; nodes still pending or being evaluated at
+// that point are left unevaluated. A panic of the predicate is re-raised in
+// the calling goroutine.
+func (p Predicate) evaluate(ctx context.Context, pod *v1.Pod, nodes []v1.Node) []nodeResult {
+	workers := PredicateParallelism
+	if workers > len(nodes) {
+		workers = len(nodes)
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	var (
+		mu       sync.Mutex
+		results  = make([]nodeResult, len(nodes))
+		closed   bool
+		panicked interface{}
+		next     int64 = -1
+		wg       sync.WaitGroup
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					mu.Lock()
+					if panicked == nil {
+						panicked = r
+					}
+					mu.Unlock()
+				}
+			}()
+			for {
+				i := int(atomic.AddInt64(&next, 1))
+				if i >= len(nodes) || ctx.Err() != nil {
+					return
+				}
+				fit, err := p.Func(pod, &nodes[i])
+				mu.Lock()
+				if !closed {
+					results[i] = nodeResult{evaluated: true, fit: fit, err: err}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+
+	// workers still running past the deadline must not touch results anymore
+	mu.Lock()
+	defer mu.Unlock()
+	closed = true
+	if panicked != nil {
+		panic(panicked)
+	}
+	return results
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/api/core/v1"
+	schedulerapi "k8s.io/kubernetes/pkg/scheduler/apis/extender/v1"
+)
+
+func withPredicateSettings(parallelism int, timeout time.Duration) func() {
+	oldParallelism, oldTimeout := PredicateParallelism, PredicateTimeout
+	PredicateParallelism, PredicateTimeout = parallelism, timeout
+	return func() {
+		PredicateParallelism, PredicateTimeout = oldParallelism, oldTimeout
+	}
+}
+
+func syntheticNodes(n int) []v1.Node {
+	nodes := make([]v1.Node, n)
+	for i := range nodes {
+		nodes[i] = makeNode(fmt.Sprintf("node-%05d", i), "4", "16Gi")
+	}
+	return nodes
+}
+
+// evenNodes lets through the nodes with an even suffix after hashing the
+// node name rounds times, standing in for an expensive predicate.
+func evenNodes(rounds int) Predicate {
+	return Predicate{
+		Name: "even_nodes",
+		Func: func(_ *v1.Pod, node *v1.Node) (bool, error) {
+			sum := sha256.Sum256([]byte(node.Name))
+			for r := 1; r < rounds; r++ {
+				sum = sha256.Sum256(sum[:])
+			}
+			i, err := strconv.Atoi(strings.TrimPrefix(node.Name, "node-"))
+			if err != nil {
+				return false, err
+			}
+			return i%2 == 0, nil
+		},
+	}
+}
+
+func TestPredicateHandlerOrder(t *testing.T) {
+	defer withPredicateSettings(8, 0)()
+
+	pod := makePod("p", "", "")
+	nodes := syntheticNodes(1000)
+	result := evenNodes(0).Handler(schedulerapi.ExtenderArgs{Pod: &pod, Nodes: &v1.NodeList{Items: nodes}})
+	if result.Error != "" || len(result.FailedNodes) != 0 {
+		t.Fatalf("unexpected failure: %+v", result)
+	}
+	if len(result.Nodes.Items) != 500 {
+		t.Fatalf("got %d nodes, want 500", len(result.Nodes.Items))
+	}
+	for i, node := range result.Nodes.Items {
+		if want := nodes[2*i].Name; node.Name != want {
+			t.Fatalf("node %d = %s, want %s", i, node.Name, want)
+		}
+	}
+}
+
+func TestPredicateHandlerDeadline(t *testing.T) {
+	defer withPredicateSettings(2, 50*time.Millisecond)()
+
+	blocked := make(chan struct{})
+	defer close(blocked)
+	slow := Predicate{
+		Name: "slow",
+		Func: func(_ *v1.Pod, node *v1.Node) (bool, error) {
+			if node.Name != "node-00000" {
+				<-blocked
+			}
+			return true, nil
+		},
+	}
+
+	pod := makePod("p", "", "")
+	nodes := syntheticNodes(10)
+	start := time.Now()
+	result := slow.Handler(schedulerapi.ExtenderArgs{Pod: &pod, Nodes: &v1.NodeList{Items: nodes}})
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("handler returned after %v", elapsed)
+	}
+	if len(result.Nodes.Items) != 1 || result.Nodes.Items[0].Name != "node-00000" {
+		t.Errorf("got nodes %v, want only node-00000", result.Nodes.Items)
+	}
+	if len(result.FailedNodes) != 9 {
+		t.Errorf("got %d failed nodes, want 9: %v", len(result.FailedNodes), result.FailedNodes)
+	}
+	for name, reason := range result.FailedNodes {
+		if !strings.Contains(reason, "did not evaluate") {
+			t.Errorf("%s: unexpected reason %q", name, reason)
+		}
+	}
+}
+
+// BenchmarkPredicateHandler5kNodes compares sequential and concurrent
+// evaluation for a CPU bound predicate, which gains up to the number of
+// cores, and for a predicate waiting on I/O, like max_pods listing pods.
+func BenchmarkPredicateHandler5kNodes(b *testing.B) {
+	pod := makePod("p", "", "")
+	args := schedulerapi.ExtenderArgs{Pod: &pod, Nodes: &v1.NodeList{Items: syntheticNodes(5000)}}
+	waiting := Predicate{
+		Name: "waiting",
+		Func: func(*v1.Pod, *v1.Node) (bool, error) {
+			time.Sleep(50 * time.Microsecond)
+			return true, nil
+		},
+	}
+
+	for _, p := range []Predicate{evenNodes(200), waiting} {
+		for _, parallelism := range []int{1, 16} {
+			b.Run(fmt.Sprintf("%s/parallelism=%d", p.Name, parallelism), func(b *testing.B) {
+				defer withPredicateSettings(parallelism, 0)()
+				for i := 0; i < b.N; i++ {
+					p.Handler(args)
+				}
+			})
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"time"
+
 	"k8s.io/api/core/v1"
 	schedulerapi "k8s.io/kubernetes/pkg/scheduler/apis/extender/v1"
 )
@@ -11,13 +13,42 @@ type Preemption struct {
 		nodeNameToVictims map[string]*schedulerapi.Victims,
 		nodeNameToMetaVictims map[string]*schedulerapi.MetaVictims,
 	) map[string]*schedulerapi.MetaVictims
+	// Ready, when set, returns an error until the caches read by Func have
+	// synced. Requests fail with a 500 meanwhile.
+	Ready func() error
 }
 
 func (b Preemption) Handler(
 	args schedulerapi.ExtenderPreemptionArgs,
 ) *schedulerapi.ExtenderPreemptionResult {
-	nodeNameToMetaVictims := b.Func(*args.Pod, args.NodeNameToVictims, args.NodeNameToMetaVictims)
+	start := time.Now()
+	defer func() {
+		preemptionDuration.Observe(time.Since(start).Seconds())
+	}()
+
+	// Only a nodeCacheCapable scheduler sends NodeNameToMetaVictims, but the
+	// result is always keyed by MetaVictims.
+	metaVictims := args.NodeNameToMetaVictims
+	if metaVictims == nil {
+		metaVictims = toMetaVictims(args.NodeNameToVictims)
+	}
+	nodeNameToMetaVictims := b.Func(*args.Pod, args.NodeNameToVictims, metaVictims)
 	return &schedulerapi.ExtenderPreemptionResult{
 		NodeNameToMetaVictims: nodeNameToMetaVictims,
 	}
 }
+
+func toMetaVictims(nodeNameToVictims map[string]*schedulerapi.Victims) map[string]*schedulerapi.MetaVictims {
+	nodeNameToMetaVictims := make(map[string]*schedulerapi.MetaVictims, len(nodeNameToVictims))
+	for nodeName, victims := range nodeNameToVictims {
+		metaVictims := &schedulerapi.MetaVictims{
+			Pods:             make([]*schedulerapi.MetaPod, 0, len(victims.Pods)),
+			NumPDBViolations: victims.NumPDBViolations,
+		}
+		for _, pod := range victims.Pods {
+			metaVictims.Pods = append(metaVictims.Pods, &schedulerapi.MetaPod{UID: string(pod.UID)})
+		}
+		nodeNameToMetaVictims[nodeName] = metaVictims
+	}
+	return nodeNameToMetaVictims
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"time"
+
 	"k8s.io/api/core/v1"
 	schedulerapi "k8s.io/kubernetes/pkg/scheduler/apis/extender/v1"
 )
@@ -10,6 +12,36 @@ type Prioritize struct {
 	Func func(pod v1.Pod, nodes []v1.Node) (*schedulerapi.HostPriorityList, error)
 }
 
-func (p Prioritize) Handler(args schedulerapi.ExtenderArgs) (*schedulerapi.HostPriorityList, error) {
-	return p.Func(*args.Pod, args.Nodes.Items)
+func (p Prioritize) Handler(args schedulerapi.ExtenderArgs) (list *schedulerapi.HostPriorityList, err error) {
+	start := time.Now()
+	defer func() {
+		prioritizeDuration.WithLabelValues(p.Name).Observe(time.Since(start).Seconds())
+		if err != nil {
+			prioritizeErrors.WithLabelValues(p.Name).Inc()
+		}
+	}()
+
+	nodes, missing, err := resolveNodes(args)
+	if err != nil {
+		return nil, err
+	}
+	list, err = p.Func(*args.Pod, nodes)
+	if err != nil {
+		return nil, err
+	}
+	// nodes missing from the node cache get the lowest score
+	if len(missing) > 0 {
+		if list == nil {
+			list = &schedulerapi.HostPriorityList{}
+		}
+		for _, name := range *args.NodeNames {
+			if _, ok := missing[name]; ok {
+				*list = append(*list, schedulerapi.HostPriority{
+					Host:  name,
+					Score: schedulerapi.MinExtenderPriority,
+				})
+			}
+		}
+	}
+	return list, nil
 }
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"k8s.io/client-go/kubernetes"
+)
+
+// PredicateFactory builds a Predicate from its configured args. client is nil
+// when the extender runs without access to an API server.
+type PredicateFactory func(args json.RawMessage, client kubernetes.Interface) (Predicate, error)
+
+// PrioritizeFactory builds a Prioritize like PredicateFactory builds a Predicate.
+type PrioritizeFactory func(args json.RawMessage, client kubernetes.Interface) (Prioritize, error)
+
+// PreemptionFactory builds a Preemption like PredicateFactory builds a Predicate.
+type PreemptionFactory func(args json.RawMessage, client kubernetes.Interface) (Preemption, error)
+
+var (
+	predicateFactories  = map[string]PredicateFactory{}
+	prioritizeFactories = map[string]PrioritizeFactory{}
+	preemptionFactories = map[string]PreemptionFactory{}
+)
+
+func init() {
+	RegisterPredicate(TruePredicate.Name, func(json.RawMessage, kubernetes.Interface) (Predicate, error) {
+		return TruePredicate, nil
+	})
+	RegisterPredicate(ResourceFitName, NewResourceFitPredicate)
+	RegisterPredicate(LabelAffinityName, NewLabelAffinityPredicate)
+	RegisterPredicate(MaxPodsName, NewMaxPodsPredicate)
+
+	RegisterPrioritize(ZeroPriority.Name, func(json.RawMessage, kubernetes.Interface) (Prioritize, error) {
+		return ZeroPriority, nil
+	})
+	RegisterPrioritize(LeastAllocatedName, NewLeastAllocatedPrioritize)
+	RegisterPrioritize(MostAllocatedName, NewMostAllocatedPrioritize)
+	RegisterPrioritize(BalancedAllocationName, NewBalancedAllocationPrioritize)
+	RegisterPrioritize(TopologySpreadName, NewTopologySpreadPrioritize)
+
+	RegisterPreemption(EchoPreemptionName, func(json.RawMessage, kubernetes.Interface) (Preemption, error) {
+		return EchoPreemption, nil
+	})
+	RegisterPreemption(VictimSelectionName, NewVictimSelectionPreemption)
+}
+
+// RegisterPredicate makes a predicate available to policy files under name.
+func RegisterPredicate(name string, factory PredicateFactory) {
+	if _, exists := predicateFactories[name]; exists {
+		panic(fmt.Sprintf("predicate %q is already registered", name))
+	}
+	predicateFactories[name] = factory
+}
+
+// RegisterPrioritize makes a priority available to policy files under name.
+func RegisterPrioritize(name string, factory PrioritizeFactory) {
+	if _, exists := prioritizeFactories[name]; exists {
+		panic(fmt.Sprintf("priority %q is already registered", name))
+	}
+	prioritizeFactories[name] = factory
+}
+
+// RegisterPreemption makes a preemption policy available to policy files
+// under name.
+func RegisterPreemption(name string, factory PreemptionFactory) {
+	if _, exists := preemptionFactories[name]; exists {
+		panic(fmt.Sprintf("preemption %q is already registered", name))
+	}
+	preemptionFactories[name] = factory
+}
+
+// BuildPredicates instantiates the predicates enabled in config.
+func BuildPredicates(config *Config, client kubernetes.Interface) ([]Predicate, error) {
+	predicates := make([]Predicate, 0, len(config.Predicates))
+	for _, pc := range config.Predicates {
+		factory, ok := predicateFactories[pc.Name]
+		if !ok {
+			names := make([]string, 0, len(predicateFactories))
+			for name := range predicateFactories {
+				names = append(names, name)
+			}
+			return nil, fmt.Errorf("unknown predicate %q, registered predicates are %v", pc.Name, sortedNames(names))
+		}
+		p, err := factory(pc.Args, client)
+		if err != nil {
+			return nil, fmt.Errorf("predicate %q: %v", pc.Name, err)
+		}
+		predicates = append(predicates, p)
+	}
+	return predicates, nil
+}
+
+// BuildPriorities instantiates the priorities enabled in config together with
+// their weights.
+func BuildPriorities(config *Config, client kubernetes.Interface) ([]WeightedPrioritize, error) {
+	priorities := make([]WeightedPrioritize, 0, len(config.Priorities))
+	for _, pc := range config.Priorities {
+		factory, ok := prioritizeFactories[pc.Name]
+		if !ok {
+			names := make([]string, 0, len(prioritizeFactories))
+			for name := range prioritizeFactories {
+				names = append(names, name)
+			}
+			return nil, fmt.Errorf("unknown priority %q, registered priorities are %v", pc.Name, sortedNames(names))
+		}
+		p, err := factory(pc.Args, client)
+		if err != nil {
+			return nil, fmt.Errorf("priority %q: %v", pc.Name, err)
+		}
+		weight := int64(1)
+		if pc.Weight != nil {
+			weight = *pc.Weight
+		}
+		priorities = append(priorities, WeightedPrioritize{Prioritize: p, Weight: weight})
+	}
+	return priorities, nil
+}
+
+// BuildPreemption instantiates the preemption policy enabled in config. It
+// returns nil when none is enabled.
+func BuildPreemption(config *Config, client kubernetes.Interface) (*Preemption, error) {
+	if config.Preemption == nil {
+		return nil, nil
+	}
+	pc := config.Preemption
+	factory, ok := preemptionFactories[pc.Name]
+	if !ok {
+		names := make([]string, 0, len(preemptionFactories))
+		for name := range preemptionFactories {
+			names = append(names, name)
+		}
+		return nil, fmt.Errorf("unknown preemption %q, registered preemptions are %v", pc.Name, sortedNames(names))
+	}
+	p, err := factory(pc.Args, client)
+	if err != nil {
+		return nil, fmt.Errorf("preemption %q: %v", pc.Name, err)
+	}
+	return &p, nil
+}
+
+func sortedNames(names []string) []string {
+	sort.Strings(names)
+	return names
+}
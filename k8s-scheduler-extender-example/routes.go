@@ -2,144 +2,211 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
+	"runtime/debug"
+	"strconv"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	schedulerapi "k8s.io/kubernetes/pkg/scheduler/apis/extender/v1"
 )
 
-func checkBody(w http.ResponseWriter, r *http.Request) {
+// maxRequestBodyBytes bounds the size of a request body. Full node lists of
+// large clusters are big, so the limit is generous.
+var maxRequestBodyBytes int64 = 64 << 20
+
+// readBody reads the whole request body, answering with the HTTP status to
+// use when it is missing or too large.
+func readBody(r *http.Request) ([]byte, int, error) {
 	if r.Body == nil {
-		http.Error(w, "Please send a request body", 400)
+		return nil, http.StatusBadRequest, fmt.Errorf("Please send a request body")
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxRequestBodyBytes+1))
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	if int64(len(body)) > maxRequestBodyBytes {
+		return nil, http.StatusRequestEntityTooLarge, fmt.Errorf("request body exceeds %d bytes", maxRequestBodyBytes)
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil, http.StatusBadRequest, fmt.Errorf("Please send a request body")
+	}
+	return body, http.StatusOK, nil
+}
+
+// serveJSON decodes the request body into args, calls handle and writes the
+// result it returns as JSON. Bad bodies are answered with 400 (or 413) and
+// panics in handle with 500; errorResult builds the extender result object
+// written in both cases, so that the scheduler always gets a well-formed body.
+func serveJSON(
+	w http.ResponseWriter,
+	r *http.Request,
+	argsName, resultName string,
+	args interface{},
+	handle func() (result interface{}, status int),
+	errorResult func(err error) interface{},
+) {
+	prefix := requestLogPrefix(r)
+	argsName, resultName = prefix+argsName, prefix+resultName
+
+	body, status, err := readBody(r)
+	if err != nil {
+		log.Print("warning: ", argsName, ": ", err)
+		writeJSON(w, resultName, status, errorResult(err))
 		return
 	}
+	log.Print("info: ", argsName, " = ", string(body))
+
+	if err := json.Unmarshal(body, args); err != nil {
+		log.Print("warning: ", argsName, ": ", err)
+		writeJSON(w, resultName, http.StatusBadRequest, errorResult(err))
+		return
+	}
+
+	result, status := recoverHandle(argsName, handle, errorResult)
+	writeJSON(w, resultName, status, result)
 }
 
-func PredicateRoute(predicate Predicate) httprouter.Handle {
-	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-		checkBody(w, r)
+// recoverHandle calls handle, turning a panic into a 500 with errorResult.
+func recoverHandle(
+	name string,
+	handle func() (interface{}, int),
+	errorResult func(error) interface{},
+) (result interface{}, status int) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("error: %s: recovered from panic: %v\n%s", name, r, debug.Stack())
+			result, status = errorResult(fmt.Errorf("extender panicked: %v", r)), http.StatusInternalServerError
+		}
+	}()
+	return handle()
+}
 
-		var buf bytes.Buffer
-		body := io.TeeReader(r.Body, &buf)
-		log.Print("info: ", predicate.Name, " ExtenderArgs = ", buf.String())
+func writeJSON(w http.ResponseWriter, name string, status int, result interface{}) {
+	resultBody, err := json.Marshal(result)
+	if err != nil {
+		log.Print("error: ", name, ": ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Print("info: ", name, " = ", string(resultBody))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(resultBody)
+}
 
-		var extenderArgs schedulerapi.ExtenderArgs
-		var extenderFilterResult *schedulerapi.ExtenderFilterResult
+func validateExtenderArgs(args schedulerapi.ExtenderArgs) error {
+	if args.Pod == nil {
+		return fmt.Errorf("Pod must be set")
+	}
+	if args.Nodes == nil && args.NodeNames == nil {
+		return fmt.Errorf("either Nodes or NodeNames must be set")
+	}
+	return nil
+}
 
-		if err := json.NewDecoder(body).Decode(&extenderArgs); err != nil {
-			extenderFilterResult = &schedulerapi.ExtenderFilterResult{
+func PredicateRoute(predicate Predicate) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		var extenderArgs schedulerapi.ExtenderArgs
+		errorResult := func(err error) interface{} {
+			return &schedulerapi.ExtenderFilterResult{
 				Nodes:       nil,
 				FailedNodes: nil,
 				Error:       err.Error(),
 			}
-		} else {
-			extenderFilterResult = predicate.Handler(extenderArgs)
 		}
 
-		if resultBody, err := json.Marshal(extenderFilterResult); err != nil {
-			panic(err)
-		} else {
-			log.Print("info: ", predicate.Name, " extenderFilterResult = ", string(resultBody))
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			w.Write(resultBody)
-		}
+		serveJSON(w, r, predicate.Name+" ExtenderArgs", predicate.Name+" extenderFilterResult", &extenderArgs,
+			func() (interface{}, int) {
+				if err := validateExtenderArgs(extenderArgs); err != nil {
+					return errorResult(err), http.StatusBadRequest
+				}
+				if predicate.Ready != nil {
+					if err := predicate.Ready(); err != nil {
+						log.Print("error: ", predicate.Name, ": ", err)
+						return errorResult(err), http.StatusInternalServerError
+					}
+				}
+				return predicate.Handler(extenderArgs), http.StatusOK
+			}, errorResult)
 	}
 }
 
 func PrioritizeRoute(prioritize Prioritize) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-		checkBody(w, r)
-
-		var buf bytes.Buffer
-		body := io.TeeReader(r.Body, &buf)
-		log.Print("info: ", prioritize.Name, " ExtenderArgs = ", buf.String())
-
 		var extenderArgs schedulerapi.ExtenderArgs
-		var hostPriorityList *schedulerapi.HostPriorityList
-
-		if err := json.NewDecoder(body).Decode(&extenderArgs); err != nil {
-			panic(err)
-		}
-
-		if list, err := prioritize.Handler(extenderArgs); err != nil {
-			panic(err)
-		} else {
-			hostPriorityList = list
+		// a HostPriorityList cannot carry an error message, the status code
+		// tells the scheduler that prioritizing failed
+		errorResult := func(error) interface{} {
+			return &schedulerapi.HostPriorityList{}
 		}
 
-		if resultBody, err := json.Marshal(hostPriorityList); err != nil {
-			panic(err)
-		} else {
-			log.Print("info: ", prioritize.Name, " hostPriorityList = ", string(resultBody))
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			w.Write(resultBody)
-		}
+		serveJSON(w, r, prioritize.Name+" ExtenderArgs", prioritize.Name+" hostPriorityList", &extenderArgs,
+			func() (interface{}, int) {
+				if err := validateExtenderArgs(extenderArgs); err != nil {
+					log.Print("warning: ", prioritize.Name, ": ", err)
+					return errorResult(err), http.StatusBadRequest
+				}
+				hostPriorityList, err := prioritize.Handler(extenderArgs)
+				if err != nil {
+					log.Print("error: ", prioritize.Name, ": ", err)
+					return errorResult(err), http.StatusInternalServerError
+				}
+				return hostPriorityList, http.StatusOK
+			}, errorResult)
 	}
 }
 
 func BindRoute(bind Bind) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-		checkBody(w, r)
-
-		var buf bytes.Buffer
-		body := io.TeeReader(r.Body, &buf)
-		log.Print("info: extenderBindingArgs = ", buf.String())
-
 		var extenderBindingArgs schedulerapi.ExtenderBindingArgs
-		var extenderBindingResult *schedulerapi.ExtenderBindingResult
-
-		if err := json.NewDecoder(body).Decode(&extenderBindingArgs); err != nil {
-			extenderBindingResult = &schedulerapi.ExtenderBindingResult{
+		errorResult := func(err error) interface{} {
+			return &schedulerapi.ExtenderBindingResult{
 				Error: err.Error(),
 			}
-		} else {
-			extenderBindingResult = bind.Handler(extenderBindingArgs)
 		}
 
-		if resultBody, err := json.Marshal(extenderBindingResult); err != nil {
-			panic(err)
-		} else {
-			log.Print("info: extenderBindingResult = ", string(resultBody))
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			w.Write(resultBody)
-		}
+		serveJSON(w, r, "extenderBindingArgs", "extenderBindingResult", &extenderBindingArgs,
+			func() (interface{}, int) {
+				if extenderBindingArgs.PodName == "" || extenderBindingArgs.Node == "" {
+					return errorResult(fmt.Errorf("PodName and Node must be set")), http.StatusBadRequest
+				}
+				return bind.Handler(extenderBindingArgs), http.StatusOK
+			}, errorResult)
 	}
 }
 
 func PreemptionRoute(preemption Preemption) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-		checkBody(w, r)
-
-		var buf bytes.Buffer
-		body := io.TeeReader(r.Body, &buf)
-		log.Print("info: extenderPreemptionArgs = ", buf.String())
-
 		var extenderPreemptionArgs schedulerapi.ExtenderPreemptionArgs
-		var extenderPreemptionResult *schedulerapi.ExtenderPreemptionResult
-
-		if err := json.NewDecoder(body).Decode(&extenderPreemptionArgs); err != nil {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusBadRequest)
-		} else {
-			extenderPreemptionResult = preemption.Handler(extenderPreemptionArgs)
+		// an ExtenderPreemptionResult cannot carry an error message, the
+		// status code tells the scheduler that preemption failed
+		errorResult := func(error) interface{} {
+			return &schedulerapi.ExtenderPreemptionResult{}
 		}
 
-		if resultBody, err := json.Marshal(extenderPreemptionResult); err != nil {
-			panic(err)
-		} else {
-			log.Print("info: extenderPreemptionResult = ", string(resultBody))
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			w.Write(resultBody)
-		}
+		serveJSON(w, r, "extenderPreemptionArgs", "extenderPreemptionResult", &extenderPreemptionArgs,
+			func() (interface{}, int) {
+				if extenderPreemptionArgs.Pod == nil {
+					log.Print("warning: preemption: Pod must be set")
+					return errorResult(nil), http.StatusBadRequest
+				}
+				if preemption.Ready != nil {
+					if err := preemption.Ready(); err != nil {
+						log.Print("error: preemption: ", err)
+						return errorResult(err), http.StatusInternalServerError
+					}
+				}
+				return preemption.Handler(extenderPreemptionArgs), http.StatusOK
+			}, errorResult)
 	}
 }
 
@@ -151,11 +218,49 @@ func AddVersion(router *httprouter.Router) {
 	router.GET(versionPath, DebugLogging(VersionRoute, versionPath))
 }
 
+func AddMetrics(router *httprouter.Router) {
+	router.Handler(http.MethodGet, metricsPath, promhttp.Handler())
+}
+
+// RequestIDHeader names the header an optional request ID is read from. The
+// ID is echoed in the response and prefixed to the log lines of the request.
+var RequestIDHeader = "X-Request-Id"
+
+type requestIDKey struct{}
+
+func requestLogPrefix(r *http.Request) string {
+	if id, ok := r.Context().Value(requestIDKey{}).(string); ok {
+		return "[" + id + "] "
+	}
+	return ""
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
 func DebugLogging(h httprouter.Handle, path string) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-		log.Print("debug: ", path, " request body = ", r.Body)
-		h(w, r, p)
-		log.Print("debug: ", path, " response=", w)
+		if id := r.Header.Get(RequestIDHeader); id != "" {
+			r = r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id))
+			w.Header().Set(RequestIDHeader, id)
+		}
+		prefix := requestLogPrefix(r)
+		log.Print("debug: ", prefix, path, " request from ", r.RemoteAddr)
+
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		h(recorder, r, p)
+		elapsed := time.Since(start)
+
+		httpRequestDuration.WithLabelValues(path, strconv.Itoa(recorder.status)).Observe(elapsed.Seconds())
+		log.Print("debug: ", prefix, path, " response status = ", recorder.status, ", took ", elapsed)
 	}
 }
 
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	schedulerapi "k8s.io/kubernetes/pkg/scheduler/apis/extender/v1"
+)
+
+var (
+	panickingPredicate = Predicate{
+		Name: "panics",
+		Func: func(*v1.Pod, *v1.Node) (bool, error) { panic("predicate bug") },
+	}
+	panickingPrioritize = Prioritize{
+		Name: "panics",
+		Func: func(v1.Pod, []v1.Node) (*schedulerapi.HostPriorityList, error) { panic("priority bug") },
+	}
+	failingPrioritize = Prioritize{
+		Name: "fails",
+		Func: func(v1.Pod, []v1.Node) (*schedulerapi.HostPriorityList, error) { return nil, fmt.Errorf("boom") },
+	}
+	okBind = Bind{
+		Func: func(string, string, types.UID, string) error { return nil },
+	}
+	panickingPreemption = Preemption{
+		Func: func(v1.Pod, map[string]*schedulerapi.Victims, map[string]*schedulerapi.MetaVictims) map[string]*schedulerapi.MetaVictims {
+			panic("preemption bug")
+		},
+	}
+)
+
+const (
+	validExtenderArgs   = `{"Pod": {"metadata": {"name": "p"}}, "Nodes": {"items": [{"metadata": {"name": "n"}}]}}`
+	validBindingArgs    = `{"PodName": "p", "PodNamespace": "default", "PodUID": "uid", "Node": "n"}`
+	validPreemptionArgs = `{"Pod": {"metadata": {"name": "p"}}, "NodeNameToVictims": {"n": {"Pods": []}}}`
+)
+
+func TestRoutes(t *testing.T) {
+	router := httprouter.New()
+	AddPredicate(router, TruePredicate)
+	AddPredicate(router, panickingPredicate)
+	AddPrioritize(router, ZeroPriority)
+	AddPrioritize(router, failingPrioritize)
+	router.POST(prioritiesPrefix+"/panics", PrioritizeRoute(panickingPrioritize))
+	AddBind(router, okBind)
+	AddPreemption(router, EchoPreemption)
+	router.POST(preemptionPath+"/panics", PreemptionRoute(panickingPreemption))
+
+	oldLimit := maxRequestBodyBytes
+	maxRequestBodyBytes = 1024
+	defer func() { maxRequestBodyBytes = oldLimit }()
+	oversized := `{"Pod": {"metadata": {"name": "` + strings.Repeat("x", 2048) + `"}}}`
+
+	filterResult := func(t *testing.T, body []byte) schedulerapi.ExtenderFilterResult {
+		var result schedulerapi.ExtenderFilterResult
+		if err := json.Unmarshal(body, &result); err != nil {
+			t.Fatalf("malformed response %q: %v", body, err)
+		}
+		return result
+	}
+	wantFilterError := func(t *testing.T, body []byte) {
+		if result := filterResult(t, body); result.Error == "" {
+			t.Errorf("expected an Error in %s", body)
+		}
+	}
+	wantList := func(n int) func(*testing.T, []byte) {
+		return func(t *testing.T, body []byte) {
+			var list schedulerapi.HostPriorityList
+			if err := json.Unmarshal(body, &list); err != nil {
+				t.Fatalf("malformed response %q: %v", body, err)
+			}
+			if len(list) != n {
+				t.Errorf("got %d priorities, want %d", len(list), n)
+			}
+		}
+	}
+	bindingResult := func(wantError bool) func(*testing.T, []byte) {
+		return func(t *testing.T, body []byte) {
+			var result schedulerapi.ExtenderBindingResult
+			if err := json.Unmarshal(body, &result); err != nil {
+				t.Fatalf("malformed response %q: %v", body, err)
+			}
+			if (result.Error != "") != wantError {
+				t.Errorf("unexpected Error %q", result.Error)
+			}
+		}
+	}
+	preemptionResult := func(t *testing.T, body []byte) {
+		var result schedulerapi.ExtenderPreemptionResult
+		if err := json.Unmarshal(body, &result); err != nil {
+			t.Fatalf("malformed response %q: %v", body, err)
+		}
+	}
+
+	predicatePath := predicatesPrefix + "/" + TruePredicate.Name
+	prioritizePath := prioritiesPrefix + "/" + ZeroPriority.Name
+	tests := []struct {
+		name   string
+		path   string
+		body   string
+		status int
+		check  func(*testing.T, []byte)
+	}{
+		{"predicate", predicatePath, validExtenderArgs, http.StatusOK, func(t *testing.T, body []byte) {
+			if result := filterResult(t, body); result.Error != "" || result.Nodes == nil || len(result.Nodes.Items) != 1 {
+				t.Errorf("unexpected result %s", body)
+			}
+		}},
+		{"predicate empty body", predicatePath, "", http.StatusBadRequest, wantFilterError},
+		{"predicate whitespace body", predicatePath, " \n", http.StatusBadRequest, wantFilterError},
+		{"predicate malformed body", predicatePath, "{", http.StatusBadRequest, wantFilterError},
+		{"predicate wrong types", predicatePath, `{"Pod": []}`, http.StatusBadRequest, wantFilterError},
+		{"predicate without pod", predicatePath, `{"Nodes": {"items": []}}`, http.StatusBadRequest, wantFilterError},
+		{"predicate without nodes", predicatePath, `{"Pod": {}}`, http.StatusBadRequest, wantFilterError},
+		{"predicate oversized body", predicatePath, oversized, http.StatusRequestEntityTooLarge, wantFilterError},
+		{"predicate panics", predicatesPrefix + "/panics", validExtenderArgs, http.StatusInternalServerError, wantFilterError},
+
+		{"prioritize", prioritizePath, validExtenderArgs, http.StatusOK, wantList(1)},
+		{"prioritize empty body", prioritizePath, "", http.StatusBadRequest, wantList(0)},
+		{"prioritize malformed body", prioritizePath, "not json", http.StatusBadRequest, wantList(0)},
+		{"prioritize without pod", prioritizePath, `{"Nodes": {"items": []}}`, http.StatusBadRequest, wantList(0)},
+		{"prioritize oversized body", prioritizePath, oversized, http.StatusRequestEntityTooLarge, wantList(0)},
+		{"prioritize fails", prioritiesPrefix + "/fails", validExtenderArgs, http.StatusInternalServerError, wantList(0)},
+		{"prioritize panics", prioritiesPrefix + "/panics", validExtenderArgs, http.StatusInternalServerError, wantList(0)},
+
+		{"bind", bindPath, validBindingArgs, http.StatusOK, bindingResult(false)},
+		{"bind empty body", bindPath, "", http.StatusBadRequest, bindingResult(true)},
+		{"bind malformed body", bindPath, "[", http.StatusBadRequest, bindingResult(true)},
+		{"bind missing node", bindPath, `{"PodName": "p"}`, http.StatusBadRequest, bindingResult(true)},
+		{"bind oversized body", bindPath, oversized, http.StatusRequestEntityTooLarge, bindingResult(true)},
+
+		{"preemption", preemptionPath, validPreemptionArgs, http.StatusOK, preemptionResult},
+		{"preemption empty body", preemptionPath, "", http.StatusBadRequest, preemptionResult},
+		{"preemption malformed body", preemptionPath, "}", http.StatusBadRequest, preemptionResult},
+		{"preemption without pod", preemptionPath, `{}`, http.StatusBadRequest, preemptionResult},
+		{"preemption oversized body", preemptionPath, oversized, http.StatusRequestEntityTooLarge, preemptionResult},
+		{"preemption panics", preemptionPath + "/panics", validPreemptionArgs, http.StatusInternalServerError, preemptionResult},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d (body %s)", rec.Code, tt.status, rec.Body.String())
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type = %q", ct)
+			}
+			tt.check(t, rec.Body.Bytes())
+		})
+	}
+}
+
+func TestMetricsAndRequestID(t *testing.T) {
+	router := httprouter.New()
+	AddMetrics(router)
+	failing := Predicate{
+		Name: "metrics_test",
+		Func: func(_ *v1.Pod, node *v1.Node) (bool, error) {
+			return false, NewPredicateFailure(ReasonTooManyPods, "node %s is full", node.Name)
+		},
+	}
+	AddPredicate(router, failing)
+
+	req := httptest.NewRequest(http.MethodPost, predicatesPrefix+"/metrics_test", strings.NewReader(validExtenderArgs))
+	req.Header.Set(RequestIDHeader, "req-42")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if got := rec.Header().Get(RequestIDHeader); got != "req-42" {
+		t.Errorf("%s = %q, want req-42", RequestIDHeader, got)
+	}
+
+	if got := testutil.ToFloat64(predicateFailures.WithLabelValues("metrics_test", ReasonTooManyPods)); got != 1 {
+		t.Errorf("predicate failures = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(predicateNodes.WithLabelValues("metrics_test", "filtered")); got != 1 {
+		t.Errorf("filtered nodes = %v, want 1", got)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, metricsPath, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	for _, metric := range []string{
+		"scheduler_extender_predicate_duration_seconds",
+		"scheduler_extender_http_request_duration_seconds",
+	} {
+		if !strings.Contains(rec.Body.String(), metric) {
+			t.Errorf("%s missing from /metrics", metric)
+		}
+	}
+}
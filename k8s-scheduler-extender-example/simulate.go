@@ -0,0 +1,383 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	schedulerapi "k8s.io/kubernetes/pkg/scheduler/apis/extender/v1"
+)
+
+// simulatePodCacheSyncTimeout bounds the wait for the pod cache of a
+// simulation, which is backed by an in-memory client and syncs right away.
+const simulatePodCacheSyncTimeout = 10 * time.Second
+
+// SimulationResult is the outcome of running a pod through the configured
+// predicates, priorities and preemption policy.
+type SimulationResult struct {
+	Nodes      []NodeSimulation       `json:"nodes"`
+	Preemption []PreemptionSimulation `json:"preemption,omitempty"`
+}
+
+type NodeSimulation struct {
+	Name string `json:"name"`
+	// FailedPredicate and Reason are set when a predicate filtered the node
+	// out, in which case the node is not scored.
+	FailedPredicate string           `json:"failedPredicate,omitempty"`
+	Reason          string           `json:"reason,omitempty"`
+	Scores          map[string]int64 `json:"scores,omitempty"`
+	WeightedScore   int64            `json:"weightedScore"`
+}
+
+type PreemptionSimulation struct {
+	Node string `json:"node"`
+	// Victims are the namespace/name of the pods proposed for eviction; they
+	// are nil when the policy vetoed the node.
+	Victims []string `json:"victims"`
+	Vetoed  bool     `json:"vetoed"`
+}
+
+// runSimulate implements the simulate command: it reads a pod and a cluster
+// snapshot from files and prints how the configured policy treats the pod.
+func runSimulate(arguments []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("simulate", flag.ContinueOnError)
+	configPath := flags.String("config", "", "Path to the extender policy file (YAML or JSON). The default policy is used when empty.")
+	podPath := flags.String("pod", "", "File containing the pod to schedule.")
+	nodesPath := flags.String("nodes", "", "File containing the candidate nodes, e.g. the output of kubectl get nodes,pods,pdb -A -o yaml. Pods and PodDisruptionBudgets seed the simulated cluster.")
+	output := flags.String("output", "table", "Output format, table or json.")
+	if err := flags.Parse(arguments); err == flag.ErrHelp {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if *podPath == "" || *nodesPath == "" {
+		return fmt.Errorf("--pod and --nodes are required")
+	}
+	if *output != "table" && *output != "json" {
+		return fmt.Errorf("unknown output format %q", *output)
+	}
+
+	config := DefaultConfig()
+	if *configPath != "" {
+		var err error
+		if config, err = LoadConfig(*configPath); err != nil {
+			return fmt.Errorf("failed to load config %s: %v", *configPath, err)
+		}
+	}
+	podObjects, err := readObjects(*podPath)
+	if err != nil {
+		return err
+	}
+	if len(podObjects) != 1 {
+		return fmt.Errorf("%s must contain exactly one pod, found %d objects", *podPath, len(podObjects))
+	}
+	pod, ok := podObjects[0].(*v1.Pod)
+	if !ok {
+		return fmt.Errorf("%s does not contain a pod", *podPath)
+	}
+	objects, err := readObjects(*nodesPath)
+	if err != nil {
+		return err
+	}
+
+	result, err := Simulate(config, pod, objects)
+	if err != nil {
+		return err
+	}
+	if *output == "json" {
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(result)
+	}
+	return result.WriteTable(stdout, config)
+}
+
+// Simulate runs pod through the policy of config against the nodes among
+// objects. The remaining objects, such as pods and PodDisruptionBudgets, back
+// the Kubernetes client handed to the predicates, priorities and preemption
+// policy. Predicates are applied in order, like extenders chained in the
+// scheduler, and only the nodes passing all of them are scored.
+func Simulate(config *Config, pod *v1.Pod, objects []runtime.Object) (*SimulationResult, error) {
+	var nodes []v1.Node
+	var pods []*v1.Pod
+	clusterObjects := make([]runtime.Object, 0, len(objects))
+	for _, obj := range objects {
+		switch o := obj.(type) {
+		case *v1.Node:
+			nodes = append(nodes, *o)
+			continue
+		case *v1.Pod:
+			// victims are identified by UID, hand written snapshots may lack one
+			if o.UID == "" {
+				o.UID = types.UID(o.Namespace + "/" + o.Name)
+			}
+			pods = append(pods, o)
+		}
+		clusterObjects = append(clusterObjects, obj)
+	}
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("no nodes to schedule on")
+	}
+	client := fake.NewSimpleClientset(clusterObjects...)
+
+	predicates, err := BuildPredicates(config, client)
+	if err != nil {
+		return nil, err
+	}
+	priorities, err := BuildPriorities(config, client)
+	if err != nil {
+		return nil, err
+	}
+	preemption, err := BuildPreemption(config, client)
+	if err != nil {
+		return nil, err
+	}
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	if err := StartPodCache(client, stopCh, simulatePodCacheSyncTimeout); err != nil {
+		return nil, err
+	}
+
+	result := &SimulationResult{}
+	byName := make(map[string]*NodeSimulation, len(nodes))
+	for _, node := range nodes {
+		result.Nodes = append(result.Nodes, NodeSimulation{Name: node.Name})
+	}
+	for i := range result.Nodes {
+		byName[result.Nodes[i].Name] = &result.Nodes[i]
+	}
+
+	feasible := nodes
+	for _, p := range predicates {
+		filterResult := p.Handler(schedulerapi.ExtenderArgs{Pod: pod, Nodes: &v1.NodeList{Items: feasible}})
+		if filterResult.Error != "" {
+			return nil, fmt.Errorf("predicate %s: %s", p.Name, filterResult.Error)
+		}
+		passed := make(map[string]bool, len(filterResult.Nodes.Items))
+		for _, node := range filterResult.Nodes.Items {
+			passed[node.Name] = true
+		}
+		for _, node := range feasible {
+			if passed[node.Name] {
+				continue
+			}
+			byName[node.Name].FailedPredicate = p.Name
+			if reason, ok := filterResult.FailedNodes[node.Name]; ok {
+				byName[node.Name].Reason = reason
+			} else {
+				byName[node.Name].Reason = "filtered"
+			}
+		}
+		feasible = filterResult.Nodes.Items
+	}
+
+	if len(feasible) > 0 && len(priorities) > 0 {
+		args := schedulerapi.ExtenderArgs{Pod: pod, Nodes: &v1.NodeList{Items: feasible}}
+		for _, p := range priorities {
+			list, err := p.Handler(args)
+			if err != nil {
+				return nil, fmt.Errorf("priority %s: %v", p.Name, err)
+			}
+			for _, hp := range *list {
+				node := byName[hp.Host]
+				if node.Scores == nil {
+					node.Scores = make(map[string]int64, len(priorities))
+				}
+				node.Scores[p.Name] = hp.Score
+			}
+		}
+		list, err := NewWeightedPrioritize(priorities).Handler(args)
+		if err != nil {
+			return nil, err
+		}
+		for _, hp := range *list {
+			byName[hp.Host].WeightedScore = hp.Score
+		}
+	}
+
+	// feasible nodes by descending score, then the filtered ones
+	sort.SliceStable(result.Nodes, func(i, j int) bool {
+		a, b := result.Nodes[i], result.Nodes[j]
+		if (a.FailedPredicate == "") != (b.FailedPredicate == "") {
+			return a.FailedPredicate == ""
+		}
+		if a.WeightedScore != b.WeightedScore {
+			return a.WeightedScore > b.WeightedScore
+		}
+		return a.Name < b.Name
+	})
+
+	if preemption != nil {
+		result.Preemption = simulatePreemption(*preemption, pod, nodes, pods)
+	}
+	return result, nil
+}
+
+// simulatePreemption proposes all pods of lower priority than pod as victims
+// on each node, where the scheduler would propose the smallest sufficient
+// set, and reports what the preemption policy keeps.
+func simulatePreemption(preemption Preemption, pod *v1.Pod, nodes []v1.Node, pods []*v1.Pod) []PreemptionSimulation {
+	nodeNameToVictims := make(map[string]*schedulerapi.Victims)
+	names := make(map[string]string, len(pods))
+	for _, p := range pods {
+		names[string(p.UID)] = p.Namespace + "/" + p.Name
+		if p.Spec.NodeName == "" || podPriority(p) >= podPriority(pod) {
+			continue
+		}
+		victims, ok := nodeNameToVictims[p.Spec.NodeName]
+		if !ok {
+			victims = &schedulerapi.Victims{}
+			nodeNameToVictims[p.Spec.NodeName] = victims
+		}
+		victims.Pods = append(victims.Pods, p)
+	}
+
+	result := preemption.Handler(schedulerapi.ExtenderPreemptionArgs{Pod: pod, NodeNameToVictims: nodeNameToVictims})
+	var simulations []PreemptionSimulation
+	for _, node := range nodes {
+		if _, ok := nodeNameToVictims[node.Name]; !ok {
+			continue
+		}
+		simulation := PreemptionSimulation{Node: node.Name, Vetoed: true}
+		if metaVictims, ok := result.NodeNameToMetaVictims[node.Name]; ok {
+			simulation.Vetoed = false
+			simulation.Victims = make([]string, 0, len(metaVictims.Pods))
+			for _, metaPod := range metaVictims.Pods {
+				simulation.Victims = append(simulation.Victims, names[metaPod.UID])
+			}
+			sort.Strings(simulation.Victims)
+		}
+		simulations = append(simulations, simulation)
+	}
+	return simulations
+}
+
+func podPriority(pod *v1.Pod) int32 {
+	if pod.Spec.Priority != nil {
+		return *pod.Spec.Priority
+	}
+	return 0
+}
+
+// WriteTable prints the nodes with one score column per priority of config,
+// followed by the preemption outcome when a policy is configured.
+func (r *SimulationResult) WriteTable(w io.Writer, config *Config) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	header := []string{"NODE", "RESULT", "REASON"}
+	for _, pc := range config.Priorities {
+		header = append(header, strings.ToUpper(pc.Name))
+	}
+	if len(config.Priorities) > 0 {
+		header = append(header, "WEIGHTED")
+	}
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, node := range r.Nodes {
+		row := []string{node.Name, "feasible", "-"}
+		if node.FailedPredicate != "" {
+			row = []string{node.Name, "filtered by " + node.FailedPredicate, node.Reason}
+		}
+		for _, pc := range config.Priorities {
+			if score, ok := node.Scores[pc.Name]; ok {
+				row = append(row, fmt.Sprint(score))
+			} else {
+				row = append(row, "-")
+			}
+		}
+		if len(config.Priorities) > 0 {
+			if node.FailedPredicate == "" {
+				row = append(row, fmt.Sprint(node.WeightedScore))
+			} else {
+				row = append(row, "-")
+			}
+		}
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if len(r.Preemption) == 0 {
+		return nil
+	}
+	fmt.Fprintln(w)
+	tw = tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "NODE\tPREEMPTION\tVICTIMS")
+	for _, p := range r.Preemption {
+		if p.Vetoed {
+			fmt.Fprintf(tw, "%s\tvetoed\t-\n", p.Node)
+		} else {
+			fmt.Fprintf(tw, "%s\tcandidate\t%s\n", p.Node, strings.Join(p.Victims, ","))
+		}
+	}
+	return tw.Flush()
+}
+
+// readObjects decodes all Kubernetes objects of a YAML or JSON file,
+// including multi-document YAML and the items of lists.
+func readObjects(path string) ([]runtime.Object, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var objects []runtime.Object
+	decoder := utilyaml.NewYAMLOrJSONDecoder(f, 4096)
+	for {
+		var raw runtime.RawExtension
+		if err := decoder.Decode(&raw); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		if len(raw.Raw) == 0 || string(raw.Raw) == "null" {
+			continue
+		}
+		decoded, err := decodeObjects(raw.Raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		objects = append(objects, decoded...)
+	}
+	return objects, nil
+}
+
+func decodeObjects(data []byte) ([]runtime.Object, error) {
+	obj, _, err := scheme.Codecs.UniversalDeserializer().Decode(data, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if !meta.IsListType(obj) {
+		return []runtime.Object{obj}, nil
+	}
+	items, err := meta.ExtractList(obj)
+	if err != nil {
+		return nil, err
+	}
+	var objects []runtime.Object
+	for _, item := range items {
+		if unknown, ok := item.(*runtime.Unknown); ok {
+			decoded, err := decodeObjects(unknown.Raw)
+			if err != nil {
+				return nil, err
+			}
+			objects = append(objects, decoded...)
+			continue
+		}
+		objects = append(objects, item)
+	}
+	return objects, nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSimulate(t *testing.T) {
+	var out bytes.Buffer
+	err := runSimulate([]string{
+		"--config", "extender-config.yaml",
+		"--pod", "testdata/simulate/pod.yaml",
+		"--nodes", "testdata/simulate/cluster.yaml",
+		"--output", "json",
+	}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result SimulationResult
+	if err := json.Unmarshal(out.Bytes(), &result); err != nil {
+		t.Fatalf("malformed output %q: %v", out.String(), err)
+	}
+
+	var order, failed []string
+	for _, node := range result.Nodes {
+		order = append(order, node.Name)
+		if node.FailedPredicate != "" {
+			failed = append(failed, node.Name+":"+node.FailedPredicate)
+			if len(node.Scores) != 0 {
+				t.Errorf("filtered node %s was scored: %v", node.Name, node.Scores)
+			}
+		} else if len(node.Scores) != 3 {
+			t.Errorf("node %s has scores %v, want one per priority", node.Name, node.Scores)
+		}
+	}
+	if want := []string{"node-a", "node-b", "node-c", "node-d"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("node order = %v, want %v", order, want)
+	}
+	if want := []string{"node-c:label_affinity", "node-d:resource_fit"}; !reflect.DeepEqual(failed, want) {
+		t.Errorf("filtered nodes = %v, want %v", failed, want)
+	}
+	if result.Nodes[0].WeightedScore <= result.Nodes[1].WeightedScore {
+		t.Errorf("node-a scored %d, not above node-b with %d", result.Nodes[0].WeightedScore, result.Nodes[1].WeightedScore)
+	}
+
+	wantPreemption := []PreemptionSimulation{
+		{Node: "node-a", Vetoed: true},
+		{Node: "node-b", Victims: []string{"default/batch"}},
+	}
+	if !reflect.DeepEqual(result.Preemption, wantPreemption) {
+		t.Errorf("preemption = %+v, want %+v", result.Preemption, wantPreemption)
+	}
+}
+
+func TestSimulateTable(t *testing.T) {
+	var out bytes.Buffer
+	err := runSimulate([]string{
+		"--pod", "testdata/simulate/pod.yaml",
+		"--nodes", "testdata/simulate/cluster.yaml",
+	}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if fields := strings.Fields(lines[0]); !reflect.DeepEqual(fields, []string{"NODE", "RESULT", "REASON", "ZERO_SCORE", "WEIGHTED"}) {
+		t.Errorf("unexpected header %q", lines[0])
+	}
+	if !strings.Contains(out.String(), "PREEMPTION") {
+		t.Errorf("missing the preemption table:\n%s", out.String())
+	}
+}
+
+func TestSimulateErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"missing nodes", []string{"--pod", "testdata/simulate/pod.yaml"}},
+		{"pod is not a pod", []string{"--pod", "testdata/simulate/cluster.yaml", "--nodes", "testdata/simulate/cluster.yaml"}},
+		{"no nodes", []string{"--pod", "testdata/simulate/pod.yaml", "--nodes", "testdata/simulate/pod.yaml"}},
+		{"bad output", []string{"--pod", "testdata/simulate/pod.yaml", "--nodes", "testdata/simulate/cluster.yaml", "--output", "xml"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := runSimulate(tt.args, &bytes.Buffer{}); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// certReloader holds the serving certificate and the optional client CA
+// bundle read from disk, and re-reads them when the files change so that
+// rotated certificates are picked up without a restart.
+type certReloader struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	modTimes  map[string]time.Time
+}
+
+// newCertReloader loads the certificate and key, and the client CA bundle
+// when clientCAFile is not empty.
+func newCertReloader(certFile, keyFile, clientCAFile string) (*certReloader, error) {
+	c := &certReloader{
+		certFile:     certFile,
+		keyFile:      keyFile,
+		clientCAFile: clientCAFile,
+	}
+	if _, err := c.reloadIfChanged(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *certReloader) files() []string {
+	files := []string{c.certFile, c.keyFile}
+	if c.clientCAFile != "" {
+		files = append(files, c.clientCAFile)
+	}
+	return files
+}
+
+// reloadIfChanged reloads all files when any of them changed since the last
+// load. A failed reload keeps serving the previous certificates.
+func (c *certReloader) reloadIfChanged() (bool, error) {
+	modTimes := make(map[string]time.Time)
+	changed := c.modTimes == nil
+	for _, file := range c.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return false, err
+		}
+		modTimes[file] = info.ModTime()
+		if !info.ModTime().Equal(c.modTimes[file]) {
+			changed = true
+		}
+	}
+	if !changed {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return false, err
+	}
+	var clientCAs *x509.CertPool
+	if c.clientCAFile != "" {
+		pem, err := ioutil.ReadFile(c.clientCAFile)
+		if err != nil {
+			return false, err
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return false, fmt.Errorf("no certificates found in %s", c.clientCAFile)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cert = &cert
+	c.clientCAs = clientCAs
+	c.modTimes = modTimes
+	return true, nil
+}
+
+// Run checks the files for changes every interval until stopCh is closed.
+func (c *certReloader) Run(interval time.Duration, stopCh <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			if reloaded, err := c.reloadIfChanged(); err != nil {
+				log.Print("warning: failed to reload certificates, keeping the previous ones: ", err)
+			} else if reloaded {
+				log.Print("info: reloaded certificates from ", c.certFile)
+			}
+		}
+	}
+}
+
+// TLSConfig returns a server configuration that always uses the latest
+// certificates. Client certificates signed by the client CA bundle are
+// required when one was configured.
+func (c *certReloader) TLSConfig() *tls.Config {
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// http.Server only adds these to its own copy of the configuration,
+		// which the per-connection configuration below is not cloned from
+		NextProtos: []string{"h2", "http/1.1"},
+		// GetCertificate is only consulted by http.Server.ServeTLS to accept
+		// a configuration without certificate files.
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			c.mu.RLock()
+			defer c.mu.RUnlock()
+			return c.cert, nil
+		},
+	}
+	config.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+		clientConfig := config.Clone()
+		clientConfig.GetConfigForClient = nil
+		clientConfig.Certificates = []tls.Certificate{*c.cert}
+		if c.clientCAs != nil {
+			clientConfig.ClientCAs = c.clientCAs
+			clientConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+		return clientConfig, nil
+	}
+	return config
+}
@@ -2,6 +2,14 @@ package v1
 
 import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const (
+	// ConditionTypeReady is True when the desired number of Pods are ready.
+	ConditionTypeReady = "Ready"
+	// ConditionTypeRolloutComplete is True when all Pods run the current spec and are ready.
+	ConditionTypeRolloutComplete = "RolloutComplete"
 )
 
 // PodCondition describes the state of a PodManager at a certain point.
@@ -25,6 +33,21 @@ type PodManagerSpec struct {
 
 	// Image is the container image to use for Pods.
 	Image string `json:"image"`
+
+	// MaxUnavailable is the maximum number of Pods that can be unavailable while
+	// outdated Pods are replaced. Value can be an absolute number (ex: 1) or a
+	// percentage of Replicas (ex: 25%), rounded down.
+	// +kubebuilder:default="25%"
+	// +optional
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+
+	// MaxSurge is the maximum number of Pods that can be created above Replicas
+	// while outdated Pods are replaced. Value can be an absolute number (ex: 1) or
+	// a percentage of Replicas (ex: 25%), rounded up. MaxUnavailable and MaxSurge
+	// cannot both be zero.
+	// +kubebuilder:default="25%"
+	// +optional
+	MaxSurge *intstr.IntOrString `json:"maxSurge,omitempty"`
 }
 
 // PodManagerStatus defines the observed state of PodManager
@@ -35,6 +58,9 @@ type PodManagerStatus struct {
 	// CurrentReplicas is the total number of Pods.
 	CurrentReplicas int32 `json:"currentReplicas"`
 
+	// UpdatedReplicas is the number of Pods that run the current spec.
+	UpdatedReplicas int32 `json:"updatedReplicas"`
+
 	// Conditions represent the latest available observations of PodManager's state.
 	// +optional
 	Conditions []PodCondition `json:"conditions,omitempty"`
@@ -66,19 +92,31 @@ func init() {
 	SchemeBuilder.Register(&PodManager{}, &PodManagerList{})
 }
 
-// SetCondition sets a condition on the PodManager status.
+// SetCondition sets a condition on the PodManager status. LastTransitionTime
+// is kept when the status of an existing condition does not change.
 func (m *PodManagerStatus) SetCondition(cond PodCondition) {
 	for i, c := range m.Conditions {
 		if c.Type == cond.Type {
-			if c.Status != cond.Status {
-				m.Conditions[i] = cond
+			if c.Status == cond.Status {
+				cond.LastTransitionTime = c.LastTransitionTime
 			}
+			m.Conditions[i] = cond
 			return
 		}
 	}
 	m.Conditions = append(m.Conditions, cond)
 }
 
+// GetCondition returns the condition with the given type, or nil if it is not set.
+func (m *PodManagerStatus) GetCondition(condType string) *PodCondition {
+	for i := range m.Conditions {
+		if m.Conditions[i].Type == condType {
+			return &m.Conditions[i]
+		}
+	}
+	return nil
+}
+
 // RemoveCondition removes a condition from the PodManager status.
 func (m *PodManagerStatus) RemoveCondition(condType string) {
 	for i, c := range m.Conditions {
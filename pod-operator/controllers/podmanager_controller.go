@@ -72,67 +72,108 @@ func (r *PodManagerReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return ctrl.Result{}, err
 	}
 
-	// 5. Adjust Pod count
+	// 5. Roll out the current spec and adjust Pod count
 	desiredReplicas := podManager.Spec.Replicas
-	currentReplicas := int32(len(podList.Items))
-
-	if currentReplicas < desiredReplicas {
-		// Create Pods
-		for i := currentReplicas; i < desiredReplicas; i++ {
-			pod := newPodForPodManager(podManager, i)
-			if err := r.Create(ctx, pod); err != nil {
-				log.Error(err, "Failed to create Pod", "pod", pod.Name)
-				r.Recorder.Eventf(podManager, corev1.EventTypeWarning, "Failed", "Failed to create pod %s: %v", pod.Name, err)
-				return ctrl.Result{}, err
+	hash := specHash(podManager)
+	maxSurge, maxUnavailable, err := rollingUpdateLimits(podManager)
+	if err != nil {
+		log.Error(err, "Invalid rolling update settings")
+		r.Recorder.Eventf(podManager, corev1.EventTypeWarning, "InvalidSpec", "Invalid rolling update settings: %v", err)
+		return ctrl.Result{}, err
+	}
+	updated, outdated := splitPods(podList.Items, hash)
+	updated, outdated, err = r.adoptPods(ctx, podManager, hash, updated, outdated)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Create updated Pods. While outdated Pods remain, the total may exceed
+	// the desired count by at most maxSurge.
+	toCreate := desiredReplicas - int32(len(updated))
+	if len(outdated) > 0 {
+		toCreate = min(toCreate, desiredReplicas+maxSurge-int32(len(updated)+len(outdated)))
+	}
+	for i := int32(0); i < toCreate; i++ {
+		pod := newPodForPodManager(podManager, nextPodName(podManager, hash, updated), hash)
+		if err := r.Create(ctx, pod); err != nil {
+			if errors.IsAlreadyExists(err) {
+				// The cache has not seen the Pod created by an earlier reconcile yet
+				return ctrl.Result{Requeue: true}, nil
 			}
-			r.Recorder.Eventf(podManager, corev1.EventTypeNormal, "Created", "Created pod %s", pod.Name)
+			log.Error(err, "Failed to create Pod", "pod", pod.Name)
+			r.Recorder.Eventf(podManager, corev1.EventTypeWarning, "Failed", "Failed to create pod %s: %v", pod.Name, err)
+			return ctrl.Result{}, err
 		}
-	} else if currentReplicas > desiredReplicas {
-		// Delete extra Pods
-		for i := desiredReplicas; i < currentReplicas; i++ {
-			if err := r.Delete(ctx, &podList.Items[i]); err != nil {
-				log.Error(err, "Failed to delete Pod", "pod", podList.Items[i].Name)
-				r.Recorder.Eventf(podManager, corev1.EventTypeWarning, "Failed", "Failed to delete pod %s: %v", podList.Items[i].Name, err)
-				return ctrl.Result{}, err
-			}
-			r.Recorder.Eventf(podManager, corev1.EventTypeNormal, "Deleted", "Deleted pod %s", podList.Items[i].Name)
+		r.Recorder.Eventf(podManager, corev1.EventTypeNormal, "Created", "Created pod %s", pod.Name)
+		updated = append(updated, *pod)
+	}
+
+	// Delete extra updated Pods, the ones not ready first
+	if extra := int32(len(updated)) - desiredReplicas; extra > 0 {
+		sortForDeletion(updated)
+		if err := r.deletePods(ctx, podManager, updated[:extra], "Deleted pod %s"); err != nil {
+			return ctrl.Result{}, err
 		}
+		updated = updated[extra:]
 	}
 
-	// 6. Update Status
-	readyCount := int32(0)
-	for _, pod := range podList.Items {
-		if pod.Status.Phase == corev1.PodRunning {
-			// Check if Pod is ready
-			for _, cond := range pod.Status.Conditions {
-				if cond.Type == corev1.PodReady && cond.Status == corev1.ConditionTrue {
-					readyCount++
-					break
-				}
-			}
+	// Delete outdated Pods in batches, keeping at least desiredReplicas-maxUnavailable
+	// Pods ready. Outdated Pods that are not ready go first.
+	if toDelete := min(int32(len(outdated)), maxScaledDown(desiredReplicas, maxUnavailable, updated, outdated)); toDelete > 0 {
+		sortForDeletion(outdated)
+		if err := r.deletePods(ctx, podManager, outdated[:toDelete], "Deleted outdated pod %s"); err != nil {
+			return ctrl.Result{}, err
 		}
+		outdated = outdated[toDelete:]
 	}
 
+	// 6. Update Status
+	readyCount := countReady(updated) + countReady(outdated)
+	updatedReady := countReady(updated)
+
 	podManager.Status.ReadyReplicas = readyCount
-	podManager.Status.CurrentReplicas = currentReplicas
+	podManager.Status.CurrentReplicas = int32(len(updated) + len(outdated))
+	podManager.Status.UpdatedReplicas = int32(len(updated))
 
-	// Update condition
-	if readyCount == desiredReplicas && desiredReplicas > 0 {
+	// Update conditions
+	now := metav1.Now()
+	if readyCount >= desiredReplicas {
 		podManager.Status.SetCondition(appsv1.PodCondition{
-			Type:               "Ready",
+			Type:               appsv1.ConditionTypeReady,
 			Status:             "True",
-			LastTransitionTime: podManager.Status.Conditions[0].LastTransitionTime,
+			LastTransitionTime: now,
 			Message:            "All Pods are ready",
 		})
 	} else {
 		podManager.Status.SetCondition(appsv1.PodCondition{
-			Type:               "Ready",
+			Type:               appsv1.ConditionTypeReady,
 			Status:             "False",
-			LastTransitionTime: podManager.Status.Conditions[0].LastTransitionTime,
+			LastTransitionTime: now,
 			Message:            fmt.Sprintf("%d/%d Pods are ready", readyCount, desiredReplicas),
 		})
 	}
 
+	rolloutWasComplete := isConditionTrue(podManager.Status.GetCondition(appsv1.ConditionTypeRolloutComplete))
+	if len(outdated) == 0 && int32(len(updated)) == desiredReplicas && updatedReady == desiredReplicas {
+		podManager.Status.SetCondition(appsv1.PodCondition{
+			Type:               appsv1.ConditionTypeRolloutComplete,
+			Status:             "True",
+			LastTransitionTime: now,
+			Message:            "All Pods run the current spec and are ready",
+		})
+		if !rolloutWasComplete {
+			r.Recorder.Eventf(podManager, corev1.EventTypeNormal, "RolloutComplete", "All %d pods run image %s", desiredReplicas, podManager.Spec.Image)
+		}
+	} else {
+		podManager.Status.SetCondition(appsv1.PodCondition{
+			Type:               appsv1.ConditionTypeRolloutComplete,
+			Status:             "False",
+			LastTransitionTime: now,
+			Message: fmt.Sprintf("%d/%d Pods are updated and ready, %d outdated Pods remain",
+				updatedReady, desiredReplicas, len(outdated)),
+		})
+	}
+
 	if err := r.Status().Update(ctx, podManager); err != nil {
 		log.Error(err, "Failed to update PodManager status")
 		return ctrl.Result{}, err
@@ -142,6 +183,53 @@ func (r *PodManagerReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	return ctrl.Result{RequeueAfter: time.Second * 30}, nil
 }
 
+// adoptPods labels Pods created before the spec hash was recorded whose spec is
+// still current, so that upgrading the operator does not replace them
+func (r *PodManagerReconciler) adoptPods(ctx context.Context, podManager *appsv1.PodManager, hash string, updated, outdated []corev1.Pod) ([]corev1.Pod, []corev1.Pod, error) {
+	log := log.FromContext(ctx)
+
+	spec := podSpecForPodManager(podManager)
+	var remaining []corev1.Pod
+	for i := range outdated {
+		pod := &outdated[i]
+		if _, ok := pod.Labels[specHashLabel]; ok || !podSpecMatches(pod, spec) {
+			remaining = append(remaining, *pod)
+			continue
+		}
+
+		patch := client.MergeFrom(pod.DeepCopy())
+		pod.Labels[specHashLabel] = hash
+		if err := r.Patch(ctx, pod, patch); err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			log.Error(err, "Failed to label Pod", "pod", pod.Name)
+			return nil, nil, err
+		}
+		log.Info("Adopted Pod running the current spec", "pod", pod.Name)
+		updated = append(updated, *pod)
+	}
+	return updated, remaining, nil
+}
+
+// deletePods deletes Pods owned by the PodManager and records an Event for each
+func (r *PodManagerReconciler) deletePods(ctx context.Context, podManager *appsv1.PodManager, pods []corev1.Pod, message string) error {
+	log := log.FromContext(ctx)
+
+	for i := range pods {
+		if err := r.Delete(ctx, &pods[i]); err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			log.Error(err, "Failed to delete Pod", "pod", pods[i].Name)
+			r.Recorder.Eventf(podManager, corev1.EventTypeWarning, "Failed", "Failed to delete pod %s: %v", pods[i].Name, err)
+			return err
+		}
+		r.Recorder.Eventf(podManager, corev1.EventTypeNormal, "Deleted", message, pods[i].Name)
+	}
+	return nil
+}
+
 // handleFinalizer handles the finalizer when the PodManager is being deleted
 func (r *PodManagerReconciler) handleFinalizer(ctx context.Context, podManager *appsv1.PodManager) (ctrl.Result, error) {
 	log := log.FromContext(ctx)
@@ -191,34 +279,46 @@ func (r *PodManagerReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		Complete(r)
 }
 
-// newPodForPodManager returns a new Pod for a PodManager
-func newPodForPodManager(podManager *appsv1.PodManager, index int32) *corev1.Pod {
+// newPodForPodManager returns a new Pod for a PodManager, labeled with the hash of its spec
+func newPodForPodManager(podManager *appsv1.PodManager, name, hash string) *corev1.Pod {
+	labels := ownerLabels(podManager)
+	labels[specHashLabel] = hash
 	return &corev1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      fmt.Sprintf("%s-%d", podManager.Name, index),
+			Name:      name,
 			Namespace: podManager.Namespace,
-			Labels:    ownerLabels(podManager),
+			Labels:    labels,
 			OwnerReferences: []metav1.OwnerReference{
 				*metav1.NewControllerRef(podManager, appsv1.GroupVersion.WithKind("PodManager")),
 			},
 		},
-		Spec: corev1.PodSpec{
-			Containers: []corev1.Container{
-				{
-					Name:  "app",
-					Image: podManager.Spec.Image,
-					Ports: []corev1.ContainerPort{
-						{
-							ContainerPort: 80,
-						},
+		Spec: podSpecForPodManager(podManager),
+	}
+}
+
+// podSpecForPodManager returns the Pod spec generated from a PodManager spec
+func podSpecForPodManager(podManager *appsv1.PodManager) corev1.PodSpec {
+	return corev1.PodSpec{
+		Containers: []corev1.Container{
+			{
+				Name:  "app",
+				Image: podManager.Spec.Image,
+				Ports: []corev1.ContainerPort{
+					{
+						ContainerPort: 80,
 					},
 				},
 			},
-			RestartPolicy: corev1.RestartPolicyAlways,
 		},
+		RestartPolicy: corev1.RestartPolicyAlways,
 	}
 }
 
+// isConditionTrue reports whether a condition is set and True
+func isConditionTrue(cond *appsv1.PodCondition) bool {
+	return cond != nil && cond.Status == "True"
+}
+
 // ownerLabels returns the labels used to identify Pods owned by a PodManager
 func ownerLabels(podManager *appsv1.PodManager) map[string]string {
 	return map[string]string{
@@ -0,0 +1,290 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	appsv1 "github.com/ashwinyue/kubernetes-examples/pod-operator/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// testEnv wraps a reconciler backed by a fake client
+type testEnv struct {
+	t        *testing.T
+	client   client.Client
+	recorder *record.FakeRecorder
+	r        *PodManagerReconciler
+	key      types.NamespacedName
+}
+
+func newTestEnv(t *testing.T, podManager *appsv1.PodManager, objs ...client.Object) *testEnv {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := appsv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	c := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(append(objs, podManager)...).
+		WithStatusSubresource(&appsv1.PodManager{}, &corev1.Pod{}).
+		Build()
+	recorder := record.NewFakeRecorder(1000)
+	return &testEnv{
+		t:        t,
+		client:   c,
+		recorder: recorder,
+		r:        &PodManagerReconciler{Client: c, Scheme: scheme, Recorder: recorder},
+		key:      client.ObjectKeyFromObject(podManager),
+	}
+}
+
+func (e *testEnv) reconcile() {
+	e.t.Helper()
+	if _, err := e.r.Reconcile(context.Background(), ctrl.Request{NamespacedName: e.key}); err != nil {
+		e.t.Fatalf("Reconcile() error = %v", err)
+	}
+}
+
+func (e *testEnv) podManager() *appsv1.PodManager {
+	e.t.Helper()
+	pm := &appsv1.PodManager{}
+	if err := e.client.Get(context.Background(), e.key, pm); err != nil {
+		e.t.Fatal(err)
+	}
+	return pm
+}
+
+func (e *testEnv) pods() []corev1.Pod {
+	e.t.Helper()
+	podList := &corev1.PodList{}
+	if err := e.client.List(context.Background(), podList, client.InNamespace(e.key.Namespace)); err != nil {
+		e.t.Fatal(err)
+	}
+	return podList.Items
+}
+
+// markReady makes all Pods running and ready, as the kubelet would
+func (e *testEnv) markReady() {
+	e.t.Helper()
+	for _, pod := range e.pods() {
+		if isPodReady(&pod) {
+			continue
+		}
+		pod.Status.Phase = corev1.PodRunning
+		pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+		if err := e.client.Status().Update(context.Background(), &pod); err != nil {
+			e.t.Fatal(err)
+		}
+	}
+}
+
+func (e *testEnv) setImage(image string) {
+	e.t.Helper()
+	pm := e.podManager()
+	pm.Spec.Image = image
+	if err := e.client.Update(context.Background(), pm); err != nil {
+		e.t.Fatal(err)
+	}
+}
+
+// rollOut creates the initial Pods and makes them ready
+func (e *testEnv) rollOut() {
+	e.t.Helper()
+	// The first reconcile adds the finalizer
+	e.reconcile()
+	e.reconcile()
+	e.markReady()
+	e.reconcile()
+}
+
+func (e *testEnv) events() string {
+	var events []string
+	for len(e.recorder.Events) > 0 {
+		events = append(events, <-e.recorder.Events)
+	}
+	return strings.Join(events, "\n")
+}
+
+func countImage(pods []corev1.Pod, image string) int {
+	count := 0
+	for _, pod := range pods {
+		if pod.Spec.Containers[0].Image == image {
+			count++
+		}
+	}
+	return count
+}
+
+func TestReconcileRollingUpdate(t *testing.T) {
+	tests := []struct {
+		name           string
+		maxSurge       *intstr.IntOrString
+		maxUnavailable *intstr.IntOrString
+	}{
+		{"defaults", nil, nil},
+		{"surge only", intOrStr(intstr.FromInt(1)), intOrStr(intstr.FromInt(0))},
+		{"unavailable only", intOrStr(intstr.FromInt(0)), intOrStr(intstr.FromInt(2))},
+		{"both zero", intOrStr(intstr.FromInt(0)), intOrStr(intstr.FromInt(0))},
+		{"full surge", intOrStr(intstr.FromString("100%")), intOrStr(intstr.FromInt(0))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pm := makePodManager(4, "nginx:1.21", tt.maxSurge, tt.maxUnavailable)
+			e := newTestEnv(t, pm)
+			e.rollOut()
+			if got := e.podManager().Status; got.UpdatedReplicas != 4 || !isConditionTrue(got.GetCondition(appsv1.ConditionTypeRolloutComplete)) {
+				t.Fatalf("initial rollout not complete: %+v", got)
+			}
+			e.events()
+
+			maxSurge, maxUnavailable, err := rollingUpdateLimits(pm)
+			if err != nil {
+				t.Fatal(err)
+			}
+			e.setImage("nginx:1.25")
+
+			for i := 0; ; i++ {
+				if i == 20 {
+					t.Fatal("rollout did not complete")
+				}
+				e.reconcile()
+
+				// Pods created in this reconcile are not ready yet, so the ready
+				// Pods left are the ones that survived the batch
+				pods := e.pods()
+				if total := int32(len(pods)); total > 4+maxSurge {
+					t.Fatalf("%d Pods exceed replicas+maxSurge=%d", total, 4+maxSurge)
+				}
+				if ready := countReady(pods); ready < 4-maxUnavailable {
+					t.Fatalf("%d ready Pods are below replicas-maxUnavailable=%d", ready, 4-maxUnavailable)
+				}
+
+				status := e.podManager().Status
+				if status.UpdatedReplicas != int32(countImage(pods, "nginx:1.25")) {
+					t.Errorf("UpdatedReplicas = %d, want %d", status.UpdatedReplicas, countImage(pods, "nginx:1.25"))
+				}
+				if isConditionTrue(status.GetCondition(appsv1.ConditionTypeRolloutComplete)) {
+					break
+				}
+				e.markReady()
+			}
+
+			pods := e.pods()
+			if len(pods) != 4 || countImage(pods, "nginx:1.25") != 4 {
+				t.Errorf("got %d Pods, %d with the new image, want 4 updated Pods", len(pods), countImage(pods, "nginx:1.25"))
+			}
+			status := e.podManager().Status
+			if status.UpdatedReplicas != 4 || status.ReadyReplicas != 4 || status.CurrentReplicas != 4 {
+				t.Errorf("status = %+v, want 4 updated, ready and current replicas", status)
+			}
+			if events := e.events(); !strings.Contains(events, "RolloutComplete") {
+				t.Errorf("no RolloutComplete event in %q", events)
+			}
+		})
+	}
+}
+
+func TestReconcileRolloutWaitsForReadiness(t *testing.T) {
+	pm := makePodManager(4, "nginx:1.21", intOrStr(intstr.FromInt(1)), intOrStr(intstr.FromInt(1)))
+	e := newTestEnv(t, pm)
+	e.rollOut()
+	e.setImage("nginx:1.25")
+
+	// The new Pods never become ready, so only maxUnavailable old Pods may go
+	for i := 0; i < 5; i++ {
+		e.reconcile()
+	}
+
+	pods := e.pods()
+	if got := countImage(pods, "nginx:1.21"); got != 3 {
+		t.Errorf("%d old Pods left, want 3", got)
+	}
+	if got := countImage(pods, "nginx:1.25"); got != 2 {
+		t.Errorf("%d new Pods created, want 2", got)
+	}
+	status := e.podManager().Status
+	if status.UpdatedReplicas != 2 {
+		t.Errorf("UpdatedReplicas = %d, want 2", status.UpdatedReplicas)
+	}
+	cond := status.GetCondition(appsv1.ConditionTypeRolloutComplete)
+	if cond == nil || cond.Status != "False" || cond.Message != "0/4 Pods are updated and ready, 3 outdated Pods remain" {
+		t.Errorf("RolloutComplete = %+v", cond)
+	}
+}
+
+func TestReconcileScaleToZeroDuringRollout(t *testing.T) {
+	pm := makePodManager(3, "nginx:1.21", nil, nil)
+	e := newTestEnv(t, pm)
+	e.rollOut()
+
+	pm = e.podManager()
+	pm.Spec.Image = "nginx:1.25"
+	pm.Spec.Replicas = 0
+	if err := e.client.Update(context.Background(), pm); err != nil {
+		t.Fatal(err)
+	}
+	e.reconcile()
+
+	if pods := e.pods(); len(pods) != 0 {
+		t.Errorf("%d Pods left, want none", len(pods))
+	}
+}
+
+func TestReconcileAdoptsLegacyPods(t *testing.T) {
+	pm := makePodManager(3, "nginx:1.21", nil, nil)
+	// Pods created before the spec hash label existed
+	legacy := func(name, image string) *corev1.Pod {
+		pod := newPodForPodManager(pm, name, "")
+		delete(pod.Labels, specHashLabel)
+		pod.Spec.Containers[0].Image = image
+		pod.Status.Phase = corev1.PodRunning
+		pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+		return pod
+	}
+	e := newTestEnv(t, pm,
+		legacy("pm-0", "nginx:1.21"),
+		legacy("pm-1", "nginx:1.21"),
+		legacy("pm-2", "nginx:1.19"),
+	)
+
+	e.reconcile()
+	e.reconcile()
+
+	hash := specHash(pm)
+	for _, name := range []string{"pm-0", "pm-1"} {
+		pod := &corev1.Pod{}
+		if err := e.client.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: name}, pod); err != nil {
+			t.Fatalf("Pod %s running the current spec was replaced: %v", name, err)
+		}
+		if pod.Labels[specHashLabel] != hash {
+			t.Errorf("Pod %s has spec hash %q, want %q", name, pod.Labels[specHashLabel], hash)
+		}
+	}
+	// The two adopted Pods and the surge Pod replacing pm-2
+	if status := e.podManager().Status; status.UpdatedReplicas != 3 {
+		t.Errorf("UpdatedReplicas = %d, want 3", status.UpdatedReplicas)
+	}
+
+	for i := 0; i < 5; i++ {
+		e.markReady()
+		e.reconcile()
+	}
+	pods := e.pods()
+	if len(pods) != 3 || countImage(pods, "nginx:1.21") != 3 {
+		t.Errorf("got Pods %v, want 3 running nginx:1.21", podNames(pods))
+	}
+	if !isConditionTrue(e.podManager().Status.GetCondition(appsv1.ConditionTypeRolloutComplete)) {
+		t.Error("rollout not complete")
+	}
+}
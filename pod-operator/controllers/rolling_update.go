@@ -0,0 +1,157 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sort"
+
+	appsv1 "github.com/ashwinyue/kubernetes-examples/pod-operator/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/rand"
+)
+
+// specHashLabel is the Pod label holding the hash of the spec the Pod was created from
+const specHashLabel = "podmanager.mycompany.com/spec-hash"
+
+// defaultMaxUnavailable and defaultMaxSurge are used when the spec leaves them unset
+var (
+	defaultMaxUnavailable = intstr.FromString("25%")
+	defaultMaxSurge       = intstr.FromString("25%")
+)
+
+// specHash returns a hash of the Pod spec generated for a PodManager. Pods whose
+// spec-hash label differs run an outdated spec and are replaced.
+func specHash(podManager *appsv1.PodManager) string {
+	hasher := fnv.New32a()
+	// Encoding a PodSpec never fails
+	_ = json.NewEncoder(hasher).Encode(podSpecForPodManager(podManager))
+	return rand.SafeEncodeString(fmt.Sprint(hasher.Sum32()))
+}
+
+// rollingUpdateLimits resolves MaxSurge and MaxUnavailable against Replicas
+func rollingUpdateLimits(podManager *appsv1.PodManager) (maxSurge, maxUnavailable int32, err error) {
+	surge := defaultMaxSurge
+	if podManager.Spec.MaxSurge != nil {
+		surge = *podManager.Spec.MaxSurge
+	}
+	unavailable := defaultMaxUnavailable
+	if podManager.Spec.MaxUnavailable != nil {
+		unavailable = *podManager.Spec.MaxUnavailable
+	}
+
+	replicas := int(podManager.Spec.Replicas)
+	s, err := intstr.GetScaledValueFromIntOrPercent(&surge, replicas, true)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid maxSurge: %v", err)
+	}
+	u, err := intstr.GetScaledValueFromIntOrPercent(&unavailable, replicas, false)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid maxUnavailable: %v", err)
+	}
+	if s < 0 || u < 0 {
+		return 0, 0, fmt.Errorf("maxSurge and maxUnavailable must not be negative")
+	}
+
+	// Without surge or unavailability the update could never make progress
+	if s == 0 && u == 0 {
+		u = 1
+	}
+	return int32(s), int32(u), nil
+}
+
+// splitPods separates Pods running the current spec from outdated ones. Pods
+// that are being deleted are left out of both.
+func splitPods(pods []corev1.Pod, hash string) (updated, outdated []corev1.Pod) {
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		if pod.Labels[specHashLabel] == hash {
+			updated = append(updated, pod)
+		} else {
+			outdated = append(outdated, pod)
+		}
+	}
+	return updated, outdated
+}
+
+// podSpecMatches reports whether a Pod runs the given spec. Only the fields set
+// by podSpecForPodManager are compared, the API server defaults the others.
+func podSpecMatches(pod *corev1.Pod, spec corev1.PodSpec) bool {
+	if pod.Spec.RestartPolicy != spec.RestartPolicy || len(pod.Spec.Containers) != len(spec.Containers) {
+		return false
+	}
+	for i, container := range spec.Containers {
+		current := pod.Spec.Containers[i]
+		if current.Name != container.Name || current.Image != container.Image || len(current.Ports) != len(container.Ports) {
+			return false
+		}
+		for j, port := range container.Ports {
+			if current.Ports[j].ContainerPort != port.ContainerPort {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isPodReady reports whether a Pod is running and ready
+func isPodReady(pod *corev1.Pod) bool {
+	if pod.Status.Phase != corev1.PodRunning {
+		return false
+	}
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// countReady returns the number of ready Pods
+func countReady(pods []corev1.Pod) int32 {
+	count := int32(0)
+	for i := range pods {
+		if isPodReady(&pods[i]) {
+			count++
+		}
+	}
+	return count
+}
+
+// sortForDeletion orders Pods so that the ones not ready come first, then by name
+func sortForDeletion(pods []corev1.Pod) {
+	sort.SliceStable(pods, func(i, j int) bool {
+		ri, rj := isPodReady(&pods[i]), isPodReady(&pods[j])
+		if ri != rj {
+			return !ri
+		}
+		return pods[i].Name < pods[j].Name
+	})
+}
+
+// maxScaledDown returns how many outdated Pods can be deleted while keeping at
+// least Replicas-maxUnavailable Pods ready. Updated Pods that are not ready yet
+// are expected to become ready, so they are not counted as available.
+func maxScaledDown(desired, maxUnavailable int32, updated, outdated []corev1.Pod) int32 {
+	minAvailable := desired - maxUnavailable
+	total := int32(len(updated) + len(outdated))
+	updatedUnavailable := int32(len(updated)) - countReady(updated)
+	return total - minAvailable - updatedUnavailable
+}
+
+// nextPodName returns the first unused name for an updated Pod
+func nextPodName(podManager *appsv1.PodManager, hash string, updated []corev1.Pod) string {
+	used := make(map[string]bool, len(updated))
+	for _, pod := range updated {
+		used[pod.Name] = true
+	}
+	for i := 0; ; i++ {
+		name := fmt.Sprintf("%s-%s-%d", podManager.Name, hash, i)
+		if !used[name] {
+			return name
+		}
+	}
+}
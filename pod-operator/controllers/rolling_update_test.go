@@ -0,0 +1,233 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	appsv1 "github.com/ashwinyue/kubernetes-examples/pod-operator/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func intOrStr(v intstr.IntOrString) *intstr.IntOrString {
+	return &v
+}
+
+func makePodManager(replicas int32, image string, maxSurge, maxUnavailable *intstr.IntOrString) *appsv1.PodManager {
+	return &appsv1.PodManager{
+		ObjectMeta: metav1.ObjectMeta{Name: "pm", Namespace: "default", UID: "uid"},
+		Spec: appsv1.PodManagerSpec{
+			Replicas:       replicas,
+			Image:          image,
+			MaxSurge:       maxSurge,
+			MaxUnavailable: maxUnavailable,
+		},
+	}
+}
+
+func makePod(name, hash string, ready bool) corev1.Pod {
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{}},
+		Status:     corev1.PodStatus{Phase: corev1.PodPending},
+	}
+	if hash != "" {
+		pod.Labels[specHashLabel] = hash
+	}
+	if ready {
+		pod.Status.Phase = corev1.PodRunning
+		pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+	}
+	return pod
+}
+
+func podNames(pods []corev1.Pod) []string {
+	names := make([]string, len(pods))
+	for i, pod := range pods {
+		names[i] = pod.Name
+	}
+	return names
+}
+
+func TestRollingUpdateLimits(t *testing.T) {
+	tests := []struct {
+		name            string
+		replicas        int32
+		maxSurge        *intstr.IntOrString
+		maxUnavailable  *intstr.IntOrString
+		wantSurge       int32
+		wantUnavailable int32
+		wantErr         bool
+	}{
+		{"defaults", 4, nil, nil, 1, 1, false},
+		{"surge rounds up, unavailable rounds down", 10, nil, nil, 3, 2, false},
+		{"small replicas", 1, nil, nil, 1, 0, false},
+		{"absolute values", 5, intOrStr(intstr.FromInt(2)), intOrStr(intstr.FromInt(1)), 2, 1, false},
+		{"percent", 3, intOrStr(intstr.FromString("50%")), intOrStr(intstr.FromString("50%")), 2, 1, false},
+		{"surge only", 4, intOrStr(intstr.FromInt(1)), intOrStr(intstr.FromInt(0)), 1, 0, false},
+		{"unavailable only", 4, intOrStr(intstr.FromInt(0)), intOrStr(intstr.FromInt(2)), 0, 2, false},
+		{"both zero", 4, intOrStr(intstr.FromInt(0)), intOrStr(intstr.FromInt(0)), 0, 1, false},
+		{"both zero percent", 4, intOrStr(intstr.FromString("0%")), intOrStr(intstr.FromString("0%")), 0, 1, false},
+		{"percent rounds to zero", 2, intOrStr(intstr.FromString("0%")), intOrStr(intstr.FromString("25%")), 0, 1, false},
+		{"zero replicas", 0, nil, nil, 0, 1, false},
+		{"negative", 4, intOrStr(intstr.FromInt(-1)), nil, 0, 0, true},
+		{"missing percent sign", 4, nil, intOrStr(intstr.FromString("25")), 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pm := makePodManager(tt.replicas, "nginx", tt.maxSurge, tt.maxUnavailable)
+			surge, unavailable, err := rollingUpdateLimits(pm)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if surge != tt.wantSurge || unavailable != tt.wantUnavailable {
+				t.Errorf("got surge=%d unavailable=%d, want surge=%d unavailable=%d",
+					surge, unavailable, tt.wantSurge, tt.wantUnavailable)
+			}
+		})
+	}
+}
+
+func TestSpecHash(t *testing.T) {
+	a := specHash(makePodManager(3, "nginx:1.21", nil, nil))
+	if a != specHash(makePodManager(5, "nginx:1.21", intOrStr(intstr.FromInt(1)), nil)) {
+		t.Error("hash changed with replicas or rollout settings")
+	}
+	if a == specHash(makePodManager(3, "nginx:1.25", nil, nil)) {
+		t.Error("hash did not change with the image")
+	}
+}
+
+func TestSplitPods(t *testing.T) {
+	terminating := makePod("terminating", "old", true)
+	terminating.DeletionTimestamp = &metav1.Time{}
+	pods := []corev1.Pod{
+		makePod("a", "new", true),
+		makePod("b", "old", true),
+		makePod("c", "", false),
+		terminating,
+		makePod("d", "new", false),
+	}
+
+	updated, outdated := splitPods(pods, "new")
+	if got, want := podNames(updated), []string{"a", "d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("updated = %v, want %v", got, want)
+	}
+	if got, want := podNames(outdated), []string{"b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("outdated = %v, want %v", got, want)
+	}
+}
+
+func TestPodSpecMatches(t *testing.T) {
+	pm := makePodManager(3, "nginx:1.21", nil, nil)
+	spec := podSpecForPodManager(pm)
+
+	defaulted := corev1.Pod{Spec: *spec.DeepCopy()}
+	defaulted.Spec.Containers[0].Ports[0].Protocol = corev1.ProtocolTCP
+	defaulted.Spec.Containers[0].ImagePullPolicy = corev1.PullIfNotPresent
+	defaulted.Spec.DNSPolicy = corev1.DNSClusterFirst
+
+	otherImage := corev1.Pod{Spec: *spec.DeepCopy()}
+	otherImage.Spec.Containers[0].Image = "nginx:1.25"
+
+	otherPort := corev1.Pod{Spec: *spec.DeepCopy()}
+	otherPort.Spec.Containers[0].Ports[0].ContainerPort = 8080
+
+	sidecar := corev1.Pod{Spec: *spec.DeepCopy()}
+	sidecar.Spec.Containers = append(sidecar.Spec.Containers, corev1.Container{Name: "sidecar"})
+
+	tests := []struct {
+		name string
+		pod  corev1.Pod
+		want bool
+	}{
+		{"defaulted by the API server", defaulted, true},
+		{"different image", otherImage, false},
+		{"different port", otherPort, false},
+		{"extra container", sidecar, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := podSpecMatches(&tt.pod, spec); got != tt.want {
+				t.Errorf("podSpecMatches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSortForDeletion(t *testing.T) {
+	pods := []corev1.Pod{
+		makePod("a", "old", true),
+		makePod("d", "old", false),
+		makePod("b", "old", true),
+		makePod("c", "old", false),
+	}
+	sortForDeletion(pods)
+	if got, want := podNames(pods), []string{"c", "d", "a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("order = %v, want %v", got, want)
+	}
+}
+
+func TestMaxScaledDown(t *testing.T) {
+	pods := func(prefix string, ready, notReady int) []corev1.Pod {
+		var pods []corev1.Pod
+		for i := 0; i < ready+notReady; i++ {
+			pods = append(pods, makePod(prefix+string(rune('a'+i)), prefix, i < ready))
+		}
+		return pods
+	}
+
+	tests := []struct {
+		name           string
+		desired        int32
+		maxUnavailable int32
+		updated        []corev1.Pod
+		outdated       []corev1.Pod
+		want           int32
+	}{
+		{"no surge yet", 4, 1, nil, pods("old", 4, 0), 1},
+		{"surge pod not ready", 4, 0, pods("new", 0, 1), pods("old", 4, 0), 0},
+		{"surge pod ready", 4, 0, pods("new", 1, 0), pods("old", 4, 0), 1},
+		{"new pods not ready hold the floor", 4, 1, pods("new", 0, 1), pods("old", 3, 0), 0},
+		{"floor reached", 4, 1, pods("new", 1, 1), pods("old", 2, 0), 0},
+		{"new pods ready", 4, 1, pods("new", 2, 0), pods("old", 2, 0), 1},
+		{"not ready outdated pods", 4, 1, nil, pods("old", 2, 2), 1},
+		{"scale to zero", 0, 1, nil, pods("old", 3, 0), 4},
+		{"scale to zero with new pods", 0, 1, pods("new", 0, 2), pods("old", 3, 0), 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := maxScaledDown(tt.desired, tt.maxUnavailable, tt.updated, tt.outdated)
+			if got != tt.want {
+				t.Errorf("maxScaledDown() = %d, want %d", got, tt.want)
+			}
+			if tt.desired == 0 && got < int32(len(tt.outdated)) {
+				t.Errorf("scaling to zero keeps %d outdated Pods", int32(len(tt.outdated))-got)
+			}
+		})
+	}
+}
+
+func TestNextPodName(t *testing.T) {
+	pm := makePodManager(3, "nginx", nil, nil)
+	tests := []struct {
+		name    string
+		updated []corev1.Pod
+		want    string
+	}{
+		{"first", nil, "pm-h-0"},
+		{"next", []corev1.Pod{makePod("pm-h-0", "h", true)}, "pm-h-1"},
+		{"fills gap", []corev1.Pod{makePod("pm-h-0", "h", true), makePod("pm-h-2", "h", true)}, "pm-h-1"},
+		{"adopted names ignored", []corev1.Pod{makePod("pm-0", "h", true)}, "pm-h-0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nextPodName(pm, "h", tt.updated); got != tt.want {
+				t.Errorf("nextPodName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
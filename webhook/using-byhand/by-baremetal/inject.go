@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/yaml"
+)
+
+// 记录已注入的模板名称的注解，再次准入时跳过这些模板，避免重复注入
+const injectedAnnotation = "apps.onex.io/injected"
+
+// 注入模板文件的内容。文件先作为 Go 模板渲染（可以使用 .Name、.Namespace、.Labels、.Annotations），再按 YAML 解析
+type InjectionSpec struct {
+	// 选择 Pod 的标签选择器，为空时匹配所有 Pod
+	PodSelector *metav1.LabelSelector `json:"podSelector,omitempty"`
+	// 生效的命名空间，为空时匹配所有命名空间
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// 添加到 Pod 的注解，已有的注解会被覆盖
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// 添加到 Pod 中每个容器的环境变量，容器中已有同名变量时跳过
+	Env []corev1.EnvVar `json:"env,omitempty"`
+	// 添加到 Pod 中每个容器的卷挂载，容器中已有同名挂载或相同挂载路径时跳过
+	VolumeMounts []corev1.VolumeMount `json:"volumeMounts,omitempty"`
+	// 添加的 init 容器，已有同名容器时跳过
+	InitContainers []corev1.Container `json:"initContainers,omitempty"`
+	// 添加的 sidecar 容器，已有同名容器时跳过
+	Containers []corev1.Container `json:"containers,omitempty"`
+	// 添加的卷，已有同名卷时跳过
+	Volumes []corev1.Volume `json:"volumes,omitempty"`
+}
+
+// 渲染模板时可以使用的 Pod 信息
+type templateData struct {
+	Name        string
+	Namespace   string
+	Labels      map[string]string
+	Annotations map[string]string
+}
+
+// 注入模板，名称为文件名去掉扩展名
+type InjectionTemplate struct {
+	Name     string
+	template *template.Template
+}
+
+// 从目录中加载所有 .yaml 和 .yml 模板，按文件名排序
+func LoadTemplates(dir string) ([]*InjectionTemplate, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var templates []*InjectionTemplate
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		t, err := ParseTemplate(strings.TrimSuffix(entry.Name(), ext), string(data))
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, t)
+	}
+	return templates, nil
+}
+
+// 解析模板，并用空 Pod 渲染一次以尽早发现错误
+func ParseTemplate(name, text string) (*InjectionTemplate, error) {
+	tmpl, err := template.New(name).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("template %s: %v", name, err)
+	}
+	t := &InjectionTemplate{Name: name, template: tmpl}
+	if _, err := t.render(&corev1.Pod{}, ""); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// 用 Pod 的信息渲染模板
+func (t *InjectionTemplate) render(pod *corev1.Pod, namespace string) (*InjectionSpec, error) {
+	var buf bytes.Buffer
+	data := templateData{
+		Name:        pod.Name,
+		Namespace:   namespace,
+		Labels:      pod.Labels,
+		Annotations: pod.Annotations,
+	}
+	if err := t.template.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("template %s: %v", t.Name, err)
+	}
+	var spec InjectionSpec
+	if err := yaml.UnmarshalStrict(buf.Bytes(), &spec); err != nil {
+		return nil, fmt.Errorf("template %s: %v", t.Name, err)
+	}
+	return &spec, nil
+}
+
+// 判断注入规则是否适用于 Pod
+func (s *InjectionSpec) matches(pod *corev1.Pod, namespace string) (bool, error) {
+	if len(s.Namespaces) > 0 {
+		found := false
+		for _, ns := range s.Namespaces {
+			if ns == namespace {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false, nil
+		}
+	}
+	if s.PodSelector == nil {
+		return true, nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(s.PodSelector)
+	if err != nil {
+		return false, err
+	}
+	return selector.Matches(labels.Set(pod.Labels)), nil
+}
+
+// 依次应用所有适用且尚未注入的模板，修改 pod 并返回对应的 JSON Patch 和本次注入的模板名称
+func Inject(templates []*InjectionTemplate, pod *corev1.Pod, namespace string) ([]patchOperation, []string, error) {
+	injected := make(map[string]bool)
+	for _, name := range strings.Split(pod.Annotations[injectedAnnotation], ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			injected[name] = true
+		}
+	}
+
+	p := &podPatcher{pod: pod, containers: len(pod.Spec.Containers)}
+	var applied []string
+	for _, t := range templates {
+		if injected[t.Name] {
+			continue // 已经注入过
+		}
+		spec, err := t.render(pod, namespace)
+		if err != nil {
+			return nil, nil, err
+		}
+		ok, err := spec.matches(pod, namespace)
+		if err != nil {
+			return nil, nil, fmt.Errorf("template %s: invalid podSelector: %v", t.Name, err)
+		}
+		if !ok {
+			continue
+		}
+		p.apply(spec)
+		applied = append(applied, t.Name)
+		injected[t.Name] = true
+	}
+	if len(applied) == 0 {
+		return nil, nil, nil
+	}
+
+	// 记录已注入的模板
+	names := make([]string, 0, len(injected))
+	for name := range injected {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	p.setAnnotation(injectedAnnotation, strings.Join(names, ","))
+	return p.patch, applied, nil
+}
+
+// 在修改 Pod 的同时生成 JSON Patch，保证补丁与 Pod 的当前状态一致
+type podPatcher struct {
+	pod   *corev1.Pod
+	patch []patchOperation
+	// 应用模板前的容器数量，之前的模板注入的 sidecar 排在它们之后
+	containers int
+}
+
+func (p *podPatcher) apply(spec *InjectionSpec) {
+	keys := make([]string, 0, len(spec.Annotations))
+	for key := range spec.Annotations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		p.setAnnotation(key, spec.Annotations[key])
+	}
+
+	// 环境变量和卷挂载只添加到原有的容器
+	for i := 0; i < p.containers; i++ {
+		for _, env := range spec.Env {
+			p.addEnv(i, env)
+		}
+		for _, mount := range spec.VolumeMounts {
+			p.addVolumeMount(i, mount)
+		}
+	}
+	for _, c := range spec.InitContainers {
+		if !hasContainer(p.pod.Spec.InitContainers, c.Name) {
+			p.pod.Spec.InitContainers = p.appendTo("/spec/initContainers", p.pod.Spec.InitContainers, c)
+		}
+	}
+	for _, c := range spec.Containers {
+		if !hasContainer(p.pod.Spec.Containers, c.Name) {
+			p.pod.Spec.Containers = p.appendTo("/spec/containers", p.pod.Spec.Containers, c)
+		}
+	}
+	for _, v := range spec.Volumes {
+		if !hasVolume(p.pod.Spec.Volumes, v.Name) {
+			if p.pod.Spec.Volumes == nil {
+				p.patch = append(p.patch, patchOperation{Op: "add", Path: "/spec/volumes", Value: []corev1.Volume{v}})
+			} else {
+				p.patch = append(p.patch, patchOperation{Op: "add", Path: "/spec/volumes/-", Value: v})
+			}
+			p.pod.Spec.Volumes = append(p.pod.Spec.Volumes, v)
+		}
+	}
+}
+
+func (p *podPatcher) setAnnotation(key, value string) {
+	if p.pod.Annotations == nil {
+		p.pod.Annotations = map[string]string{key: value}
+		p.patch = append(p.patch, patchOperation{Op: "add", Path: "/metadata/annotations", Value: map[string]string{key: value}})
+		return
+	}
+	op := "add"
+	if _, ok := p.pod.Annotations[key]; ok {
+		op = "replace"
+	}
+	p.pod.Annotations[key] = value
+	p.patch = append(p.patch, patchOperation{Op: op, Path: "/metadata/annotations/" + escapeJSONPointer(key), Value: value})
+}
+
+func (p *podPatcher) addEnv(container int, env corev1.EnvVar) {
+	c := &p.pod.Spec.Containers[container]
+	for _, e := range c.Env {
+		if e.Name == env.Name {
+			return // 不覆盖容器中已有的变量
+		}
+	}
+	path := fmt.Sprintf("/spec/containers/%d/env", container)
+	if c.Env == nil {
+		p.patch = append(p.patch, patchOperation{Op: "add", Path: path, Value: []corev1.EnvVar{env}})
+	} else {
+		p.patch = append(p.patch, patchOperation{Op: "add", Path: path + "/-", Value: env})
+	}
+	c.Env = append(c.Env, env)
+}
+
+func (p *podPatcher) addVolumeMount(container int, mount corev1.VolumeMount) {
+	c := &p.pod.Spec.Containers[container]
+	for _, m := range c.VolumeMounts {
+		if m.Name == mount.Name || m.MountPath == mount.MountPath {
+			return // 不覆盖容器中已有的挂载
+		}
+	}
+	path := fmt.Sprintf("/spec/containers/%d/volumeMounts", container)
+	if c.VolumeMounts == nil {
+		p.patch = append(p.patch, patchOperation{Op: "add", Path: path, Value: []corev1.VolumeMount{mount}})
+	} else {
+		p.patch = append(p.patch, patchOperation{Op: "add", Path: path + "/-", Value: mount})
+	}
+	c.VolumeMounts = append(c.VolumeMounts, mount)
+}
+
+// 向容器列表末尾添加容器；列表为空时整体添加
+func (p *podPatcher) appendTo(path string, containers []corev1.Container, c corev1.Container) []corev1.Container {
+	if containers == nil {
+		p.patch = append(p.patch, patchOperation{Op: "add", Path: path, Value: []corev1.Container{c}})
+	} else {
+		p.patch = append(p.patch, patchOperation{Op: "add", Path: path + "/-", Value: c})
+	}
+	return append(containers, c)
+}
+
+func hasContainer(containers []corev1.Container, name string) bool {
+	for _, c := range containers {
+		if c.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func hasVolume(volumes []corev1.Volume, name string) bool {
+	for _, v := range volumes {
+		if v.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// 按 RFC 6901 转义 JSON Pointer 中的一段："~" 转为 "~0"，"/" 转为 "~1"
+func escapeJSONPointer(token string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(token)
+}
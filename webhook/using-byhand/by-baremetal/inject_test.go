@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// 对 Pod 应用注入模板，返回应用补丁后的 Pod
+func injectPod(t *testing.T, templates []*InjectionTemplate, pod *corev1.Pod, namespace string) (*corev1.Pod, []string) {
+	t.Helper()
+	original, err := json.Marshal(pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	patch, applied, err := Inject(templates, pod.DeepCopy(), namespace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(patch) == 0 {
+		return pod, applied
+	}
+	patchBytes, err := json.Marshal(patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := jsonpatch.DecodePatch(patchBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	patched, err := decoded.Apply(original)
+	if err != nil {
+		t.Fatalf("apply %s: %v", patchBytes, err)
+	}
+	var out corev1.Pod
+	if err := json.Unmarshal(patched, &out); err != nil {
+		t.Fatal(err)
+	}
+	return &out, applied
+}
+
+func loadTestTemplates(t *testing.T) []*InjectionTemplate {
+	t.Helper()
+	templates, err := LoadTemplates("templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return templates
+}
+
+func TestInject(t *testing.T) {
+	templates := loadTestTemplates(t)
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Labels: map[string]string{"logging": "enabled"}},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			Name:  "nginx",
+			Image: "nginx:1.23",
+			Env:   []corev1.EnvVar{{Name: "LOG_DIR", Value: "/logs"}},
+		}}},
+	}
+
+	got, applied := injectPod(t, templates, pod, "demo")
+	if len(applied) != 2 {
+		t.Fatalf("applied = %v, want log-agent and miner-type", applied)
+	}
+	if v := got.Annotations["apps.onex.io/miner-type"]; v != "S1.SMALL1" {
+		t.Errorf("miner-type annotation = %q", v)
+	}
+	if v := got.Annotations[injectedAnnotation]; v != "log-agent,miner-type" {
+		t.Errorf("%s = %q", injectedAnnotation, v)
+	}
+	if len(got.Spec.InitContainers) != 1 || got.Spec.InitContainers[0].Name != "log-dir-init" {
+		t.Errorf("initContainers = %v", got.Spec.InitContainers)
+	}
+	if len(got.Spec.Containers) != 2 || got.Spec.Containers[1].Name != "log-agent" {
+		t.Fatalf("containers = %v", got.Spec.Containers)
+	}
+	if env := got.Spec.Containers[1].Env; len(env) != 1 || env[0].Value != "demo" {
+		t.Errorf("sidecar env = %v, want POD_NAMESPACE rendered from the namespace", env)
+	}
+	// 容器中已有的变量不被覆盖
+	if env := got.Spec.Containers[0].Env; len(env) != 1 || env[0].Value != "/logs" {
+		t.Errorf("nginx env = %v", env)
+	}
+	// 业务容器挂载共享的日志目录，sidecar 才能读取到日志
+	if mounts := got.Spec.Containers[0].VolumeMounts; len(mounts) != 1 || mounts[0].Name != "app-logs" || mounts[0].MountPath != "/var/log/app" {
+		t.Errorf("nginx volumeMounts = %v, want app-logs at /var/log/app", mounts)
+	}
+	if len(got.Spec.Volumes) != 1 || got.Spec.Volumes[0].Name != "app-logs" {
+		t.Errorf("volumes = %v", got.Spec.Volumes)
+	}
+
+	// 再次准入时不重复注入
+	again, applied := injectPod(t, templates, got, "demo")
+	if len(applied) != 0 {
+		t.Errorf("re-admission applied %v", applied)
+	}
+	if len(again.Spec.Containers) != 2 || len(again.Spec.InitContainers) != 1 || len(again.Spec.Volumes) != 1 || len(again.Spec.Containers[0].VolumeMounts) != 1 {
+		t.Errorf("re-admission changed the pod: %+v", again.Spec)
+	}
+}
+
+func TestInjectSelectors(t *testing.T) {
+	sidecar, err := ParseTemplate("sidecar", `
+podSelector:
+  matchExpressions:
+  - {key: app, operator: In, values: [web]}
+namespaces: [prod]
+containers:
+- name: proxy
+  image: envoyproxy/envoy:v1.30.1
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		labels    map[string]string
+		namespace string
+		want      bool
+	}{
+		{"matching", map[string]string{"app": "web"}, "prod", true},
+		{"other namespace", map[string]string{"app": "web"}, "dev", false},
+		{"other labels", map[string]string{"app": "db"}, "prod", false},
+		{"no labels", nil, "prod", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "p", Labels: tt.labels},
+				Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: "app"}}},
+			}
+			got, applied := injectPod(t, []*InjectionTemplate{sidecar}, pod, tt.namespace)
+			if injected := len(applied) == 1; injected != tt.want {
+				t.Errorf("injected = %v, want %v", injected, tt.want)
+			}
+			if tt.want && len(got.Spec.Containers) != 2 {
+				t.Errorf("containers = %v", got.Spec.Containers)
+			}
+		})
+	}
+}
+
+func TestParseTemplateErrors(t *testing.T) {
+	tests := map[string]string{
+		"bad template":  "annotations: {{ .Name",
+		"unknown field": "sidecars: []",
+		"bad yaml":      "annotations: [",
+	}
+	for name, text := range tests {
+		if _, err := ParseTemplate(name, text); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestInjectEnvSkipsInjectedSidecars(t *testing.T) {
+	sidecar, err := ParseTemplate("a-sidecar", `
+containers:
+- name: proxy
+  image: envoyproxy/envoy:v1.30.1
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, err := ParseTemplate("b-env", `
+env:
+- name: REGION
+  value: cn-east
+volumeMounts:
+- name: config
+  mountPath: /etc/app
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "p"},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: "app"}}},
+	}
+
+	got, applied := injectPod(t, []*InjectionTemplate{sidecar, env}, pod, "demo")
+	if len(applied) != 2 || len(got.Spec.Containers) != 2 {
+		t.Fatalf("applied = %v, containers = %v", applied, got.Spec.Containers)
+	}
+	if app := got.Spec.Containers[0]; len(app.Env) != 1 || len(app.VolumeMounts) != 1 {
+		t.Errorf("app container = %+v, want the env and volumeMount", app)
+	}
+	// 前一个模板注入的 sidecar 不是原有的容器
+	if proxy := got.Spec.Containers[1]; len(proxy.Env) != 0 || len(proxy.VolumeMounts) != 0 {
+		t.Errorf("proxy container = %+v, want no env or volumeMounts", proxy)
+	}
+}
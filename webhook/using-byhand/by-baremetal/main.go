@@ -2,10 +2,13 @@ package main
 
 import (
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 
+	"github.com/golang/glog"
 	// 这里需要引入 Kubernetes 相关 Go 包
 	// 引入 Kubernetes Admission API 的 v1 版本，用于处理 AdmissionReview 请求和响应
 	admissionv1 "k8s.io/api/admission/v1"
@@ -16,12 +19,39 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/serializer"
 )
 
+// 注入模板，启动时从 -templateDir 加载
+var templates []*InjectionTemplate
+
 func main() {
+	var (
+		port        int
+		certFile    string
+		keyFile     string
+		templateDir string
+	)
+	flag.IntVar(&port, "port", 9999, "Webhook server port.")
+	flag.StringVar(&certFile, "tlsCertFile", "cert/server.crt", "File containing the x509 Certificate for HTTPS.")
+	flag.StringVar(&keyFile, "tlsKeyFile", "cert/server.key", "File containing the x509 private key to --tlsCertFile.")
+	flag.StringVar(&templateDir, "templateDir", "templates", "Directory containing the injection templates (*.yaml).")
+	// 默认把日志输出到标准错误，可以用 -logtostderr=false 改为写文件
+	flag.Set("logtostderr", "true")
+	flag.Parse()
+
+	// 加载注入模板，模板有错误时直接退出
+	var err error
+	templates, err = LoadTemplates(templateDir)
+	if err != nil {
+		glog.Fatalf("Failed to load injection templates: %v", err)
+	}
+	for _, t := range templates {
+		glog.Infof("Loaded injection template %s", t.Name)
+	}
+
 	// 注册 /mutate 路由，/mutate 路径的请求将由 mutate 函数处理
 	http.HandleFunc("/mutate", mutate)
-	// 启动 webhook 服务，指定证书路径，开启 TLS 认证，监听 9999 端口
-	fmt.Println("Started mutating admission webhook server")
-	panic(http.ListenAndServeTLS(":9999", "cert/server.crt", "cert/server.key", nil))
+	// 启动 webhook 服务，指定证书路径，开启 TLS 认证
+	glog.Infof("Started mutating admission webhook server on port %d", port)
+	glog.Fatal(http.ListenAndServeTLS(fmt.Sprintf(":%d", port), certFile, keyFile, nil))
 }
 
 // JSON Patch 操作结构体
@@ -30,13 +60,13 @@ type patchOperation struct {
 	Op string `json:"op"`
 	// 修改的路径
 	Path string `json:"path"`
-	// 设置的值，可以是任意类型
-	Value interface{} `json:"value,omitempty"`
+	// 设置的值，可以是任意类型。注入只使用 add 和 replace，值为空字符串时也要保留
+	Value interface{} `json:"value"`
 }
 
 // 执行修改（Mutating）逻辑的函数
 func mutate(w http.ResponseWriter, r *http.Request) {
-	fmt.Println("Received a request sent by the kube-apiserver")
+	glog.Info("Received a request sent by the kube-apiserver")
 
 	// 读取 HTTP 请求的 body
 	body, err := io.ReadAll(r.Body)
@@ -53,6 +83,12 @@ func mutate(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	// 没有 request 的 AdmissionReview 无法处理，返回 400
+	if ar.Request == nil {
+		glog.Error("AdmissionReview has no request")
+		http.Error(w, "AdmissionReview has no request", http.StatusBadRequest)
+		return
+	}
 	var pod corev1.Pod
 	// 将 AdmissionReview 中的对象数据反序列化为 Pod 结构体
 	if err := json.Unmarshal(ar.Request.Object.Raw, &pod); err != nil {
@@ -60,25 +96,27 @@ func mutate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 检查 Pod 是否有 Annotations，如果没有，初始化一个空的 Map
-	if pod.ObjectMeta.Annotations == nil {
-		pod.ObjectMeta.Annotations = make(map[string]string)
+	// 按模板注入，已注入的模板会被跳过，重复准入不会重复注入
+	patch, applied, err := Inject(templates, &pod, ar.Request.Namespace)
+	response := &admissionv1.AdmissionResponse{
+		UID:     ar.Request.UID, // 设置原请求的 UID
+		Allowed: true,           // 允许该操作
 	}
-	// 通过 Annotation 为 Pod 增加一个标识，表示矿机的机型
-	pod.ObjectMeta.Annotations["apps.onex.io/miner-type"] = "S1.SMALL1"
-
-	// 构造 Patch 对象，用于表示 JSON Patch 操作
-	patch := []patchOperation{
-		{
-			Op:    "add",                      // 操作类型为 "add"
-			Path:  "/metadata/annotations",    // 修改的路径为 Pod 的 Annotations
-			Value: pod.ObjectMeta.Annotations, // 设置的值为增加的 Annotation
-		},
-	}
-	// 将 Patch 对象序列化为 JSON 字节切片
-	patchBytes, err := json.Marshal(patch)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		// 模板渲染或解析失败时拒绝该操作，并把原因返回给用户
+		response.Allowed = false
+		response.Result = &metav1.Status{Message: err.Error()}
+	} else if len(patch) > 0 {
+		// 将 Patch 对象序列化为 JSON 字节切片
+		patchBytes, err := json.Marshal(patch)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// 设置修改后的 Patch 内容，Patch 操作的类型为 JSON Patch
+		pt := admissionv1.PatchTypeJSONPatch
+		response.Patch = patchBytes
+		response.PatchType = &pt
 	}
 
 	// 构造 AdmissionReview 响应
@@ -89,15 +127,7 @@ func mutate(w http.ResponseWriter, r *http.Request) {
 			Kind:       "AdmissionReview",
 		},
 		// 构造响应内容
-		Response: &admissionv1.AdmissionResponse{
-			UID:     ar.Request.UID, // 设置原请求的 UID
-			Allowed: true,           // 允许该操作
-			Patch:   patchBytes,     // 设置修改后的 Patch 内容
-			PatchType: func() *admissionv1.PatchType { // 设置 Patch 操作的类型为 JSON Patch
-				pt := admissionv1.PatchTypeJSONPatch
-				return &pt
-			}(),
-		},
+		Response: response,
 	}
 	// 将 AdmissionReview 响应序列化为 JSON 字节切片
 	resp, err := json.Marshal(admissionReview)
@@ -111,8 +141,14 @@ func mutate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 打印日志，输出 Pod 的元数据
-	fmt.Printf("%#vn\n", pod.ObjectMeta)
-	// 打印日志，表示资源变更成功，包括命名空间和资源名称
-	fmt.Printf("[%s/%s] Resource change succeeded\n", pod.ObjectMeta.Namespace, pod.ObjectMeta.Name)
+	// 打印日志，输出本次注入的模板，包括命名空间和资源名称
+	if !response.Allowed {
+		glog.Errorf("[%s/%s] Denied: %s", ar.Request.Namespace, pod.ObjectMeta.Name, response.Result.Message)
+		return
+	}
+	if len(applied) == 0 {
+		glog.Infof("[%s/%s] No template applied", ar.Request.Namespace, pod.ObjectMeta.Name)
+		return
+	}
+	glog.Infof("[%s/%s] Injected %s", ar.Request.Namespace, pod.ObjectMeta.Name, strings.Join(applied, ","))
 }
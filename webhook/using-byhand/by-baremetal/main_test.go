@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestMutateRejectsMissingRequest(t *testing.T) {
+	body := `{"apiVersion": "admission.k8s.io/v1", "kind": "AdmissionReview"}`
+	req := httptest.NewRequest(http.MethodPost, "/mutate", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	mutate(rec, req) // 不应 panic
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestMutateDeniesFailedInjection(t *testing.T) {
+	// 标签的值使渲染结果不是合法的 YAML
+	owner, err := ParseTemplate("owner", "annotations: {example.com/owner: {{ .Labels.owner }}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(saved []*InjectionTemplate) { templates = saved }(templates)
+	templates = []*InjectionTemplate{owner}
+
+	pod, err := json.Marshal(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "p", Labels: map[string]string{"owner": "["}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := json.Marshal(&admissionv1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview"},
+		Request: &admissionv1.AdmissionRequest{
+			UID:       "uid",
+			Namespace: "demo",
+			Object:    runtime.RawExtension{Raw: pod},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/mutate", strings.NewReader(string(body)))
+	rec := httptest.NewRecorder()
+	mutate(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	var review admissionv1.AdmissionReview
+	if err := json.Unmarshal(rec.Body.Bytes(), &review); err != nil {
+		t.Fatal(err)
+	}
+	resp := review.Response
+	if resp == nil || resp.UID != "uid" || resp.Allowed || resp.Result == nil || !strings.Contains(resp.Result.Message, "owner") {
+		t.Errorf("response = %+v, want the pod denied with the template error", resp)
+	}
+}
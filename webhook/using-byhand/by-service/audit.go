@@ -0,0 +1,298 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// 一次准入决策的审计记录，每条记录写为一行 JSON
+type AuditEvent struct {
+	Time      time.Time               `json:"time"`
+	UID       string                  `json:"uid"`
+	Webhook   string                  `json:"webhook"` // mutate 或 validate
+	Kind      metav1.GroupVersionKind `json:"kind"`
+	Namespace string                  `json:"namespace,omitempty"`
+	Name      string                  `json:"name,omitempty"`
+	Operation string                  `json:"operation"`
+	User      string                  `json:"user"`
+	Allowed   bool                    `json:"allowed"`
+	Reason    string                  `json:"reason,omitempty"`
+	Message   string                  `json:"message,omitempty"`
+	Patch     json.RawMessage         `json:"patch,omitempty"`
+	// warn 模式的校验失败
+	Warnings []string `json:"warnings,omitempty"`
+	// 包括 warn 和 audit 模式下未执行的校验失败
+	AuditAnnotations map[string]string `json:"auditAnnotations,omitempty"`
+}
+
+// 根据请求和响应生成审计记录
+func newAuditEvent(webhook string, req *admissionv1.AdmissionRequest, resp *admissionv1.AdmissionResponse) AuditEvent {
+	event := AuditEvent{
+		Time:      time.Now(),
+		UID:       string(req.UID),
+		Webhook:   webhook,
+		Kind:      req.Kind,
+		Namespace: req.Namespace,
+		Name:      req.Name,
+		Operation: string(req.Operation),
+		User:      req.UserInfo.Username,
+		Allowed:   resp.Allowed,
+	}
+	if event.Name == "" {
+		// 使用 generateName 创建时请求中没有名称
+		if meta, err := decodeObjectMeta(req); err == nil {
+			event.Name = meta.Name
+			if event.Name == "" {
+				event.Name = meta.GenerateName
+			}
+		}
+	}
+	if resp.Result != nil {
+		event.Reason = string(resp.Result.Reason)
+		event.Message = resp.Result.Message
+	}
+	if len(resp.Patch) > 0 {
+		event.Patch = json.RawMessage(resp.Patch)
+	}
+	event.Warnings = resp.Warnings
+	event.AuditAnnotations = resp.AuditAnnotations
+	return event
+}
+
+// 未执行的校验失败，为空表示没有
+func (e *AuditEvent) unenforcedViolations() string {
+	return e.AuditAnnotations[violationsAuditAnnotation]
+}
+
+// 审计日志：把每次准入决策写为 JSON 行，并在内存中保留最近的违反策略的记录用于 /report
+type AuditLog struct {
+	mu         sync.Mutex
+	out        io.Writer    // 为空时只保留违反策略的记录
+	violations []AuditEvent // 最近被拒绝或有未执行的校验失败的记录，环形缓冲区
+	next       int          // 下一条记录写入的位置
+	size       int          // 保留的记录数量上限
+	started    time.Time    // 开始记录的时间
+	allowed    int          // 允许的决策总数
+	denied     int          // 拒绝的决策总数
+	unenforced int          // 允许但有未执行的校验失败的决策总数
+}
+
+func NewAuditLog(out io.Writer, size int) *AuditLog {
+	if size <= 0 {
+		size = 1
+	}
+	return &AuditLog{
+		out:     out,
+		size:    size,
+		started: time.Now(),
+	}
+}
+
+// 记录一次准入决策
+func (a *AuditLog) Record(event AuditEvent) {
+	line, err := json.Marshal(event)
+	if err != nil {
+		glog.Errorf("Failed to encode audit event %s: %v", event.UID, err)
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if event.Allowed {
+		a.allowed++
+	} else {
+		a.denied++
+	}
+	if event.Allowed && event.unenforcedViolations() != "" {
+		a.unenforced++
+	}
+	if !event.Allowed || event.unenforcedViolations() != "" {
+		if len(a.violations) < a.size {
+			a.violations = append(a.violations, event)
+		} else {
+			a.violations[a.next] = event
+		}
+		a.next = (a.next + 1) % a.size
+	}
+	if a.out == nil {
+		return
+	}
+	if _, err := a.out.Write(append(line, '\n')); err != nil {
+		glog.Errorf("Failed to write audit event %s: %v", event.UID, err)
+	}
+}
+
+// /report 返回的汇总结果
+type AuditReport struct {
+	Since      time.Time         `json:"since"`
+	Allowed    int               `json:"allowed"`
+	Denied     int               `json:"denied"`
+	Unenforced int               `json:"unenforced"` // 允许但有未执行的校验失败
+	Namespaces []NamespaceReport `json:"namespaces"`
+}
+
+// 单个命名空间最近违反策略的情况
+type NamespaceReport struct {
+	Namespace  string         `json:"namespace"`
+	Denials    int            `json:"denials"`
+	Unenforced int            `json:"unenforced"` // warn 或 audit 模式下本应拒绝的次数
+	Reasons    map[string]int `json:"reasons"`    // 按校验失败信息统计的次数
+	Last       AuditEvent     `json:"last"`       // 最近一次违反策略的记录
+}
+
+// 按命名空间汇总最近违反策略的记录，违反次数多的命名空间排在前面。
+// 在 warn 或 audit 模式下运行一段时间后，Unenforced 即为切换到 enforce 模式后会被拒绝的请求
+func (a *AuditLog) Report() AuditReport {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	report := AuditReport{
+		Since:      a.started,
+		Allowed:    a.allowed,
+		Denied:     a.denied,
+		Unenforced: a.unenforced,
+		Namespaces: []NamespaceReport{},
+	}
+	byNamespace := make(map[string]*NamespaceReport)
+	for _, event := range a.violations {
+		ns := byNamespace[event.Namespace]
+		if ns == nil {
+			ns = &NamespaceReport{Namespace: event.Namespace, Reasons: make(map[string]int)}
+			byNamespace[event.Namespace] = ns
+		}
+		if event.Allowed {
+			ns.Unenforced++
+			ns.Reasons[event.unenforcedViolations()]++
+		} else {
+			ns.Denials++
+			ns.Reasons[event.Message]++
+		}
+		if event.Time.After(ns.Last.Time) {
+			ns.Last = event
+		}
+	}
+	for _, ns := range byNamespace {
+		report.Namespaces = append(report.Namespaces, *ns)
+	}
+	sort.Slice(report.Namespaces, func(i, j int) bool {
+		a, b := report.Namespaces[i], report.Namespaces[j]
+		if a.Denials+a.Unenforced != b.Denials+b.Unenforced {
+			return a.Denials+a.Unenforced > b.Denials+b.Unenforced
+		}
+		return a.Namespace < b.Namespace
+	})
+	return report
+}
+
+// /report 的处理方法
+func (a *AuditLog) serveReport(w http.ResponseWriter, r *http.Request) {
+	resp, err := json.MarshalIndent(a.Report(), "", "  ")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("could not encode report: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(resp); err != nil {
+		glog.Errorf("Can't write report: %v", err)
+	}
+}
+
+// 创建只提供 /report 的 HTTP 服务器。报告包含对象名称、命名空间、用户和补丁，
+// 因此不与 API Server 调用的 Webhook 共用端口，只监听 -reportAddress
+func newReportServer(addr string, audit *AuditLog) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/report", audit.serveReport)
+	return &http.Server{Addr: addr, Handler: mux}
+}
+
+// 按大小轮转的日志文件：超过 maxSize 字节时把当前文件重命名为 path.1，
+// 已有的 path.N 依次后移，最多保留 maxBackups 个旧文件
+type rotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+func openRotatingFile(path string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+	f := &rotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			// rotate 已重新打开原文件，本条记录继续追加写入，下次写入时再尝试轮转
+			glog.Warningf("Failed to rotate %s: %v", f.path, err)
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// 关闭当前文件并移走它，然后重新打开 path。移走失败时也重新打开 path 追加写入，
+// 否则之后的写入都会因为文件已关闭而失败
+func (f *rotatingFile) rotate() error {
+	err := f.file.Close()
+	if err == nil {
+		err = f.shift()
+	}
+	if openErr := f.open(); openErr != nil {
+		return openErr
+	}
+	return err
+}
+
+// 把 path 重命名为 path.1，已有的旧文件依次后移；不保留旧文件时直接删除 path
+func (f *rotatingFile) shift() error {
+	if f.maxBackups <= 0 {
+		if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	for i := f.maxBackups - 1; i > 0; i-- {
+		if err := os.Rename(fmt.Sprintf("%s.%d", f.path, i), fmt.Sprintf("%s.%d", f.path, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Rename(f.path, f.path+".1")
+}
+
+func (f *rotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
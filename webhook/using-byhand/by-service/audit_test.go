@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// 通过 HTTP 处理方法发送 AdmissionReview
+func postReview(t *testing.T, whsvr *WebhookServer, path string, ar *admissionv1.AdmissionReview) *httptest.ResponseRecorder {
+	t.Helper()
+	ar.TypeMeta = metav1.TypeMeta{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview"}
+	body, err := json.Marshal(ar)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	whsvr.serve(w, req)
+	return w
+}
+
+func TestAuditLogRecordsDecisions(t *testing.T) {
+	var out bytes.Buffer
+	whsvr := &WebhookServer{policies: NewPolicyStore(DefaultPolicies()), audit: NewAuditLog(&out, 10)}
+
+	deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{GenerateName: "web-"}}
+	ar := admissionReview(t, deploymentKind, deployment)
+	ar.Request.UserInfo = authenticationv1.UserInfo{Username: "alice"}
+	postReview(t, whsvr, "/mutate", ar)
+	ar.Request.UID = "uid-2"
+	postReview(t, whsvr, "/validate", ar)
+
+	var events []AuditEvent
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		var event AuditEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("invalid audit line %q: %v", scanner.Text(), err)
+		}
+		events = append(events, event)
+	}
+	if len(events) != 2 {
+		t.Fatalf("got %d audit events, want 2", len(events))
+	}
+
+	mutated, denied := events[0], events[1]
+	if mutated.Webhook != "mutate" || !mutated.Allowed || len(mutated.Patch) == 0 {
+		t.Errorf("unexpected mutate event %+v", mutated)
+	}
+	if denied.Webhook != "validate" || denied.Allowed || denied.UID != "uid-2" || denied.Message == "" {
+		t.Errorf("unexpected validate event %+v", denied)
+	}
+	for _, event := range events {
+		if event.User != "alice" || event.Namespace != "default" || event.Name != "web-" || event.Kind != deploymentKind || event.Operation != "CREATE" {
+			t.Errorf("unexpected request fields %+v", event)
+		}
+	}
+}
+
+func TestAuditLogReport(t *testing.T) {
+	audit := NewAuditLog(nil, 3)
+	start := time.Now()
+	record := func(namespace, message string, allowed bool) {
+		start = start.Add(time.Second)
+		audit.Record(AuditEvent{Time: start, Namespace: namespace, Message: message, Allowed: allowed})
+	}
+	warn := func(namespace, message string) {
+		start = start.Add(time.Second)
+		audit.Record(AuditEvent{
+			Time:             start,
+			Namespace:        namespace,
+			Allowed:          true,
+			AuditAnnotations: map[string]string{violationsAuditAnnotation: message},
+		})
+	}
+	record("a", "old", false) // 超出保留数量后被丢弃
+	record("a", "missing label x", false)
+	record("b", "missing label y", false)
+	record("b", "", true)
+	warn("b", "missing label y")
+	record("a", "", true)
+
+	report := audit.Report()
+	if report.Allowed != 3 || report.Denied != 3 || report.Unenforced != 1 {
+		t.Errorf("allowed = %d, denied = %d, unenforced = %d, want 3, 3 and 1", report.Allowed, report.Denied, report.Unenforced)
+	}
+	if len(report.Namespaces) != 2 {
+		t.Fatalf("namespaces = %+v", report.Namespaces)
+	}
+	b, a := report.Namespaces[0], report.Namespaces[1]
+	if b.Namespace != "b" || b.Denials != 1 || b.Unenforced != 1 || b.Reasons["missing label y"] != 2 || !b.Last.Allowed {
+		t.Errorf("unexpected report for b: %+v", b)
+	}
+	if a.Namespace != "a" || a.Denials != 1 || a.Unenforced != 0 || a.Reasons["old"] != 0 {
+		t.Errorf("unexpected report for a: %+v", a)
+	}
+
+	w := httptest.NewRecorder()
+	audit.serveReport(w, httptest.NewRequest(http.MethodGet, "/report", nil))
+	var served AuditReport
+	if err := json.Unmarshal(w.Body.Bytes(), &served); err != nil {
+		t.Fatal(err)
+	}
+	if served.Denied != 3 || len(served.Namespaces) != 2 {
+		t.Errorf("served report = %+v", served)
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	f, err := openRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for _, line := range []string{"1111111\n", "2222222\n", "3333333\n", "4444444\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for name, want := range map[string]string{
+		path:        "4444444\n",
+		path + ".1": "3333333\n",
+		path + ".2": "2222222\n",
+	} {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != want {
+			t.Errorf("%s = %q, want %q", filepath.Base(name), data, want)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected at most 2 backups, stat error: %v", err)
+	}
+}
+
+func TestRotatingFileRenameFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	// path.1 是非空目录，重命名 path 会失败
+	if err := os.MkdirAll(filepath.Join(path+".1", "busy"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := openRotatingFile(path, 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for _, line := range []string{"1111111\n", "2222222\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatalf("write after a failed rotation: %v", err)
+		}
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "1111111\n2222222\n" {
+		t.Fatalf("%s = %q (%v), want both lines appended", filepath.Base(path), data, err)
+	}
+
+	// 重命名恢复正常后继续轮转
+	if err := os.RemoveAll(path + ".1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("3333333\n")); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		path:        "3333333\n",
+		path + ".1": "1111111\n2222222\n",
+	} {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != want {
+			t.Errorf("%s = %q, want %q", filepath.Base(name), data, want)
+		}
+	}
+}
+
+func TestReportNotServedOnWebhookPort(t *testing.T) {
+	audit := NewAuditLog(nil, 10)
+	whsvr := &WebhookServer{policies: NewPolicyStore(DefaultPolicies()), audit: audit}
+
+	w := httptest.NewRecorder()
+	newWebhookMux(whsvr).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/report", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("/report on the webhook port: status = %d, want 404", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	newReportServer("127.0.0.1:0", audit).Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/report", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("/report on the report address: status = %d, want 200", w.Code)
+	}
+}
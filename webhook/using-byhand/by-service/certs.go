@@ -0,0 +1,412 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// Secret 中保存证书的 key，cert.pem 和 key.pem 与手动创建的 Secret 相同
+const (
+	secretCertKey   = "cert.pem"
+	secretKeyKey    = "key.pem"
+	secretCAKey     = "ca.pem"
+	secretCAKeyKey  = "ca-key.pem"
+	caValidityRatio = 10 // CA 的有效期是服务证书的 10 倍，服务证书轮转时 caBundle 不变
+
+	// CA 轮转后保存旧 CA 及其保留到的时间，其他副本重新加载前仍可能使用旧 CA 签发的证书
+	secretPreviousCAKey      = "ca-previous.pem"
+	secretPreviousCAUntilKey = "ca-previous-until"
+)
+
+// 自动生成并轮转 Webhook 的证书：自签名 CA 和服务证书保存在 Secret 中，
+// CA 写入 Webhook 配置的 caBundle，服务证书通过 GetCertificate 热加载
+type CertManager struct {
+	client          kubernetes.Interface
+	namespace       string        // Secret 所在的命名空间
+	secretName      string        // 保存证书的 Secret
+	dnsNames        []string      // 服务证书的 DNS 名称
+	mutatingNames   []string      // 需要写入 caBundle 的 MutatingWebhookConfiguration
+	validatingNames []string      // 需要写入 caBundle 的 ValidatingWebhookConfiguration
+	validity        time.Duration // 服务证书的有效期
+	renewBefore     time.Duration // 到期前多久轮转服务证书
+	now             func() time.Time
+
+	mu   sync.RWMutex
+	cert *tls.Certificate // 当前使用的服务证书
+}
+
+func NewCertManager(client kubernetes.Interface, namespace, secretName string, dnsNames []string, validity, renewBefore time.Duration) *CertManager {
+	return &CertManager{
+		client:      client,
+		namespace:   namespace,
+		secretName:  secretName,
+		dnsNames:    dnsNames,
+		validity:    validity,
+		renewBefore: renewBefore,
+		now:         time.Now,
+	}
+}
+
+// Service 的 DNS 名称
+func serviceDNSNames(namespace, name string) []string {
+	return []string{
+		name,
+		fmt.Sprintf("%s.%s", name, namespace),
+		fmt.Sprintf("%s.%s.svc", name, namespace),
+		fmt.Sprintf("%s.%s.svc.cluster.local", name, namespace),
+	}
+}
+
+// 用于 tls.Config 的 GetCertificate，返回当前的服务证书
+func (m *CertManager) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.cert == nil {
+		return nil, fmt.Errorf("no serving certificate loaded")
+	}
+	return m.cert, nil
+}
+
+// 确保 Secret 中有可用的证书，必要时生成或轮转，然后更新 caBundle 和当前的服务证书
+func (m *CertManager) EnsureCertificate(ctx context.Context) error {
+	var data map[string][]byte
+	var caBundle []byte
+	// 其他副本同时更新了 Secret 时重新读取并使用它生成的证书，重试次数有限
+	err := retry.OnError(retry.DefaultRetry, func(err error) bool {
+		if apierrors.IsAlreadyExists(err) || apierrors.IsConflict(err) {
+			glog.Infof("Secret %s/%s was updated concurrently, reloading it", m.namespace, m.secretName)
+			return true
+		}
+		return false
+	}, func() (err error) {
+		data, caBundle, err = m.syncSecret(ctx)
+		return err
+	})
+	if apierrors.IsAlreadyExists(err) || apierrors.IsConflict(err) {
+		return fmt.Errorf("failed to save secret %s/%s: %v", m.namespace, m.secretName, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	// 先更新 caBundle 再切换服务证书，API Server 始终信任正在使用的证书
+	if err := m.patchCABundle(ctx, caBundle); err != nil {
+		return err
+	}
+	cert, err := tls.X509KeyPair(data[secretCertKey], data[secretKeyKey])
+	if err != nil {
+		return fmt.Errorf("failed to load serving certificate: %v", err)
+	}
+	m.mu.Lock()
+	m.cert = &cert
+	m.mu.Unlock()
+	return nil
+}
+
+// 读取 Secret，必要时生成新证书并保存，返回 Secret 中的数据和 caBundle；
+// 保存时的冲突原样返回，由调用者重试
+func (m *CertManager) syncSecret(ctx context.Context) (map[string][]byte, []byte, error) {
+	secret, err := m.client.CoreV1().Secrets(m.namespace).Get(ctx, m.secretName, metav1.GetOptions{})
+	exists := err == nil
+	if apierrors.IsNotFound(err) {
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: m.namespace,
+				Name:      m.secretName,
+				Labels:    map[string]string{"app": "admission-webhook-example"},
+			},
+			Type: corev1.SecretTypeOpaque,
+		}
+	} else if err != nil {
+		return nil, nil, fmt.Errorf("failed to get secret %s/%s: %v", m.namespace, m.secretName, err)
+	}
+
+	data, caBundle, changed, err := m.renew(secret.Data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if changed {
+		secret = secret.DeepCopy()
+		secret.Data = data
+		if !exists {
+			_, err = m.client.CoreV1().Secrets(m.namespace).Create(ctx, secret, metav1.CreateOptions{})
+		} else {
+			_, err = m.client.CoreV1().Secrets(m.namespace).Update(ctx, secret, metav1.UpdateOptions{})
+		}
+		if apierrors.IsAlreadyExists(err) || apierrors.IsConflict(err) {
+			return nil, nil, err
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to save secret %s/%s: %v", m.namespace, m.secretName, err)
+		}
+		glog.Infof("Stored a new serving certificate in secret %s/%s", m.namespace, m.secretName)
+	}
+	return data, caBundle, nil
+}
+
+// 检查 Secret 中的证书，返回需要保存的数据和 caBundle；changed 表示生成了新证书
+func (m *CertManager) renew(current map[string][]byte) (data map[string][]byte, caBundle []byte, changed bool, err error) {
+	now := m.now()
+	data = make(map[string][]byte, len(current))
+	for k, v := range current {
+		data[k] = v
+	}
+
+	ca, caKey, caErr := parseCA(data[secretCAKey], data[secretCAKeyKey])
+	if caErr != nil || now.Add(m.renewBefore).After(ca.NotAfter) {
+		if caErr == nil {
+			glog.Infof("CA in secret %s/%s expires at %v, generating a new one", m.namespace, m.secretName, ca.NotAfter)
+		}
+		if caErr == nil {
+			// 旧 CA 保留到它签发的服务证书过期为止
+			data[secretPreviousCAKey] = data[secretCAKey]
+			data[secretPreviousCAUntilKey] = []byte(servingCertExpiry(data[secretCertKey], ca).Format(time.RFC3339))
+		}
+		ca, caKey, err = m.generateCA(now)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		data[secretCAKey] = pemEncode("CERTIFICATE", ca.Raw)
+		keyDER, err := x509.MarshalECPrivateKey(caKey)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		data[secretCAKeyKey] = pemEncode("EC PRIVATE KEY", keyDER)
+		delete(data, secretCertKey) // 服务证书需要由新 CA 重新签发
+		changed = true
+	}
+	if previousCA, ok := data[secretPreviousCAKey]; ok {
+		until, err := time.Parse(time.RFC3339, string(data[secretPreviousCAUntilKey]))
+		if err != nil || !now.Before(until) {
+			glog.Infof("Removing the previous CA from secret %s/%s", m.namespace, m.secretName)
+			delete(data, secretPreviousCAKey)
+			delete(data, secretPreviousCAUntilKey)
+			changed = true
+		} else {
+			caBundle = previousCA
+		}
+	}
+	caBundle = append(append([]byte(nil), data[secretCAKey]...), caBundle...)
+
+	if reason := m.needsRenewal(data[secretCertKey], data[secretKeyKey], ca, now); reason != "" {
+		glog.Infof("Issuing a new serving certificate: %s", reason)
+		certPEM, keyPEM, err := m.issue(ca, caKey, now)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		data[secretCertKey], data[secretKeyKey] = certPEM, keyPEM
+		changed = true
+	}
+	return data, caBundle, changed, nil
+}
+
+// 返回需要重新签发服务证书的原因，为空表示当前证书可以继续使用
+func (m *CertManager) needsRenewal(certPEM, keyPEM []byte, ca *x509.Certificate, now time.Time) string {
+	if len(certPEM) == 0 {
+		return "no serving certificate"
+	}
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return fmt.Sprintf("invalid serving certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return fmt.Sprintf("invalid serving certificate: %v", err)
+	}
+	if err := cert.CheckSignatureFrom(ca); err != nil {
+		return "serving certificate is not signed by the CA"
+	}
+	if now.Add(m.renewBefore).After(cert.NotAfter) {
+		return fmt.Sprintf("serving certificate expires at %v", cert.NotAfter)
+	}
+	for _, name := range m.dnsNames {
+		if err := cert.VerifyHostname(name); err != nil {
+			return fmt.Sprintf("serving certificate is not valid for %s", name)
+		}
+	}
+	return ""
+}
+
+// 返回 ca 签发的服务证书的过期时间；证书不可用时返回 CA 的过期时间
+func servingCertExpiry(certPEM []byte, ca *x509.Certificate) time.Time {
+	if block, _ := pem.Decode(certPEM); block != nil {
+		if cert, err := x509.ParseCertificate(block.Bytes); err == nil && cert.CheckSignatureFrom(ca) == nil {
+			return cert.NotAfter
+		}
+	}
+	return ca.NotAfter
+}
+
+func (m *CertManager) generateCA(now time.Time) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "admission-webhook-example-ca"},
+		NotBefore:             now.Add(-time.Hour), // 容忍时钟偏差
+		NotAfter:              now.Add(caValidityRatio * m.validity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ca, key, nil
+}
+
+// 用 CA 签发服务证书，返回 PEM 格式的证书和私钥
+func (m *CertManager) issue(ca *x509.Certificate, caKey *ecdsa.PrivateKey, now time.Time) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, nil, err
+	}
+	notAfter := now.Add(m.validity)
+	if notAfter.After(ca.NotAfter) {
+		notAfter = ca.NotAfter
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: m.dnsNames[len(m.dnsNames)-1]},
+		DNSNames:     m.dnsNames,
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pemEncode("CERTIFICATE", der), pemEncode("EC PRIVATE KEY", keyDER), nil
+}
+
+// 把 caBundle 写入所有配置的 Webhook；配置不存在时跳过，下次检查时再更新
+func (m *CertManager) patchCABundle(ctx context.Context, caBundle []byte) error {
+	admissionregistration := m.client.AdmissionregistrationV1()
+	for _, name := range m.mutatingNames {
+		config, err := admissionregistration.MutatingWebhookConfigurations().Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			glog.Warningf("MutatingWebhookConfiguration %s not found, skipping caBundle update", name)
+			continue
+		} else if err != nil {
+			return fmt.Errorf("failed to get MutatingWebhookConfiguration %s: %v", name, err)
+		}
+		updated := false
+		for i := range config.Webhooks {
+			if !bytes.Equal(config.Webhooks[i].ClientConfig.CABundle, caBundle) {
+				config.Webhooks[i].ClientConfig.CABundle = caBundle
+				updated = true
+			}
+		}
+		if !updated {
+			continue
+		}
+		if _, err := admissionregistration.MutatingWebhookConfigurations().Update(ctx, config, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("failed to update caBundle of MutatingWebhookConfiguration %s: %v", name, err)
+		}
+		glog.Infof("Updated caBundle of MutatingWebhookConfiguration %s", name)
+	}
+	for _, name := range m.validatingNames {
+		config, err := admissionregistration.ValidatingWebhookConfigurations().Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			glog.Warningf("ValidatingWebhookConfiguration %s not found, skipping caBundle update", name)
+			continue
+		} else if err != nil {
+			return fmt.Errorf("failed to get ValidatingWebhookConfiguration %s: %v", name, err)
+		}
+		updated := false
+		for i := range config.Webhooks {
+			if !bytes.Equal(config.Webhooks[i].ClientConfig.CABundle, caBundle) {
+				config.Webhooks[i].ClientConfig.CABundle = caBundle
+				updated = true
+			}
+		}
+		if !updated {
+			continue
+		}
+		if _, err := admissionregistration.ValidatingWebhookConfigurations().Update(ctx, config, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("failed to update caBundle of ValidatingWebhookConfiguration %s: %v", name, err)
+		}
+		glog.Infof("Updated caBundle of ValidatingWebhookConfiguration %s", name)
+	}
+	return nil
+}
+
+// 定期检查证书，到期前轮转；同时同步其他副本生成的证书和新创建的 Webhook 配置
+func (m *CertManager) Run(interval time.Duration, stopCh <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+		if err := m.EnsureCertificate(context.Background()); err != nil {
+			glog.Errorf("Failed to check the serving certificate: %v", err)
+		}
+	}
+}
+
+func parseCA(certPEM, keyPEM []byte) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	certBlock, _ := pem.Decode(certPEM)
+	keyBlock, _ := pem.Decode(keyPEM)
+	if certBlock == nil || keyBlock == nil {
+		return nil, nil, fmt.Errorf("no CA found")
+	}
+	ca, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ca, key, nil
+}
+
+func pemEncode(blockType string, der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+}
+
+func randomSerial() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/util/retry"
+)
+
+func newTestCertManager(t *testing.T) (*CertManager, *fake.Clientset) {
+	t.Helper()
+	client := fake.NewSimpleClientset(
+		&admissionregistrationv1.MutatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: "mutating"},
+			Webhooks:   []admissionregistrationv1.MutatingWebhook{{Name: "a.example.com"}, {Name: "b.example.com"}},
+		},
+		&admissionregistrationv1.ValidatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: "validating"},
+			Webhooks:   []admissionregistrationv1.ValidatingWebhook{{Name: "c.example.com"}},
+		},
+	)
+	certs := NewCertManager(client, "webhook", "certs", serviceDNSNames("webhook", "svc"), 24*time.Hour, 6*time.Hour)
+	certs.mutatingNames = []string{"mutating"}
+	certs.validatingNames = []string{"validating", "missing"}
+	return certs, client
+}
+
+// 返回 Webhook 配置中的所有 caBundle
+func caBundles(t *testing.T, client *fake.Clientset) [][]byte {
+	t.Helper()
+	ctx := context.Background()
+	mutating, err := client.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, "mutating", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	validating, err := client.AdmissionregistrationV1().ValidatingWebhookConfigurations().Get(ctx, "validating", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bundles [][]byte
+	for _, webhook := range mutating.Webhooks {
+		bundles = append(bundles, webhook.ClientConfig.CABundle)
+	}
+	for _, webhook := range validating.Webhooks {
+		bundles = append(bundles, webhook.ClientConfig.CABundle)
+	}
+	return bundles
+}
+
+// 用 caBundle 校验当前的服务证书，返回证书
+func verifyServingCert(t *testing.T, certs *CertManager, caBundle []byte, now time.Time) *x509.Certificate {
+	t.Helper()
+	pair, err := certs.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caBundle) {
+		t.Fatalf("invalid caBundle %q", caBundle)
+	}
+	if _, err := cert.Verify(x509.VerifyOptions{
+		DNSName:     "svc.webhook.svc",
+		Roots:       roots,
+		CurrentTime: now,
+	}); err != nil {
+		t.Fatalf("serving certificate does not verify: %v", err)
+	}
+	return cert
+}
+
+func TestCertManagerBootstrapAndRotate(t *testing.T) {
+	certs, client := newTestCertManager(t)
+	ctx := context.Background()
+	if _, err := certs.GetCertificate(nil); err == nil {
+		t.Fatal("expected an error before the certificate is loaded")
+	}
+
+	// 首次启动：生成 CA 和服务证书，写入 Secret 和 caBundle
+	if err := certs.EnsureCertificate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	secret, err := client.CoreV1().Secrets("webhook").Get(ctx, "certs", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{secretCertKey, secretKeyKey, secretCAKey, secretCAKeyKey} {
+		if len(secret.Data[key]) == 0 {
+			t.Errorf("secret has no %s", key)
+		}
+	}
+	bundles := caBundles(t, client)
+	for _, bundle := range bundles {
+		if !bytes.Equal(bundle, secret.Data[secretCAKey]) {
+			t.Fatalf("caBundle = %q, want the CA from the secret", bundle)
+		}
+	}
+	first := verifyServingCert(t, certs, bundles[0], time.Now())
+
+	// 重启后复用 Secret 中的证书
+	restarted, _ := newTestCertManager(t)
+	restarted.client = client
+	if err := restarted.EnsureCertificate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if cert := verifyServingCert(t, restarted, bundles[0], time.Now()); !cert.Equal(first) {
+		t.Error("serving certificate was regenerated although it is still valid")
+	}
+
+	// 临近到期时轮转服务证书，CA 和 caBundle 不变
+	later := time.Now().Add(20 * time.Hour)
+	certs.now = func() time.Time { return later }
+	if err := certs.EnsureCertificate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	rotated := verifyServingCert(t, certs, bundles[0], later)
+	if rotated.Equal(first) {
+		t.Error("serving certificate was not rotated")
+	}
+	for _, bundle := range caBundles(t, client) {
+		if !bytes.Equal(bundle, bundles[0]) {
+			t.Errorf("caBundle changed when rotating the serving certificate")
+		}
+	}
+
+	// 其他副本从 Secret 中获取轮转后的证书
+	restarted.now = certs.now
+	if err := restarted.EnsureCertificate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if cert := verifyServingCert(t, restarted, bundles[0], later); !cert.Equal(rotated) {
+		t.Error("replica did not pick up the rotated certificate")
+	}
+}
+
+func TestCertManagerRotatesCA(t *testing.T) {
+	certs, client := newTestCertManager(t)
+	ctx := context.Background()
+	if err := certs.EnsureCertificate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	oldCA := caBundles(t, client)[0]
+	start := time.Now()
+	at := func(d time.Duration) time.Time {
+		now := start.Add(d)
+		certs.now = func() time.Time { return now }
+		return now
+	}
+
+	// 服务证书轮转，新证书的有效期截止到 CA 到期（240h）
+	at(220 * time.Hour)
+	if err := certs.EnsureCertificate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	oldServing, err := certs.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// CA 的有效期是服务证书的 10 倍，临近到期时生成新的 CA
+	later := at(235 * time.Hour)
+	if err := certs.EnsureCertificate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	bundle := caBundles(t, client)[0]
+	if !bytes.HasSuffix(bundle, oldCA) || bytes.Equal(bundle, oldCA) {
+		t.Fatalf("caBundle should contain the new and the old CA, got %q", bundle)
+	}
+	newCA := bytes.TrimSuffix(bundle, oldCA)
+	verifyServingCert(t, certs, newCA, later)
+	secret, err := client.CoreV1().Secrets("webhook").Get(ctx, "certs", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(secret.Data[secretPreviousCAKey], oldCA) {
+		t.Errorf("secret does not keep the previous CA")
+	}
+
+	// 下一次检查时旧 CA 签发的服务证书仍未过期，其他副本可能还在使用，旧 CA 继续保留
+	if err := certs.EnsureCertificate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	bundle = caBundles(t, client)[0]
+	if !bytes.Equal(bundle, append(append([]byte(nil), newCA...), oldCA...)) {
+		t.Fatalf("old CA was removed from the caBundle before the old serving certificate expired")
+	}
+	leaf, err := x509.ParseCertificate(oldServing.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(bundle)
+	if _, err := leaf.Verify(x509.VerifyOptions{DNSName: "svc.webhook.svc", Roots: roots, CurrentTime: later}); err != nil {
+		t.Errorf("old serving certificate does not verify against the caBundle: %v", err)
+	}
+
+	// 旧的服务证书过期后移除旧 CA
+	at(241 * time.Hour)
+	if err := certs.EnsureCertificate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := caBundles(t, client)[0]; !bytes.Equal(got, newCA) {
+		t.Errorf("old CA was not removed from the caBundle")
+	}
+	secret, err = client.CoreV1().Secrets("webhook").Get(ctx, "certs", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := secret.Data[secretPreviousCAKey]; ok {
+		t.Errorf("secret still keeps the previous CA")
+	}
+}
+
+func TestCertManagerServesRotatedCertificate(t *testing.T) {
+	certs, client := newTestCertManager(t)
+	if err := certs.EnsureCertificate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{GetCertificate: certs.GetCertificate}
+	server.StartTLS()
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(caBundles(t, client)[0])
+	now := time.Now()
+	serial := func() string {
+		conn, err := tls.Dial("tcp", server.Listener.Addr().String(), &tls.Config{
+			RootCAs:    roots,
+			ServerName: "svc.webhook.svc",
+			Time:       func() time.Time { return now },
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0].SerialNumber.String()
+	}
+
+	before := serial()
+	// 证书轮转后新连接使用新证书，无需重启服务
+	now = now.Add(20 * time.Hour)
+	certs.now = func() time.Time { return now }
+	if err := certs.EnsureCertificate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if after := serial(); after == before {
+		t.Error("server still uses the old certificate")
+	}
+}
+
+func TestCertManagerGivesUpOnConflicts(t *testing.T) {
+	certs, client := newTestCertManager(t)
+	creates := 0
+	client.PrependReactor("create", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		creates++
+		return true, nil, apierrors.NewAlreadyExists(corev1.Resource("secrets"), "certs")
+	})
+
+	// Secret 一直冲突时不能无限重试，应返回最后一次的错误
+	err := certs.EnsureCertificate(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("EnsureCertificate() = %v, want the conflict error", err)
+	}
+	if creates != retry.DefaultRetry.Steps {
+		t.Errorf("created the secret %d times, want %d", creates, retry.DefaultRetry.Steps)
+	}
+}
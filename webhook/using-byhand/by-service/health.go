@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+// 就绪检查，返回错误表示尚未就绪
+type readinessCheck struct {
+	name  string
+	check func() error
+}
+
+// 添加就绪检查
+func (whsvr *WebhookServer) addReadinessCheck(name string, check func() error) {
+	whsvr.readinessChecks = append(whsvr.readinessChecks, readinessCheck{name: name, check: check})
+}
+
+// /healthz：进程能处理 HTTP 请求即为存活
+func serveHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, "ok")
+}
+
+// /readyz：所有就绪检查通过时返回 200，否则返回 503 并列出未通过的检查
+func (whsvr *WebhookServer) serveReadyz(w http.ResponseWriter, r *http.Request) {
+	var failures []string
+	for _, c := range whsvr.readinessChecks {
+		if err := c.check(); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", c.name, err))
+		}
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if len(failures) > 0 {
+		glog.Warningf("Not ready: %s", strings.Join(failures, "; "))
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintln(w, strings.Join(failures, "\n"))
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
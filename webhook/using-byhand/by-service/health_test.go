@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHealthAndReadiness(t *testing.T) {
+	w := httptest.NewRecorder()
+	serveHealthz(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("healthz status = %d", w.Code)
+	}
+
+	store := NewPolicyStore(DefaultPolicies())
+	certs, _ := newTestCertManager(t)
+	whsvr := &WebhookServer{policies: store}
+	whsvr.addReadinessCheck("certificates", func() error {
+		_, err := certs.GetCertificate(nil)
+		return err
+	})
+	whsvr.addReadinessCheck("policies", func() error {
+		if !store.Loaded() {
+			return errors.New("policies have not been loaded yet")
+		}
+		return nil
+	})
+	readyz := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		whsvr.serveReadyz(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		return w
+	}
+
+	w = readyz()
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("readyz status = %d, want 503", w.Code)
+	}
+	for _, check := range []string{"certificates: ", "policies: "} {
+		if !strings.Contains(w.Body.String(), check) {
+			t.Errorf("readyz body %q does not report %q", w.Body, check)
+		}
+	}
+
+	if err := certs.EnsureCertificate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	store.Set(DefaultPolicies())
+	if w = readyz(); w.Code != http.StatusOK {
+		t.Errorf("readyz status = %d, want 200: %s", w.Code, w.Body)
+	}
+}
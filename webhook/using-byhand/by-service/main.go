@@ -5,12 +5,19 @@ import (
 	"crypto/tls"
 	"flag"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
 )
 
 func main() {
@@ -20,28 +27,143 @@ func main() {
 	flag.IntVar(&parameters.port, "port", 443, "Webhook server port.")                                                                        // 设置端口，默认 443
 	flag.StringVar(&parameters.certFile, "tlsCertFile", "/etc/webhook/certs/cert.pem", "File containing the x509 Certificate for HTTPS.")     // TLS 证书文件路径
 	flag.StringVar(&parameters.keyFile, "tlsKeyFile", "/etc/webhook/certs/key.pem", "File containing the x509 private key to --tlsCertFile.") // TLS 私钥文件路径
+	flag.StringVar(&parameters.kubeconfig, "kubeconfig", "", "Path to a kubeconfig. The in-cluster config is used when empty.")
+	flag.StringVar(&parameters.policyFile, "policyFile", "", "File containing the required-labels policies. Reloaded when it changes.")
+	flag.StringVar(&parameters.policyConfigMap, "policyConfigMap", "", "ConfigMap containing the required-labels policies, as namespace/name. Reloaded when it changes.")
+	flag.StringVar(&parameters.policyConfigMapKey, "policyConfigMapKey", "policies.yaml", "Key of --policyConfigMap holding the policies.")
+	flag.DurationVar(&parameters.policyReloadInterval, "policyReloadInterval", 10*time.Second, "How often --policyFile is checked for changes.")
+	flag.StringVar(&parameters.auditLogFile, "auditLogFile", "", "File the admission decisions are written to as JSON lines, or - for stdout. Disabled when empty.")
+	flag.IntVar(&parameters.auditLogMaxSize, "auditLogMaxSize", 100, "Maximum size in megabytes of --auditLogFile before it is rotated.")
+	flag.IntVar(&parameters.auditLogMaxBackups, "auditLogMaxBackups", 5, "Number of rotated audit log files to keep.")
+	flag.IntVar(&parameters.auditReportSize, "auditReportSize", 1000, "Number of recent denials and unenforced violations summarized by /report.")
+	flag.StringVar(&parameters.reportAddress, "reportAddress", "", "Address /report is served on over plain HTTP, e.g. 127.0.0.1:8081. The report exposes recent admission requests, so it is disabled when empty.")
+	flag.BoolVar(&parameters.certBootstrap, "certBootstrap", false, "Generate a self-signed CA and serving certificate, store them in --certSecret and patch the caBundle of the webhook configurations instead of reading --tlsCertFile.")
+	flag.StringVar(&parameters.certSecret, "certSecret", "default/admission-webhook-example-certs", "Secret holding the generated certificates, as namespace/name.")
+	flag.StringVar(&parameters.webhookService, "webhookService", "default/admission-webhook-example-svc", "Service of the webhook as namespace/name, used for the DNS names of the generated certificate.")
+	flag.StringVar(&parameters.mutatingWebhookConfig, "mutatingWebhookConfig", "mutating-webhook-example-cfg", "MutatingWebhookConfiguration whose caBundle is patched. Skipped when empty.")
+	flag.StringVar(&parameters.validatingWebhookConfig, "validatingWebhookConfig", "validation-webhook-example-cfg", "ValidatingWebhookConfiguration whose caBundle is patched. Skipped when empty.")
+	flag.DurationVar(&parameters.certValidity, "certValidity", 365*24*time.Hour, "Validity of the generated serving certificate. The CA is valid ten times as long.")
+	flag.DurationVar(&parameters.certRenewBefore, "certRenewBefore", 30*24*time.Hour, "How long before expiry the generated certificate is rotated.")
+	flag.DurationVar(&parameters.certCheckInterval, "certCheckInterval", time.Hour, "How often the generated certificate is checked for rotation.")
 	flag.Parse()
 
-	// 加载 TLS 证书和私钥
-	pair, err := tls.LoadX509KeyPair(parameters.certFile, parameters.keyFile)
-	if err != nil {
-		glog.Errorf("Failed to load key pair: %v", err) // 记录错误信息
+	if parameters.policyFile != "" && parameters.policyConfigMap != "" {
+		glog.Errorf("--policyFile and --policyConfigMap are mutually exclusive")
 		return
 	}
 
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	// 连接 API Server，用于读取命名空间标签、策略 ConfigMap 以及保存自动生成的证书
+	client, err := newClientset(parameters.kubeconfig)
+	if err != nil {
+		glog.Warningf("Running without a Kubernetes client, namespace selectors only see %s: %v", corev1.LabelMetadataName, err)
+	}
+
+	// 加载 TLS 证书和私钥
+	tlsConfig := &tls.Config{}
+	if parameters.certBootstrap {
+		certs, err := newCertManager(client, &parameters)
+		if err != nil {
+			glog.Errorf("Failed to bootstrap certificates: %v", err)
+			return
+		}
+		if err := certs.EnsureCertificate(context.Background()); err != nil {
+			glog.Errorf("Failed to bootstrap certificates: %v", err)
+			return
+		}
+		go certs.Run(parameters.certCheckInterval, stopCh)
+		tlsConfig.GetCertificate = certs.GetCertificate // 证书轮转后无需重启
+	} else {
+		pair, err := tls.LoadX509KeyPair(parameters.certFile, parameters.keyFile)
+		if err != nil {
+			glog.Errorf("Failed to load key pair: %v", err) // 记录错误信息
+			return
+		}
+		tlsConfig.Certificates = []tls.Certificate{pair}
+	}
+
 	// 创建 webhook 服务器实例
 	whsvr := &WebhookServer{
 		server: &http.Server{
-			Addr:      fmt.Sprintf(":%v", parameters.port),                // 绑定到指定的端口
-			TLSConfig: &tls.Config{Certificates: []tls.Certificate{pair}}, // 配置 TLS 证书
+			Addr:      fmt.Sprintf(":%v", parameters.port), // 绑定到指定的端口
+			TLSConfig: tlsConfig,                           // 配置 TLS 证书
+			// API Server 调用 Webhook 的超时时间最长为 30s，超过后的连接没有意义
+			ReadHeaderTimeout: 10 * time.Second,
+			ReadTimeout:       30 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       90 * time.Second,
 		},
+		policies: NewPolicyStore(DefaultPolicies()), // 未配置策略时使用默认策略
+	}
+	if client != nil {
+		if whsvr.namespaceLister, err = StartNamespaceLister(client, stopCh); err != nil {
+			glog.Errorf("Failed to start the namespace cache: %v", err)
+			return
+		}
 	}
 
-	// 定义 HTTP 服务器和处理器
-	mux := http.NewServeMux()                // 创建一个新的 ServeMux
-	mux.HandleFunc("/mutate", whsvr.serve)   // 注册 "/mutate" 路由
-	mux.HandleFunc("/validate", whsvr.serve) // 注册 "/validate" 路由
-	whsvr.server.Handler = mux               // 设置 HTTP 服务器的 Handler
+	// 加载标签策略
+	switch {
+	case parameters.policyFile != "":
+		if err := whsvr.policies.LoadFile(parameters.policyFile); err != nil {
+			glog.Errorf("Failed to load policies: %v", err)
+			return
+		}
+		go whsvr.policies.WatchFile(parameters.policyFile, parameters.policyReloadInterval, stopCh)
+	case parameters.policyConfigMap != "":
+		namespace, name, err := cache.SplitMetaNamespaceKey(parameters.policyConfigMap)
+		if err != nil || namespace == "" || name == "" {
+			glog.Errorf("Invalid --policyConfigMap %q, expect namespace/name", parameters.policyConfigMap)
+			return
+		}
+		if client == nil {
+			glog.Errorf("--policyConfigMap requires a Kubernetes client")
+			return
+		}
+		if err := whsvr.policies.WatchConfigMap(client, namespace, name, parameters.policyConfigMapKey, stopCh); err != nil {
+			glog.Errorf("Failed to watch policies: %v", err)
+			return
+		}
+	}
+
+	// 就绪检查：证书已加载，配置的策略已成功解析
+	whsvr.addReadinessCheck("certificates", func() error {
+		if tlsConfig.GetCertificate == nil {
+			return nil // 启动前已从文件加载
+		}
+		_, err := tlsConfig.GetCertificate(nil)
+		return err
+	})
+	if parameters.policyFile != "" || parameters.policyConfigMap != "" {
+		whsvr.addReadinessCheck("policies", func() error {
+			if !whsvr.policies.Loaded() {
+				return fmt.Errorf("policies have not been loaded yet")
+			}
+			return nil
+		})
+	}
+
+	// 打开审计日志
+	var auditOut io.Writer
+	switch parameters.auditLogFile {
+	case "":
+	case "-":
+		auditOut = os.Stdout
+	default:
+		file, err := openRotatingFile(parameters.auditLogFile, int64(parameters.auditLogMaxSize)<<20, parameters.auditLogMaxBackups)
+		if err != nil {
+			glog.Errorf("Failed to open audit log: %v", err)
+			return
+		}
+		defer file.Close()
+		auditOut = file
+	}
+	whsvr.audit = NewAuditLog(auditOut, parameters.auditReportSize)
+
+	// 设置 HTTP 服务器的 Handler
+	whsvr.server.Handler = newWebhookMux(whsvr)
 
 	// 在新 goroutine 中启动 webhook 服务器
 	go func() {
@@ -51,6 +173,17 @@ func main() {
 		}
 	}()
 
+	// /report 汇总最近的拒绝记录，只在单独的地址上提供
+	var reportServer *http.Server
+	if parameters.reportAddress != "" {
+		reportServer = newReportServer(parameters.reportAddress, whsvr.audit)
+		go func() {
+			if err := reportServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				glog.Errorf("Failed to serve the audit report: %v", err)
+			}
+		}()
+	}
+
 	glog.Info("Server started") // 记录服务器已启动
 
 	// 监听操作系统关闭信号
@@ -60,4 +193,58 @@ func main() {
 
 	glog.Infof("Got OS shutdown signal, shutting down webhook server gracefully...") // 日志记录关闭信号
 	whsvr.server.Shutdown(context.Background())                                      // 优雅地关停 HTTP 服务器
+	if reportServer != nil {
+		reportServer.Shutdown(context.Background())
+	}
+}
+
+// 创建 Webhook 服务器的路由，API Server 可以访问这些路径
+func newWebhookMux(whsvr *WebhookServer) *http.ServeMux {
+	mux := http.NewServeMux()                    // 创建一个新的 ServeMux
+	mux.HandleFunc("/mutate", whsvr.serve)       // 注册 "/mutate" 路由
+	mux.HandleFunc("/validate", whsvr.serve)     // 注册 "/validate" 路由
+	mux.HandleFunc("/healthz", serveHealthz)     // 存活检查
+	mux.HandleFunc("/readyz", whsvr.serveReadyz) // 就绪检查
+	mux.Handle("/metrics", promhttp.Handler())   // Prometheus 指标
+	return mux
+}
+
+// 根据启动参数创建证书管理器
+func newCertManager(client kubernetes.Interface, parameters *WhSvrParameters) (*CertManager, error) {
+	if client == nil {
+		return nil, fmt.Errorf("--certBootstrap requires a Kubernetes client")
+	}
+	secretNamespace, secretName, err := cache.SplitMetaNamespaceKey(parameters.certSecret)
+	if err != nil || secretNamespace == "" || secretName == "" {
+		return nil, fmt.Errorf("invalid --certSecret %q, expect namespace/name", parameters.certSecret)
+	}
+	serviceNamespace, serviceName, err := cache.SplitMetaNamespaceKey(parameters.webhookService)
+	if err != nil || serviceNamespace == "" || serviceName == "" {
+		return nil, fmt.Errorf("invalid --webhookService %q, expect namespace/name", parameters.webhookService)
+	}
+	if parameters.certRenewBefore >= parameters.certValidity {
+		return nil, fmt.Errorf("--certRenewBefore must be shorter than --certValidity")
+	}
+	certs := NewCertManager(client, secretNamespace, secretName, serviceDNSNames(serviceNamespace, serviceName),
+		parameters.certValidity, parameters.certRenewBefore)
+	if parameters.mutatingWebhookConfig != "" {
+		certs.mutatingNames = []string{parameters.mutatingWebhookConfig}
+	}
+	if parameters.validatingWebhookConfig != "" {
+		certs.validatingNames = []string{parameters.validatingWebhookConfig}
+	}
+	return certs, nil
+}
+
+// 创建 Kubernetes 客户端，kubeconfig 为空时使用集群内配置
+func newClientset(kubeconfig string) (kubernetes.Interface, error) {
+	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return clientset, nil
 }
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	admissionv1 "k8s.io/api/admission/v1"
+)
+
+const metricsNamespace = "admission_webhook"
+
+var (
+	admissionDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "admission_duration_seconds",
+		Help:      "Time from receiving an AdmissionReview to having its response, by webhook (mutate or validate).",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 16),
+	}, []string{"webhook"})
+
+	admissionRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "admission_requests_total",
+		Help:      "Number of admission decisions, by webhook, group, kind, namespace and result (allowed or denied).",
+	}, []string{"webhook", "group", "kind", "namespace", "result"})
+
+	patchSize = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "patch_size_bytes",
+		Help:      "Size of the JSON patches returned by the mutating webhook, by group and kind.",
+		Buckets:   prometheus.ExponentialBuckets(64, 2, 12),
+	}, []string{"group", "kind"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		admissionDuration,
+		admissionRequests,
+		patchSize,
+	)
+}
+
+// 记录一次准入决策的指标
+func observeAdmission(webhook string, req *admissionv1.AdmissionRequest, resp *admissionv1.AdmissionResponse, elapsed time.Duration) {
+	admissionDuration.WithLabelValues(webhook).Observe(elapsed.Seconds())
+	result := "allowed"
+	if !resp.Allowed {
+		result = "denied"
+	}
+	admissionRequests.WithLabelValues(webhook, req.Kind.Group, req.Kind.Kind, req.Namespace, result).Inc()
+	if len(resp.Patch) > 0 {
+		patchSize.WithLabelValues(req.Kind.Group, req.Kind.Kind).Observe(float64(len(resp.Patch)))
+	}
+}
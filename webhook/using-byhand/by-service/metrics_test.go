@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestAdmissionMetrics(t *testing.T) {
+	whsvr := &WebhookServer{policies: NewPolicyStore(DefaultPolicies())}
+	ar := admissionReview(t, deploymentKind, &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "d"}})
+	ar.Request.Namespace = "metrics-test"
+
+	denied := admissionRequests.WithLabelValues("validate", "apps", "Deployment", "metrics-test", "denied")
+	allowed := admissionRequests.WithLabelValues("mutate", "apps", "Deployment", "metrics-test", "allowed")
+	deniedBefore, allowedBefore := testutil.ToFloat64(denied), testutil.ToFloat64(allowed)
+	patches := patchSize.WithLabelValues("apps", "Deployment")
+	patchesBefore := sampleCount(t, patches)
+
+	postReview(t, whsvr, "/validate", ar)
+	postReview(t, whsvr, "/mutate", ar)
+
+	if got := testutil.ToFloat64(denied) - deniedBefore; got != 1 {
+		t.Errorf("denied validations = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(allowed) - allowedBefore; got != 1 {
+		t.Errorf("allowed mutations = %v, want 1", got)
+	}
+	if got := sampleCount(t, patches) - patchesBefore; got != 1 {
+		t.Errorf("observed patches = %v, want 1", got)
+	}
+	if n := testutil.CollectAndCount(admissionDuration, "admission_webhook_admission_duration_seconds"); n < 2 {
+		t.Errorf("latency histograms = %d, want one per webhook", n)
+	}
+}
+
+// 返回直方图的样本数
+func sampleCount(t *testing.T, observer prometheus.Observer) uint64 {
+	t.Helper()
+	var metric dto.Metric
+	if err := observer.(prometheus.Metric).Write(&metric); err != nil {
+		t.Fatal(err)
+	}
+	return metric.GetHistogram().GetSampleCount()
+}
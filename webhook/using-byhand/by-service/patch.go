@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// 补丁操作结构体
+type patchOperation struct {
+	Op    string      `json:"op"`    // 操作类型（add、replace、remove）
+	Path  string      `json:"path"`  // 操作的路径（JSON Pointer）
+	Value interface{} `json:"value"` // 操作的值，remove 操作没有值
+}
+
+// remove 操作不能带 value，其他操作即使值为空字符串也必须带 value
+func (op patchOperation) MarshalJSON() ([]byte, error) {
+	if op.Op == "remove" {
+		return json.Marshal(struct {
+			Op   string `json:"op"`
+			Path string `json:"path"`
+		}{op.Op, op.Path})
+	}
+	type operation patchOperation // 避免递归调用 MarshalJSON
+	return json.Marshal(operation(op))
+}
+
+// 按 RFC 6901 转义 JSON Pointer 中的一段："~" 转为 "~0"，"/" 转为 "~1"
+var jsonPointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+func escapeJSONPointer(token string) string {
+	return jsonPointerEscaper.Replace(token)
+}
+
+// 比较原对象和修改后的对象，生成把原对象变为修改后对象的 RFC 6902 JSON Patch。
+// 对象按字段逐一比较，数组发生变化时整体替换
+func createPatch(original, mutated map[string]interface{}) []patchOperation {
+	return diffObjects("", original, mutated, nil)
+}
+
+func diffObjects(path string, original, mutated map[string]interface{}, patch []patchOperation) []patchOperation {
+	// 按 key 排序，保证生成的补丁稳定
+	keys := make([]string, 0, len(original)+len(mutated))
+	for key := range original {
+		keys = append(keys, key)
+	}
+	for key := range mutated {
+		if _, ok := original[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		keyPath := path + "/" + escapeJSONPointer(key)
+		before, inOriginal := original[key]
+		after, inMutated := mutated[key]
+		switch {
+		case !inMutated:
+			patch = append(patch, patchOperation{Op: "remove", Path: keyPath})
+		case !inOriginal:
+			patch = append(patch, patchOperation{Op: "add", Path: keyPath, Value: after})
+		default:
+			patch = diffValues(keyPath, before, after, patch)
+		}
+	}
+	return patch
+}
+
+func diffValues(path string, original, mutated interface{}, patch []patchOperation) []patchOperation {
+	originalObject, ok1 := original.(map[string]interface{})
+	mutatedObject, ok2 := mutated.(map[string]interface{})
+	if ok1 && ok2 {
+		return diffObjects(path, originalObject, mutatedObject, patch)
+	}
+	if reflect.DeepEqual(original, mutated) {
+		return patch
+	}
+	return append(patch, patchOperation{Op: "replace", Path: path, Value: mutated})
+}
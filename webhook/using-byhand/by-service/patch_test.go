@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	jsonpatch "github.com/evanphx/json-patch"
+)
+
+// 把补丁应用到 original 上并返回结果
+func applyPatch(t *testing.T, original []byte, patch []byte) map[string]interface{} {
+	t.Helper()
+	decoded, err := jsonpatch.DecodePatch(patch)
+	if err != nil {
+		t.Fatalf("invalid patch %s: %v", patch, err)
+	}
+	patched, err := decoded.Apply(original)
+	if err != nil {
+		t.Fatalf("failed to apply patch %s: %v", patch, err)
+	}
+	result := map[string]interface{}{}
+	if err := json.Unmarshal(patched, &result); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestCreatePatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		original string
+		mutated  string
+		patch    string
+	}{
+		{
+			name:     "no change",
+			original: `{"metadata": {"labels": {"a": "1"}}}`,
+			mutated:  `{"metadata": {"labels": {"a": "1"}}}`,
+			patch:    `null`,
+		},
+		{
+			name:     "add keys to an existing map",
+			original: `{"metadata": {"labels": {"app": "web"}}}`,
+			mutated:  `{"metadata": {"labels": {"app": "web", "app.kubernetes.io/name": "web", "team": ""}}}`,
+			patch: `[{"op": "add", "path": "/metadata/labels/app.kubernetes.io~1name", "value": "web"},
+			         {"op": "add", "path": "/metadata/labels/team", "value": ""}]`,
+		},
+		{
+			name:     "add a missing map",
+			original: `{"metadata": {"name": "web"}}`,
+			mutated:  `{"metadata": {"name": "web", "annotations": {"example.com/status": "mutated"}}}`,
+			patch:    `[{"op": "add", "path": "/metadata/annotations", "value": {"example.com/status": "mutated"}}]`,
+		},
+		{
+			name:     "replace and remove",
+			original: `{"metadata": {"annotations": {"a~b/c": "old", "gone": "x"}}}`,
+			mutated:  `{"metadata": {"annotations": {"a~b/c": "new"}}}`,
+			patch: `[{"op": "replace", "path": "/metadata/annotations/a~0b~1c", "value": "new"},
+			         {"op": "remove", "path": "/metadata/annotations/gone"}]`,
+		},
+		{
+			name:     "arrays are replaced",
+			original: `{"spec": {"containers": [{"name": "a"}], "replicas": 1}}`,
+			mutated:  `{"spec": {"containers": [{"name": "a"}, {"name": "b"}], "replicas": 1}}`,
+			patch:    `[{"op": "replace", "path": "/spec/containers", "value": [{"name": "a"}, {"name": "b"}]}]`,
+		},
+		{
+			name:     "type change",
+			original: `{"spec": {"value": {"a": 1}}}`,
+			mutated:  `{"spec": {"value": "a"}}`,
+			patch:    `[{"op": "replace", "path": "/spec/value", "value": "a"}]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var original, mutated map[string]interface{}
+			if err := json.Unmarshal([]byte(tt.original), &original); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(tt.mutated), &mutated); err != nil {
+				t.Fatal(err)
+			}
+			patch, err := json.Marshal(createPatch(original, mutated))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got, want interface{}
+			if err := json.Unmarshal(patch, &got); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(tt.patch), &want); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("patch = %s, want %s", patch, tt.patch)
+			}
+			if string(patch) == "null" {
+				return
+			}
+			if result := applyPatch(t, []byte(tt.original), patch); !reflect.DeepEqual(result, mutated) {
+				t.Errorf("patched object = %v, want %v", result, mutated)
+			}
+		})
+	}
+}
+
+func TestEscapeJSONPointer(t *testing.T) {
+	for token, want := range map[string]string{
+		"app":                    "app",
+		"app.kubernetes.io/name": "app.kubernetes.io~1name",
+		"a~b":                    "a~0b",
+		"~/":                     "~0~1",
+		"~1":                     "~01",
+	} {
+		if got := escapeJSONPointer(token); got != want {
+			t.Errorf("escapeJSONPointer(%q) = %q, want %q", token, got, want)
+		}
+	}
+}
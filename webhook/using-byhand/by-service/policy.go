@@ -0,0 +1,405 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// 策略配置文件（或 ConfigMap 中）的内容
+type PolicyConfig struct {
+	Policies []LabelPolicy `json:"policies"`
+}
+
+// 标签策略：要求匹配的对象带有一组标签
+type LabelPolicy struct {
+	Name string `json:"name"`
+	// 校验失败时的处理方式，默认为 enforce
+	Mode EnforcementMode `json:"mode,omitempty"`
+	// 目标资源类型，为空时匹配所有类型
+	Kinds []KindMatcher `json:"kinds,omitempty"`
+	// 命名空间选择器，为空时匹配所有命名空间
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+	// 必需的标签
+	RequiredLabels []LabelRequirement `json:"requiredLabels"`
+}
+
+// 策略校验失败时的处理方式
+type EnforcementMode string
+
+const (
+	ModeEnforce EnforcementMode = "enforce" // 拒绝请求
+	ModeWarn    EnforcementMode = "warn"    // 允许请求，并通过 Warnings 返回给客户端
+	ModeAudit   EnforcementMode = "audit"   // 允许请求，只在审计日志中记录
+
+	// 命名空间上的该标签覆盖其中所有策略的处理方式
+	enforcementModeLabel = "admission-webhook-example.qikqiak.com/mode"
+)
+
+func parseEnforcementMode(value string) (EnforcementMode, error) {
+	switch mode := EnforcementMode(value); mode {
+	case ModeEnforce, ModeWarn, ModeAudit:
+		return mode, nil
+	}
+	return "", fmt.Errorf("invalid mode %q, expect one of %s, %s, %s", value, ModeEnforce, ModeWarn, ModeAudit)
+}
+
+// 资源类型匹配条件，字段为空或 "*" 时匹配任意值
+type KindMatcher struct {
+	Group   string `json:"group,omitempty"`
+	Version string `json:"version,omitempty"`
+	Kind    string `json:"kind,omitempty"`
+}
+
+// 单个必需标签
+type LabelRequirement struct {
+	Key string `json:"key"`
+	// 标签值必须完整匹配的正则表达式，为空时只要求标签存在
+	AllowedValues string `json:"allowedValues,omitempty"`
+}
+
+// 策略校验失败的原因
+type Violation struct {
+	Policy  string
+	Mode    EnforcementMode // 考虑命名空间标签后的处理方式
+	Message string
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("policy %s: %s", v.Policy, v.Message)
+}
+
+// 编译后的策略
+type compiledPolicy struct {
+	LabelPolicy
+	namespaceSelector labels.Selector
+	allowedValues     map[string]*regexp.Regexp
+}
+
+// 一组编译后的策略，创建后不再修改，可以并发读取
+type PolicySet struct {
+	policies []*compiledPolicy
+}
+
+// 默认策略：Deployment 和 Service 必须带有全部推荐标签
+func DefaultPolicies() *PolicySet {
+	policy := LabelPolicy{
+		Name: "recommended-labels",
+		Kinds: []KindMatcher{
+			{Group: "apps", Kind: "Deployment"},
+			{Group: "", Kind: "Service"},
+		},
+	}
+	for _, key := range requiredLabels {
+		policy.RequiredLabels = append(policy.RequiredLabels, LabelRequirement{Key: key})
+	}
+	set, err := CompilePolicies(PolicyConfig{Policies: []LabelPolicy{policy}})
+	if err != nil {
+		panic(err)
+	}
+	return set
+}
+
+// 解析 YAML 或 JSON 格式的策略配置
+func ParsePolicies(data []byte) (*PolicySet, error) {
+	var config PolicyConfig
+	decoder := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 4096)
+	if err := decoder.Decode(&config); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return CompilePolicies(config)
+}
+
+// 校验并编译策略
+func CompilePolicies(config PolicyConfig) (*PolicySet, error) {
+	set := &PolicySet{}
+	names := make(map[string]bool)
+	for i, policy := range config.Policies {
+		if policy.Name == "" {
+			return nil, fmt.Errorf("policies[%d]: name is required", i)
+		}
+		if names[policy.Name] {
+			return nil, fmt.Errorf("policy %s: duplicate name", policy.Name)
+		}
+		names[policy.Name] = true
+		if len(policy.RequiredLabels) == 0 {
+			return nil, fmt.Errorf("policy %s: requiredLabels must not be empty", policy.Name)
+		}
+		if policy.Mode == "" {
+			policy.Mode = ModeEnforce
+		} else if _, err := parseEnforcementMode(string(policy.Mode)); err != nil {
+			return nil, fmt.Errorf("policy %s: %v", policy.Name, err)
+		}
+
+		compiled := &compiledPolicy{
+			LabelPolicy:       policy,
+			namespaceSelector: labels.Everything(),
+			allowedValues:     make(map[string]*regexp.Regexp),
+		}
+		if policy.NamespaceSelector != nil {
+			selector, err := metav1.LabelSelectorAsSelector(policy.NamespaceSelector)
+			if err != nil {
+				return nil, fmt.Errorf("policy %s: invalid namespaceSelector: %v", policy.Name, err)
+			}
+			compiled.namespaceSelector = selector
+		}
+		for _, requirement := range policy.RequiredLabels {
+			if requirement.Key == "" {
+				return nil, fmt.Errorf("policy %s: label key is required", policy.Name)
+			}
+			if requirement.AllowedValues == "" {
+				continue
+			}
+			// 要求完整匹配标签值
+			re, err := regexp.Compile("^(?:" + requirement.AllowedValues + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("policy %s: invalid allowedValues of %s: %v", policy.Name, requirement.Key, err)
+			}
+			compiled.allowedValues[requirement.Key] = re
+		}
+		set.policies = append(set.policies, compiled)
+	}
+	return set, nil
+}
+
+func (m KindMatcher) matches(gvk metav1.GroupVersionKind) bool {
+	match := func(pattern, value string) bool {
+		return pattern == "" || pattern == "*" || pattern == value
+	}
+	return match(m.Group, gvk.Group) && match(m.Version, gvk.Version) && match(m.Kind, gvk.Kind)
+}
+
+func (p *compiledPolicy) appliesTo(gvk metav1.GroupVersionKind, namespaceLabels labels.Set) bool {
+	if !p.namespaceSelector.Matches(namespaceLabels) {
+		return false
+	}
+	if len(p.Kinds) == 0 {
+		return true
+	}
+	for _, kind := range p.Kinds {
+		if kind.matches(gvk) {
+			return true
+		}
+	}
+	return false
+}
+
+// 检查对象标签，返回所有适用策略的校验失败原因。
+// 命名空间带有 enforcementModeLabel 标签时，以标签值作为所有策略的处理方式
+func (s *PolicySet) Check(gvk metav1.GroupVersionKind, namespaceLabels labels.Set, objectLabels map[string]string) []Violation {
+	var namespaceMode EnforcementMode
+	if value, ok := namespaceLabels[enforcementModeLabel]; ok {
+		mode, err := parseEnforcementMode(value)
+		if err != nil {
+			glog.Errorf("Ignoring label %s of namespace %s: %v", enforcementModeLabel, namespaceLabels[corev1.LabelMetadataName], err)
+		}
+		namespaceMode = mode
+	}
+
+	var violations []Violation
+	for _, policy := range s.policies {
+		if !policy.appliesTo(gvk, namespaceLabels) {
+			continue
+		}
+		mode := policy.Mode
+		if namespaceMode != "" {
+			mode = namespaceMode
+		}
+		for _, requirement := range policy.RequiredLabels {
+			value, ok := objectLabels[requirement.Key]
+			if !ok {
+				violations = append(violations, Violation{
+					Policy:  policy.Name,
+					Mode:    mode,
+					Message: fmt.Sprintf("missing label %s", requirement.Key),
+				})
+				continue
+			}
+			if re := policy.allowedValues[requirement.Key]; re != nil && !re.MatchString(value) {
+				violations = append(violations, Violation{
+					Policy:  policy.Name,
+					Mode:    mode,
+					Message: fmt.Sprintf("label %s=%q does not match %s", requirement.Key, value, requirement.AllowedValues),
+				})
+			}
+		}
+	}
+	return violations
+}
+
+// 保存当前生效的策略，支持热加载
+type PolicyStore struct {
+	mu      sync.RWMutex
+	set     *PolicySet
+	loaded  bool      // 是否从文件或 ConfigMap 成功加载过策略
+	modTime time.Time // 最近一次加载的策略文件的修改时间
+}
+
+func NewPolicyStore(set *PolicySet) *PolicyStore {
+	return &PolicyStore{set: set}
+}
+
+// 返回当前生效的策略
+func (s *PolicyStore) Get() *PolicySet {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.set
+}
+
+// 替换当前生效的策略
+func (s *PolicyStore) Set(set *PolicySet) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.set = set
+	s.loaded = true
+}
+
+// 是否通过 Set 或 LoadFile 加载过策略，仍在使用创建时的策略时返回 false
+func (s *PolicyStore) Loaded() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.loaded
+}
+
+// 从文件加载策略
+func (s *PolicyStore) LoadFile(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	set, err := ParsePolicies(data)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.set = set
+	s.loaded = true
+	s.modTime = info.ModTime()
+	return nil
+}
+
+// 定期检查策略文件，文件变化时重新加载；加载失败时保留原有策略
+func (s *PolicyStore) WatchFile(path string, interval time.Duration, stopCh <-chan struct{}) {
+	s.mu.RLock()
+	lastModified := s.modTime
+	s.mu.RUnlock()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+		// 挂载的 ConfigMap 通过替换符号链接更新，Stat 会跟随链接
+		info, err := os.Stat(path)
+		if err != nil {
+			glog.Errorf("Failed to stat policy file %s: %v", path, err)
+			continue
+		}
+		if info.ModTime().Equal(lastModified) {
+			continue
+		}
+		lastModified = info.ModTime()
+		if err := s.LoadFile(path); err != nil {
+			glog.Errorf("Failed to reload policies, keeping the previous ones: %v", err)
+			continue
+		}
+		glog.Infof("Reloaded policies from %s", path)
+	}
+}
+
+// 监听 ConfigMap 中 key 对应的策略，变化时重新加载；加载失败时保留原有策略
+func (s *PolicyStore) WatchConfigMap(client kubernetes.Interface, namespace, name, key string, stopCh <-chan struct{}) error {
+	factory := informers.NewSharedInformerFactoryWithOptions(client, 0,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", name).String()
+		}),
+	)
+	informer := factory.Core().V1().ConfigMaps().Informer()
+	load := func(obj interface{}) {
+		configMap, ok := obj.(*corev1.ConfigMap)
+		if !ok {
+			return
+		}
+		data, ok := configMap.Data[key]
+		if !ok {
+			glog.Errorf("ConfigMap %s/%s has no key %s, keeping the previous policies", namespace, name, key)
+			return
+		}
+		set, err := ParsePolicies([]byte(data))
+		if err != nil {
+			glog.Errorf("Failed to load policies from ConfigMap %s/%s, keeping the previous ones: %v", namespace, name, err)
+			return
+		}
+		s.Set(set)
+		glog.Infof("Loaded policies from ConfigMap %s/%s (resourceVersion %s)", namespace, name, configMap.ResourceVersion)
+	}
+	if _, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    load,
+		UpdateFunc: func(_, obj interface{}) { load(obj) },
+		DeleteFunc: func(interface{}) {
+			glog.Warningf("ConfigMap %s/%s was deleted, keeping the previous policies", namespace, name)
+		},
+	}); err != nil {
+		return err
+	}
+	factory.Start(stopCh)
+	if !cache.WaitForCacheSync(stopCh, informer.HasSynced) {
+		return fmt.Errorf("timed out waiting for ConfigMap %s/%s", namespace, name)
+	}
+	return nil
+}
+
+// 启动命名空间 informer，用于匹配策略的 namespaceSelector
+func StartNamespaceLister(client kubernetes.Interface, stopCh <-chan struct{}) (corelisters.NamespaceLister, error) {
+	factory := informers.NewSharedInformerFactory(client, 0)
+	namespaces := factory.Core().V1().Namespaces()
+	informer := namespaces.Informer()
+	factory.Start(stopCh)
+	if !cache.WaitForCacheSync(stopCh, informer.HasSynced) {
+		return nil, fmt.Errorf("timed out waiting for the namespace cache to sync")
+	}
+	return namespaces.Lister(), nil
+}
+
+// 返回命名空间的标签；无法获取时只包含 kubernetes.io/metadata.name
+func namespaceLabels(lister corelisters.NamespaceLister, namespace string) labels.Set {
+	set := labels.Set{corev1.LabelMetadataName: namespace}
+	if lister == nil || namespace == "" {
+		return set
+	}
+	ns, err := lister.Get(namespace)
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			glog.Errorf("Failed to get namespace %s: %v", namespace, err)
+		}
+		return set
+	}
+	for k, v := range ns.Labels {
+		set[k] = v
+	}
+	return set
+}
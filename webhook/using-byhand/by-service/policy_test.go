@@ -0,0 +1,374 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const testPolicies = `
+policies:
+- name: team
+  namespaceSelector:
+    matchLabels:
+      env: prod
+  requiredLabels:
+  - key: team
+- name: versioned-workloads
+  kinds:
+  - group: apps
+    kind: "*"
+  - group: batch.example.com
+    version: v1
+    kind: Job
+  requiredLabels:
+  - key: app.kubernetes.io/version
+    allowedValues: 'v?\d+\.\d+\.\d+'
+`
+
+var (
+	deploymentKind = metav1.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}
+	serviceKind    = metav1.GroupVersionKind{Version: "v1", Kind: "Service"}
+	crdKind        = metav1.GroupVersionKind{Group: "batch.example.com", Version: "v1", Kind: "Job"}
+)
+
+func TestPolicySetCheck(t *testing.T) {
+	set, err := ParsePolicies([]byte(testPolicies))
+	if err != nil {
+		t.Fatal(err)
+	}
+	prod := labels.Set{"env": "prod"}
+	tests := []struct {
+		name       string
+		kind       metav1.GroupVersionKind
+		namespace  labels.Set
+		labels     map[string]string
+		violations []string
+	}{
+		{"service outside prod", serviceKind, labels.Set{}, nil, nil},
+		{"service in prod", serviceKind, prod, nil, []string{"policy team: missing label team"}},
+		{"deployment without version", deploymentKind, labels.Set{}, map[string]string{}, []string{
+			"policy versioned-workloads: missing label app.kubernetes.io/version",
+		}},
+		{"deployment with bad version", deploymentKind, prod, map[string]string{"team": "a", "app.kubernetes.io/version": "latest"}, []string{
+			`policy versioned-workloads: label app.kubernetes.io/version="latest" does not match v?\d+\.\d+\.\d+`,
+		}},
+		{"partial match is not enough", deploymentKind, labels.Set{}, map[string]string{"app.kubernetes.io/version": "1.2.3-rc"}, []string{
+			`policy versioned-workloads: label app.kubernetes.io/version="1.2.3-rc" does not match v?\d+\.\d+\.\d+`,
+		}},
+		{"custom resource", crdKind, labels.Set{}, map[string]string{"app.kubernetes.io/version": "v1.0.0"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, v := range set.Check(tt.kind, tt.namespace, tt.labels) {
+				got = append(got, v.String())
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.violations, "\n") {
+				t.Errorf("violations = %q, want %q", got, tt.violations)
+			}
+		})
+	}
+}
+
+func TestParsePoliciesErrors(t *testing.T) {
+	for name, doc := range map[string]string{
+		"missing name":      `policies: [{requiredLabels: [{key: a}]}]`,
+		"duplicate name":    `policies: [{name: a, requiredLabels: [{key: a}]}, {name: a, requiredLabels: [{key: b}]}]`,
+		"no labels":         `policies: [{name: a}]`,
+		"empty key":         `policies: [{name: a, requiredLabels: [{allowedValues: x}]}]`,
+		"invalid regex":     `policies: [{name: a, requiredLabels: [{key: a, allowedValues: "("}]}]`,
+		"invalid selector":  `policies: [{name: a, namespaceSelector: {matchExpressions: [{key: a, operator: Bogus}]}, requiredLabels: [{key: a}]}]`,
+		"invalid mode":      `policies: [{name: a, mode: deny, requiredLabels: [{key: a}]}]`,
+		"malformed content": `policies: {`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParsePolicies([]byte(doc)); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func admissionReview(t *testing.T, kind metav1.GroupVersionKind, obj runtime.Object) *admissionv1.AdmissionReview {
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &admissionv1.AdmissionReview{
+		Request: &admissionv1.AdmissionRequest{
+			UID:       "uid",
+			Kind:      kind,
+			Namespace: "default",
+			Operation: admissionv1.Create,
+			Object:    runtime.RawExtension{Raw: raw},
+		},
+	}
+}
+
+func TestValidateWithDefaultPolicies(t *testing.T) {
+	whsvr := &WebhookServer{policies: NewPolicyStore(DefaultPolicies())}
+	complete := make(map[string]string)
+	for _, key := range requiredLabels {
+		complete[key] = "x"
+	}
+
+	tests := []struct {
+		name    string
+		kind    metav1.GroupVersionKind
+		meta    metav1.ObjectMeta
+		allowed bool
+	}{
+		{"deployment without labels", deploymentKind, metav1.ObjectMeta{Name: "d"}, false},
+		{"deployment with labels", deploymentKind, metav1.ObjectMeta{Name: "d", Labels: complete}, true},
+		{"opted out", deploymentKind, metav1.ObjectMeta{Name: "d", Annotations: map[string]string{admissionWebhookAnnotationValidateKey: "false"}}, true},
+		{"kind without policy", crdKind, metav1.ObjectMeta{Name: "j"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := &metav1.PartialObjectMetadata{ObjectMeta: tt.meta}
+			resp := whsvr.validate(admissionReview(t, tt.kind, obj))
+			if resp.Allowed != tt.allowed {
+				t.Errorf("allowed = %v, want %v (%+v)", resp.Allowed, tt.allowed, resp.Result)
+			}
+			if !resp.Allowed && !strings.Contains(resp.Result.Message, "missing label "+nameLabel) {
+				t.Errorf("unexpected message %q", resp.Result.Message)
+			}
+		})
+	}
+}
+
+func TestSamplePolicyConfigMap(t *testing.T) {
+	f, err := os.Open(filepath.Join("deployment", "policy-configmap.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var configMap corev1.ConfigMap
+	if err := utilyaml.NewYAMLOrJSONDecoder(f, 4096).Decode(&configMap); err != nil {
+		t.Fatal(err)
+	}
+	set, err := ParsePolicies([]byte(configMap.Data["policies.yaml"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	withVersion := func(version string) map[string]string {
+		objectLabels := make(map[string]string, len(addLabels))
+		for key, value := range addLabels {
+			objectLabels[key] = value
+		}
+		objectLabels[versionLabel] = version
+		return objectLabels
+	}
+	tests := []struct {
+		name       string
+		labels     map[string]string
+		violations int
+	}{
+		// deployment/sleep.yaml 经过 Mutating Webhook 后的标签
+		{"labels added by the mutating webhook", addLabels, 0},
+		{"semantic version", withVersion("v1.2.3"), 0},
+		{"invalid version", withVersion("latest"), 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations := set.Check(deploymentKind, labels.Set{}, tt.labels)
+			if len(violations) != tt.violations {
+				t.Errorf("violations = %v, want %d", violations, tt.violations)
+			}
+		})
+	}
+}
+
+func TestValidateEnforcementModes(t *testing.T) {
+	set, err := ParsePolicies([]byte(`
+policies:
+- name: owner
+  requiredLabels: [{key: team}]
+- name: cost
+  mode: warn
+  requiredLabels: [{key: cost-center}]
+- name: tier
+  mode: audit
+  requiredLabels: [{key: tier}]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := fake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "staging", Labels: map[string]string{enforcementModeLabel: "warn"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "prod", Labels: map[string]string{enforcementModeLabel: "enforce"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "typo", Labels: map[string]string{enforcementModeLabel: "strict"}}},
+	)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	lister, err := StartNamespaceLister(client, stopCh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	whsvr := &WebhookServer{policies: NewPolicyStore(set), namespaceLister: lister}
+
+	tests := []struct {
+		namespace  string
+		labels     map[string]string
+		allowed    bool
+		denied     string
+		warnings   []string
+		unenforced string
+	}{
+		{
+			namespace:  "default",
+			allowed:    false,
+			denied:     "policy owner: missing label team",
+			warnings:   []string{"policy cost: missing label cost-center"},
+			unenforced: "policy cost: missing label cost-center; policy tier: missing label tier",
+		},
+		{
+			namespace:  "default",
+			labels:     map[string]string{"team": "a"},
+			allowed:    true,
+			warnings:   []string{"policy cost: missing label cost-center"},
+			unenforced: "policy cost: missing label cost-center; policy tier: missing label tier",
+		},
+		{
+			namespace: "default",
+			labels:    map[string]string{"team": "a", "cost-center": "1", "tier": "web"},
+			allowed:   true,
+		},
+		{
+			namespace: "staging",
+			allowed:   true,
+			warnings: []string{
+				"policy owner: missing label team",
+				"policy cost: missing label cost-center",
+				"policy tier: missing label tier",
+			},
+			unenforced: "policy owner: missing label team; policy cost: missing label cost-center; policy tier: missing label tier",
+		},
+		{
+			namespace: "prod",
+			allowed:   false,
+			denied:    "policy owner: missing label team; policy cost: missing label cost-center; policy tier: missing label tier",
+		},
+		{
+			// 无效的标签值被忽略，使用策略中的处理方式
+			namespace:  "typo",
+			labels:     map[string]string{"team": "a"},
+			allowed:    true,
+			warnings:   []string{"policy cost: missing label cost-center"},
+			unenforced: "policy cost: missing label cost-center; policy tier: missing label tier",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.namespace, func(t *testing.T) {
+			obj := &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Name: "d", Labels: tt.labels}}
+			ar := admissionReview(t, deploymentKind, obj)
+			ar.Request.Namespace = tt.namespace
+			resp := whsvr.validate(ar)
+			if resp.Allowed != tt.allowed {
+				t.Errorf("allowed = %v, want %v", resp.Allowed, tt.allowed)
+			}
+			var denied string
+			if resp.Result != nil {
+				denied = resp.Result.Message
+			}
+			if denied != tt.denied {
+				t.Errorf("denied = %q, want %q", denied, tt.denied)
+			}
+			if strings.Join(resp.Warnings, "\n") != strings.Join(tt.warnings, "\n") {
+				t.Errorf("warnings = %q, want %q", resp.Warnings, tt.warnings)
+			}
+			if got := resp.AuditAnnotations[violationsAuditAnnotation]; got != tt.unenforced {
+				t.Errorf("unenforced = %q, want %q", got, tt.unenforced)
+			}
+		})
+	}
+}
+
+func TestPolicyStoreWatchFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policies.yaml")
+	if err := os.WriteFile(path, []byte(`policies: [{name: a, requiredLabels: [{key: a}]}]`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	store := NewPolicyStore(DefaultPolicies())
+	if err := store.LoadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go store.WatchFile(path, 10*time.Millisecond, stopCh)
+
+	update := func(content string) {
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		// 确保修改时间发生变化
+		later := time.Now().Add(time.Duration(len(content)) * time.Second)
+		if err := os.Chtimes(path, later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor := func(key string) {
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			if v := store.Get().Check(serviceKind, labels.Set{}, nil); len(v) == 1 && strings.HasSuffix(v[0].Message, " "+key) {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("policies requiring %s were not loaded", key)
+	}
+
+	waitFor("a")
+	update(`policies: [{name: b, requiredLabels: [{key: b}]}]`)
+	waitFor("b")
+	// 无效的策略不会替换当前策略
+	update(`policies: [{name: c}] # invalid`)
+	time.Sleep(100 * time.Millisecond)
+	waitFor("b")
+}
+
+func TestPolicyStoreWatchConfigMap(t *testing.T) {
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "webhook", Name: "policies"},
+		Data:       map[string]string{"policies.yaml": `policies: [{name: a, requiredLabels: [{key: a}]}]`},
+	}
+	client := fake.NewSimpleClientset(configMap)
+	store := NewPolicyStore(DefaultPolicies())
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	if err := store.WatchConfigMap(client, "webhook", "policies", "policies.yaml", stopCh); err != nil {
+		t.Fatal(err)
+	}
+	if v := store.Get().Check(serviceKind, labels.Set{}, nil); len(v) != 1 || v[0].Policy != "a" {
+		t.Fatalf("violations = %v, want policy a", v)
+	}
+
+	configMap = configMap.DeepCopy()
+	configMap.Data["policies.yaml"] = `policies: [{name: b, requiredLabels: [{key: b}]}]`
+	if _, err := client.CoreV1().ConfigMaps("webhook").Update(context.Background(), configMap, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if v := store.Get().Check(serviceKind, labels.Set{}, nil); len(v) == 1 && v[0].Policy == "b" {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("updated policies were not loaded")
+}
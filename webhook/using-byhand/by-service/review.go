@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// 解码 admission.k8s.io/v1 或 v1beta1 的 AdmissionReview。
+// v1beta1 的请求转换为 v1 处理，返回的 GroupVersionKind 用于以相同版本响应
+func decodeAdmissionReview(body []byte) (*admissionv1.AdmissionReview, schema.GroupVersionKind, error) {
+	obj, gvk, err := deserializer.Decode(body, nil, nil)
+	if runtime.IsNotRegisteredError(err) {
+		return nil, admissionv1.SchemeGroupVersion.WithKind("AdmissionReview"),
+			fmt.Errorf("unsupported %v, expect AdmissionReview in %s or %s", gvk, admissionv1.SchemeGroupVersion, admissionv1beta1.SchemeGroupVersion)
+	}
+	if err != nil {
+		return nil, admissionv1.SchemeGroupVersion.WithKind("AdmissionReview"), err
+	}
+	switch review := obj.(type) {
+	case *admissionv1.AdmissionReview:
+		return review, *gvk, nil
+	case *admissionv1beta1.AdmissionReview:
+		return &admissionv1.AdmissionReview{Request: convertRequestFromV1beta1(review.Request)}, *gvk, nil
+	}
+	return nil, admissionv1.SchemeGroupVersion.WithKind("AdmissionReview"), fmt.Errorf("unsupported type %v, expect AdmissionReview", gvk)
+}
+
+// 以请求的版本编码 AdmissionReview 响应
+func encodeAdmissionReview(gvk schema.GroupVersionKind, resp *admissionv1.AdmissionResponse) ([]byte, error) {
+	if gvk.GroupVersion() == admissionv1beta1.SchemeGroupVersion {
+		review := admissionv1beta1.AdmissionReview{Response: convertResponseToV1beta1(resp)}
+		review.APIVersion, review.Kind = gvk.ToAPIVersionAndKind()
+		return json.Marshal(review)
+	}
+	review := admissionv1.AdmissionReview{Response: resp}
+	review.APIVersion, review.Kind = admissionv1.SchemeGroupVersion.WithKind("AdmissionReview").ToAPIVersionAndKind()
+	return json.Marshal(review)
+}
+
+// v1beta1 与 v1 的请求字段相同
+func convertRequestFromV1beta1(req *admissionv1beta1.AdmissionRequest) *admissionv1.AdmissionRequest {
+	if req == nil {
+		return nil
+	}
+	return &admissionv1.AdmissionRequest{
+		UID:                req.UID,
+		Kind:               req.Kind,
+		Resource:           req.Resource,
+		SubResource:        req.SubResource,
+		RequestKind:        req.RequestKind,
+		RequestResource:    req.RequestResource,
+		RequestSubResource: req.RequestSubResource,
+		Name:               req.Name,
+		Namespace:          req.Namespace,
+		Operation:          admissionv1.Operation(req.Operation),
+		UserInfo:           req.UserInfo,
+		Object:             req.Object,
+		OldObject:          req.OldObject,
+		DryRun:             req.DryRun,
+		Options:            req.Options,
+	}
+}
+
+// v1beta1 与 v1 的响应字段相同
+func convertResponseToV1beta1(resp *admissionv1.AdmissionResponse) *admissionv1beta1.AdmissionResponse {
+	if resp == nil {
+		return nil
+	}
+	converted := &admissionv1beta1.AdmissionResponse{
+		UID:              resp.UID,
+		Allowed:          resp.Allowed,
+		Result:           resp.Result,
+		Patch:            resp.Patch,
+		AuditAnnotations: resp.AuditAnnotations,
+		Warnings:         resp.Warnings,
+	}
+	if resp.PatchType != nil {
+		pt := admissionv1beta1.PatchType(*resp.PatchType)
+		converted.PatchType = &pt
+	}
+	return converted
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// 把 testdata/review 中的请求发送到 Webhook，响应与 .response.json 比较
+func TestServeGolden(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+	}{
+		{"v1-mutate", "/mutate"},
+		{"v1-validate", "/validate"},
+		{"v1beta1-mutate", "/mutate"},
+		{"v1beta1-validate", "/validate"},
+		{"unsupported-version", "/validate"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request, err := os.ReadFile(filepath.Join("testdata", "review", tt.name+".request.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			whsvr := &WebhookServer{policies: NewPolicyStore(DefaultPolicies())}
+			req := httptest.NewRequest(http.MethodPost, tt.path, bytes.NewReader(request))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			whsvr.serve(w, req)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+
+			var got bytes.Buffer
+			if err := json.Indent(&got, w.Body.Bytes(), "", "  "); err != nil {
+				t.Fatalf("invalid response %s: %v", w.Body, err)
+			}
+			got.WriteByte('\n')
+			golden := filepath.Join("testdata", "review", tt.name+".response.json")
+			if *update {
+				if err := os.WriteFile(golden, got.Bytes(), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got.Bytes(), want) {
+				t.Errorf("response differs from %s (run with -update to regenerate):\n%s", golden, got.String())
+			}
+		})
+	}
+}
@@ -2,19 +2,26 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
+	"mime"
 	"net/http"
+	"runtime/debug"
 	"strings"
+	"time"
 
 	"github.com/golang/glog"
 	admissionv1 "k8s.io/api/admission/v1"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
 	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
+	corelisters "k8s.io/client-go/listers/core/v1"
 )
 
 var (
@@ -34,7 +41,7 @@ var (
 		metav1.NamespacePublic, // 公共命名空间
 	}
 
-	// 需要的标签列表
+	// 默认策略要求的标签列表
 	requiredLabels = []string{
 		nameLabel,
 		instanceLabel,
@@ -61,6 +68,9 @@ const (
 	admissionWebhookAnnotationMutateKey   = "admission-webhook-example.qikqiak.com/mutate"
 	admissionWebhookAnnotationStatusKey   = "admission-webhook-example.qikqiak.com/status"
 
+	// 记录未执行的校验失败的审计注解，API Server 会加上 Webhook 名称作为前缀
+	violationsAuditAnnotation = "policy-violations"
+
 	// 常用标签
 	nameLabel      = "app.kubernetes.io/name"
 	instanceLabel  = "app.kubernetes.io/instance"
@@ -75,27 +85,45 @@ const (
 
 // WebhookServer 结构体封装了 HTTP 服务器
 type WebhookServer struct {
-	server *http.Server // HTTP 服务器
+	server          *http.Server                // HTTP 服务器
+	policies        *PolicyStore                // 当前生效的标签策略
+	namespaceLister corelisters.NamespaceLister // 命名空间缓存，可以为空
+	audit           *AuditLog                   // 审计日志，可以为空
+	readinessChecks []readinessCheck            // /readyz 的就绪检查
 }
 
 // Webhook 服务器参数结构体
 type WhSvrParameters struct {
-	port     int    // webhook 服务器端口
-	certFile string // HTTPS 的 x509 证书路径
-	keyFile  string // 与 certFile 匹配的 x509 私钥路径
-}
-
-// 补丁操作结构体
-type patchOperation struct {
-	Op    string      `json:"op"`              // 操作类型（add、replace、remove）
-	Path  string      `json:"path"`            // 操作的路径
-	Value interface{} `json:"value,omitempty"` // 操作的值
+	port                 int           // webhook 服务器端口
+	certFile             string        // HTTPS 的 x509 证书路径
+	keyFile              string        // 与 certFile 匹配的 x509 私钥路径
+	kubeconfig           string        // kubeconfig 路径，为空时使用集群内配置
+	policyFile           string        // 标签策略文件路径
+	policyConfigMap      string        // 保存标签策略的 ConfigMap，格式为 namespace/name
+	policyConfigMapKey   string        // ConfigMap 中保存策略的 key
+	policyReloadInterval time.Duration // 检查策略文件变化的间隔
+	auditLogFile         string        // 审计日志文件路径，"-" 表示标准输出
+	auditLogMaxSize      int           // 审计日志文件轮转前的最大大小（MB）
+	auditLogMaxBackups   int           // 保留的旧审计日志文件数量
+	auditReportSize      int           // /report 统计的最近违反策略的记录数量
+	reportAddress        string        // /report 的监听地址，为空时不提供 /report
+
+	certBootstrap           bool          // 自动生成证书并更新 caBundle
+	certSecret              string        // 保存自动生成的证书的 Secret，格式为 namespace/name
+	webhookService          string        // Webhook 的 Service，格式为 namespace/name
+	mutatingWebhookConfig   string        // 需要更新 caBundle 的 MutatingWebhookConfiguration
+	validatingWebhookConfig string        // 需要更新 caBundle 的 ValidatingWebhookConfiguration
+	certValidity            time.Duration // 服务证书的有效期
+	certRenewBefore         time.Duration // 到期前多久轮转服务证书
+	certCheckInterval       time.Duration // 检查证书是否需要轮转的间隔
 }
 
 // 初始化函数
 func init() {
 	_ = corev1.AddToScheme(runtimeScheme)
 	_ = admissionregistrationv1.AddToScheme(runtimeScheme)
+	_ = admissionv1.AddToScheme(runtimeScheme)
+	_ = admissionv1beta1.AddToScheme(runtimeScheme)
 	_ = appsv1.AddToScheme(runtimeScheme)
 }
 
@@ -150,176 +178,156 @@ func validationRequired(ignoredList []string, metadata *metav1.ObjectMeta) bool
 	return required
 }
 
-// 更新注解并创建补丁
-func updateAnnotation(target map[string]string, added map[string]string) (patch []patchOperation) {
-	for key, value := range added {
-		if target == nil || target[key] == "" {
-			target = map[string]string{} // 如果目标为空，则初始化
-			patch = append(patch, patchOperation{
-				Op:   "add", // 添加操作
-				Path: "/metadata/annotations",
-				Value: map[string]string{
-					key: value, // 添加的新注解
-				},
-			})
-		} else {
-			patch = append(patch, patchOperation{
-				Op:    "replace", // 替换操作
-				Path:  "/metadata/annotations/" + key,
-				Value: value,
-			})
-		}
+// 设置对象 fields 路径下的字符串 map 中的值；overwrite 为 false 时只设置缺失的 key
+func setStringMap(object map[string]interface{}, values map[string]string, overwrite bool, fields ...string) error {
+	current, _, err := unstructured.NestedStringMap(object, fields...)
+	if err != nil {
+		return err
 	}
-	return patch
-}
-
-// 更新标签并创建补丁
-func updateLabels(target map[string]string, added map[string]string) (patch []patchOperation) {
-	values := make(map[string]string)
-	for key, value := range added {
-		if target == nil || target[key] == "" {
-			values[key] = value // 仅添加未设置的标签
+	if current == nil {
+		current = make(map[string]string, len(values))
+	}
+	for key, value := range values {
+		if _, ok := current[key]; !ok || overwrite {
+			current[key] = value
 		}
 	}
-	patch = append(patch, patchOperation{
-		Op:    "add", // 添加操作
-		Path:  "/metadata/labels",
-		Value: values,
-	})
-	return patch
-}
-
-// 创建补丁 JSON
-func createPatch(availableAnnotations map[string]string, annotations map[string]string, availableLabels map[string]string, labels map[string]string) ([]byte, error) {
-	var patch []patchOperation
-
-	// 更新注解和标签
-	patch = append(patch, updateAnnotation(availableAnnotations, annotations)...)
-	patch = append(patch, updateLabels(availableLabels, labels)...)
-
-	return json.Marshal(patch) // 返回补丁的 JSON 编码
+	return unstructured.SetNestedStringMap(object, current, fields...)
 }
 
-// 验证 Deployment 和 Service
+// 根据标签策略验证任意类型的对象
 func (whsvr *WebhookServer) validate(ar *admissionv1.AdmissionReview) *admissionv1.AdmissionResponse {
 	req := ar.Request
-	var (
-		availableLabels                 map[string]string  // 可用标签
-		objectMeta                      *metav1.ObjectMeta // 对象元数据
-		resourceNamespace, resourceName string             // 资源的命名空间和名称
-	)
-
-	glog.Infof("AdmissionReview for Kind=%v, Namespace=%v Name=%v (%v) UID=%v patchOperation=%v UserInfo=%v",
-		req.Kind, req.Namespace, req.Name, resourceName, req.UID, req.Operation, req.UserInfo)
-
-	// 根据 Kind 解码请求对象
-	switch req.Kind.Kind {
-	case "Deployment":
-		var deployment appsv1.Deployment
-		if err := json.Unmarshal(req.Object.Raw, &deployment); err != nil {
-			glog.Errorf("Could not unmarshal raw object: %v", err)
-			return &admissionv1.AdmissionResponse{
-				Result: &metav1.Status{
-					Message: err.Error(), // 返回错误信息
-				},
-			}
-		}
-		resourceName, resourceNamespace, objectMeta = deployment.Name, deployment.Namespace, &deployment.ObjectMeta
-		availableLabels = deployment.Labels // 获取可用标签
-	case "Service":
-		var service corev1.Service
-		if err := json.Unmarshal(req.Object.Raw, &service); err != nil {
-			glog.Errorf("Could not unmarshal raw object: %v", err)
-			return &admissionv1.AdmissionResponse{
-				Result: &metav1.Status{
-					Message: err.Error(), // 返回错误信息
-				},
-			}
+
+	glog.Infof("AdmissionReview for Kind=%v, Namespace=%v Name=%v UID=%v patchOperation=%v UserInfo=%v",
+		req.Kind, req.Namespace, req.Name, req.UID, req.Operation, req.UserInfo)
+
+	objectMeta, err := decodeObjectMeta(req)
+	if err != nil {
+		glog.Errorf("Could not unmarshal raw object: %v", err)
+		return &admissionv1.AdmissionResponse{
+			Result: &metav1.Status{
+				Message: err.Error(), // 返回错误信息
+			},
 		}
-		resourceName, resourceNamespace, objectMeta = service.Name, service.Namespace, &service.ObjectMeta
-		availableLabels = service.Labels // 获取可用标签
 	}
 
 	// 判断是否需要验证
 	if !validationRequired(ignoredNamespaces, objectMeta) {
-		glog.Infof("Skipping validation for %s/%s due to policy check", resourceNamespace, resourceName)
+		glog.Infof("Skipping validation for %s/%s due to policy check", objectMeta.Namespace, objectMeta.Name)
 		return &admissionv1.AdmissionResponse{
 			Allowed: true, // 允许请求通过
 		}
 	}
 
-	allowed := true
-	var result *metav1.Status
-	glog.Info("available labels:", availableLabels) // 输出可用标签
-	glog.Info("required labels", requiredLabels)    // 输出所需标签
-	// 检查是否所有必需标签都存在
-	for _, rl := range requiredLabels {
-		if _, ok := availableLabels[rl]; !ok {
-			allowed = false
-			result = &metav1.Status{
-				Reason: "required labels are not set", // 标签未设置
-			}
-			break
+	// 检查所有适用策略要求的标签，按处理方式分组
+	violations := whsvr.policies.Get().Check(req.Kind, namespaceLabels(whsvr.namespaceLister, objectMeta.Namespace), objectMeta.Labels)
+	var denied, warnings, unenforced []string
+	for _, v := range violations {
+		switch v.Mode {
+		case ModeWarn:
+			warnings = append(warnings, v.String())
+			unenforced = append(unenforced, v.String())
+		case ModeAudit:
+			unenforced = append(unenforced, v.String())
+		default:
+			denied = append(denied, v.String())
 		}
 	}
 
-	return &admissionv1.AdmissionResponse{
-		Allowed: allowed,
-		Result:  result, // 验证结果
+	resp := &admissionv1.AdmissionResponse{
+		Allowed:  len(denied) == 0,
+		Warnings: warnings, // kubectl 会显示这些警告
+	}
+	if len(unenforced) > 0 {
+		// 未执行的校验失败记录在审计注解中，API Server 的审计日志和本服务的审计日志都会记录
+		glog.Infof("Allowing %v %s/%s despite unenforced violations: %s", req.Kind, objectMeta.Namespace, objectMeta.Name, strings.Join(unenforced, "; "))
+		resp.AuditAnnotations = map[string]string{violationsAuditAnnotation: strings.Join(unenforced, "; ")}
+	}
+	if len(denied) > 0 {
+		glog.Infof("Denying %v %s/%s: %s", req.Kind, objectMeta.Namespace, objectMeta.Name, strings.Join(denied, "; "))
+		resp.Result = &metav1.Status{
+			Reason:  "required labels are not set", // 标签未设置
+			Message: strings.Join(denied, "; "),    // 详细原因
+		}
 	}
+	return resp
 }
 
-// 主要变更处理过程
+// 主要变更处理过程，适用于任意类型的对象
 func (whsvr *WebhookServer) mutate(ar *admissionv1.AdmissionReview) *admissionv1.AdmissionResponse {
 	req := ar.Request
-	var (
-		availableLabels, availableAnnotations map[string]string  // 可用标签和注解
-		objectMeta                            *metav1.ObjectMeta // 对象元数据
-		resourceNamespace, resourceName       string             // 资源的命名空间和名称
-	)
-
-	glog.Infof("AdmissionReview for Kind=%v, Namespace=%v Name=%v (%v) UID=%v patchOperation=%v UserInfo=%v",
-		req.Kind, req.Namespace, req.Name, resourceName, req.UID, req.Operation, req.UserInfo)
-
-	// 根据 Kind 解码请求对象
-	switch req.Kind.Kind {
-	case "Deployment":
-		var deployment appsv1.Deployment
-		if err := json.Unmarshal(req.Object.Raw, &deployment); err != nil {
-			glog.Errorf("Could not unmarshal raw object: %v", err)
-			return &admissionv1.AdmissionResponse{
-				Result: &metav1.Status{
-					Message: err.Error(), // 返回错误信息
-				},
-			}
+
+	glog.Infof("AdmissionReview for Kind=%v, Namespace=%v Name=%v UID=%v patchOperation=%v UserInfo=%v",
+		req.Kind, req.Namespace, req.Name, req.UID, req.Operation, req.UserInfo)
+
+	// 解码为通用对象，以便找到 Pod 模板
+	object := map[string]interface{}{}
+	if err := json.Unmarshal(req.Object.Raw, &object); err != nil {
+		glog.Errorf("Could not unmarshal raw object: %v", err)
+		return &admissionv1.AdmissionResponse{
+			Result: &metav1.Status{
+				Message: err.Error(), // 返回错误信息
+			},
 		}
-		resourceName, resourceNamespace, objectMeta = deployment.Name, deployment.Namespace, &deployment.ObjectMeta
-		availableLabels = deployment.Labels // 获取可用标签
-	case "Service":
-		var service corev1.Service
-		if err := json.Unmarshal(req.Object.Raw, &service); err != nil {
-			glog.Errorf("Could not unmarshal raw object: %v", err)
-			return &admissionv1.AdmissionResponse{
-				Result: &metav1.Status{
-					Message: err.Error(), // 返回错误信息
-				},
-			}
+	}
+	objectMeta, err := decodeObjectMeta(req)
+	if err != nil {
+		glog.Errorf("Could not unmarshal raw object: %v", err)
+		return &admissionv1.AdmissionResponse{
+			Result: &metav1.Status{
+				Message: err.Error(), // 返回错误信息
+			},
 		}
-		resourceName, resourceNamespace, objectMeta = service.Name, service.Namespace, &service.ObjectMeta
-		availableLabels = service.Labels // 获取可用标签
 	}
 
 	// 判断是否需要变更
 	if !mutationRequired(ignoredNamespaces, objectMeta) {
-		glog.Infof("Skipping mutation for %s/%s due to policy check", resourceNamespace, resourceName)
+		glog.Infof("Skipping mutation for %s/%s due to policy check", objectMeta.Namespace, objectMeta.Name)
 		return &admissionv1.AdmissionResponse{
 			Allowed: true, // 允许请求通过
 		}
 	}
 
-	// 设置状态注解
-	annotations := map[string]string{admissionWebhookAnnotationStatusKey: "mutated"}
-	patchBytes, err := createPatch(availableAnnotations, annotations, availableLabels, addLabels) // 创建补丁
+	// 在对象副本上修改，再与原对象比较生成补丁
+	mutated := runtime.DeepCopyJSON(object)
+	annotations := map[string]string{admissionWebhookAnnotationStatusKey: "mutated"} // 设置状态注解
+	if err := setStringMap(mutated, annotations, true, "metadata", "annotations"); err != nil {
+		return &admissionv1.AdmissionResponse{
+			Result: &metav1.Status{
+				Message: err.Error(), // 返回错误信息
+			},
+		}
+	}
+	if err := setStringMap(mutated, addLabels, false, "metadata", "labels"); err != nil { // 仅添加未设置的标签
+		return &admissionv1.AdmissionResponse{
+			Result: &metav1.Status{
+				Message: err.Error(), // 返回错误信息
+			},
+		}
+	}
+
+	// 把标签和状态注解同步到 Pod 模板，使 Pod 也带有 app.kubernetes.io/* 标签
+	if templateFields, ok := podTemplate(object); ok {
+		labels, _, _ := unstructured.NestedStringMap(mutated, "metadata", "labels")
+		templateLabels := make(map[string]string, len(addLabels))
+		for key := range addLabels {
+			templateLabels[key] = labels[key] // 使用对象上的值
+		}
+		err := setStringMap(mutated, templateLabels, false, append(templateFields, "metadata", "labels")...)
+		if err == nil {
+			err = setStringMap(mutated, annotations, false, append(templateFields, "metadata", "annotations")...)
+		}
+		if err != nil {
+			return &admissionv1.AdmissionResponse{
+				Result: &metav1.Status{
+					Message: err.Error(), // 返回错误信息
+				},
+			}
+		}
+	}
+
+	patchBytes, err := json.Marshal(createPatch(object, mutated)) // 创建补丁
 	if err != nil {
 		return &admissionv1.AdmissionResponse{
 			Result: &metav1.Status{
@@ -339,13 +347,83 @@ func (whsvr *WebhookServer) mutate(ar *admissionv1.AdmissionReview) *admissionv1
 	}
 }
 
+// 只解码对象的元数据，适用于所有类型（包括 CRD）
+func decodeObjectMeta(req *admissionv1.AdmissionRequest) (*metav1.ObjectMeta, error) {
+	var object metav1.PartialObjectMetadata
+	if err := json.Unmarshal(req.Object.Raw, &object); err != nil {
+		return nil, err
+	}
+	if object.Namespace == "" {
+		object.Namespace = req.Namespace // 创建时对象中可能没有命名空间
+	}
+	return &object.ObjectMeta, nil
+}
+
+// Pod 模板可能出现的位置：Deployment、StatefulSet、DaemonSet、ReplicaSet、Job
+// 以及使用相同结构的 CRD 在 spec.template，CronJob 在 spec.jobTemplate.spec.template
+var podTemplateFields = [][]string{
+	{"spec", "template"},
+	{"spec", "jobTemplate", "spec", "template"},
+}
+
+// 查找对象中的 Pod 模板，返回其字段路径
+func podTemplate(object map[string]interface{}) ([]string, bool) {
+	for _, fields := range podTemplateFields {
+		template, found, err := unstructured.NestedMap(object, fields...)
+		if err != nil || !found {
+			continue
+		}
+		// Pod 模板必须有 spec，避免误判其他含有 template 字段的对象
+		if _, ok := template["spec"].(map[string]interface{}); !ok {
+			continue
+		}
+		return append([]string(nil), fields...), true
+	}
+	return nil, false
+}
+
+// 请求体的大小上限。API Server 限制对象不超过 3MB，AdmissionReview 中可能同时包含新旧对象
+const maxRequestBodyBytes = 7 << 20
+
 // Webhook 服务器的处理方法
 func (whsvr *WebhookServer) serve(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	// 根据请求的路径选择处理函数
+	var admit func(*admissionv1.AdmissionReview) *admissionv1.AdmissionResponse
+	switch r.URL.Path {
+	case "/mutate":
+		admit = whsvr.mutate // 处理变更请求
+	case "/validate":
+		admit = whsvr.validate // 处理验证请求
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	// 验证 Content-Type 是否正确，允许带有 charset 等参数
+	contentType := r.Header.Get("Content-Type")
+	if mediaType, _, err := mime.ParseMediaType(contentType); err != nil || mediaType != "application/json" {
+		glog.Errorf("Content-Type=%s, expect application/json", contentType)
+		http.Error(w, "invalid Content-Type, expect `application/json`", http.StatusUnsupportedMediaType) // 返回错误
+		return
+	}
+
+	// 读取请求体，超过上限时返回 413
 	var body []byte
 	if r.Body != nil {
-		if data, err := ioutil.ReadAll(r.Body); err == nil {
-			body = data // 读取请求体
+		data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBodyBytes))
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			glog.Errorf("Request body exceeds %d bytes", maxBytesErr.Limit)
+			http.Error(w, fmt.Sprintf("request body too large, limit is %d bytes", maxBytesErr.Limit), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			glog.Errorf("Can't read body: %v", err)
+			http.Error(w, fmt.Sprintf("could not read body: %v", err), http.StatusBadRequest)
+			return
 		}
+		body = data
 	}
 	if len(body) == 0 {
 		glog.Error("empty body")
@@ -353,58 +431,71 @@ func (whsvr *WebhookServer) serve(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 验证 Content-Type 是否正确
-	contentType := r.Header.Get("Content-Type")
-	if contentType != "application/json" {
-		glog.Errorf("Content-Type=%s, expect application/json", contentType)
-		http.Error(w, "invalid Content-Type, expect `application/json`", http.StatusUnsupportedMediaType) // 返回错误
-		return
-	}
-
 	var admissionResponse *admissionv1.AdmissionResponse
-	ar := admissionv1.AdmissionReview{}
-	// 解码请求体
-	if _, _, err := deserializer.Decode(body, nil, &ar); err != nil {
+	// 解码请求体，支持 admission.k8s.io/v1 和 v1beta1
+	ar, gvk, err := decodeAdmissionReview(body)
+	switch {
+	case err != nil:
 		glog.Errorf("Can't decode body: %v", err)
 		admissionResponse = &admissionv1.AdmissionResponse{
 			Result: &metav1.Status{
 				Message: err.Error(), // 返回错误信息
 			},
 		}
-	} else {
-		fmt.Println(r.URL.Path)
-		// 根据请求的路径调用相应的处理函数
-		if r.URL.Path == "/mutate" {
-			admissionResponse = whsvr.mutate(&ar) // 处理变更请求
-		} else if r.URL.Path == "/validate" {
-			admissionResponse = whsvr.validate(&ar) // 处理验证请求
+	case ar.Request == nil:
+		glog.Error("AdmissionReview has no request")
+		admissionResponse = &admissionv1.AdmissionResponse{
+			Result: &metav1.Status{
+				Message: "AdmissionReview has no request",
+			},
 		}
-	}
-
-	// 创建响应对象
-	admissionReview := admissionv1.AdmissionReview{
-		// 设置 API 元信息
-		TypeMeta: metav1.TypeMeta{
-			APIVersion: "admission.k8s.io/v1",
-			Kind:       "AdmissionReview",
-		},
-	}
-	if admissionResponse != nil {
-		admissionReview.Response = admissionResponse
-		if ar.Request != nil {
-			admissionReview.Response.UID = ar.Request.UID // 复制请求的 UID
+	default:
+		admissionResponse = admitRecovered(admit, ar)
+		admissionResponse.UID = ar.Request.UID // 复制请求的 UID
+		webhook := strings.TrimPrefix(r.URL.Path, "/")
+		observeAdmission(webhook, ar.Request, admissionResponse, time.Since(start)) // 记录指标
+		if whsvr.audit != nil {
+			whsvr.audit.Record(newAuditEvent(webhook, ar.Request, admissionResponse)) // 记录审计日志
 		}
 	}
 
-	// 编码响应
-	resp, err := json.Marshal(admissionReview)
+	// 以请求的版本编码响应
+	resp, err := encodeAdmissionReview(gvk, admissionResponse)
 	if err != nil {
 		glog.Errorf("Can't encode response: %v", err)
 		http.Error(w, fmt.Sprintf("could not encode response: %v", err), http.StatusInternalServerError)
+		return
 	}
 	glog.Infof("Ready to write response ...")
+	w.Header().Set("Content-Type", "application/json")
 	if _, err := w.Write(resp); err != nil {
+		// 响应头已经发出，只能记录错误
 		glog.Errorf("Can't write response: %v", err)
-		http.Error(w, fmt.Sprintf("could not write response: %v", err), http.StatusInternalServerError)
 	}
 }
+
+// 调用处理函数，处理函数 panic 时拒绝请求，而不是断开连接
+func admitRecovered(admit func(*admissionv1.AdmissionReview) *admissionv1.AdmissionResponse, ar *admissionv1.AdmissionReview) (resp *admissionv1.AdmissionResponse) {
+	defer func() {
+		if p := recover(); p != nil {
+			glog.Errorf("Panic while handling AdmissionReview %s: %v\n%s", ar.Request.UID, p, debug.Stack())
+			resp = &admissionv1.AdmissionResponse{
+				Allowed: false,
+				Result: &metav1.Status{
+					Reason:  metav1.StatusReasonInternalError,
+					Message: fmt.Sprintf("internal error: %v", p),
+				},
+			}
+		}
+	}()
+	resp = admit(ar)
+	if resp == nil {
+		resp = &admissionv1.AdmissionResponse{
+			Result: &metav1.Status{
+				Reason:  metav1.StatusReasonInternalError,
+				Message: "internal error: no response",
+			},
+		}
+	}
+	return resp
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// 调用 mutate 并返回应用补丁后的对象
+func mutateObject(t *testing.T, kind metav1.GroupVersionKind, object runtime.Object) *unstructured.Unstructured {
+	t.Helper()
+	ar := admissionReview(t, kind, object)
+	resp := (&WebhookServer{}).mutate(ar)
+	if !resp.Allowed {
+		t.Fatalf("not allowed: %+v", resp.Result)
+	}
+	if resp.PatchType == nil || *resp.PatchType != "JSONPatch" {
+		t.Fatalf("unexpected patch type %v", resp.PatchType)
+	}
+	return &unstructured.Unstructured{Object: applyPatch(t, ar.Request.Object.Raw, resp.Patch)}
+}
+
+func stringMap(t *testing.T, obj *unstructured.Unstructured, fields ...string) map[string]string {
+	t.Helper()
+	m, _, err := unstructured.NestedStringMap(obj.Object, fields...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestMutateWorkloads(t *testing.T) {
+	podSpec := corev1.PodSpec{Containers: []corev1.Container{{Name: "c", Image: "busybox"}}}
+	template := corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "db"}},
+		Spec:       podSpec,
+	}
+	rollout := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "argoproj.io/v1alpha1",
+		"kind":       "Rollout",
+		"metadata":   map[string]interface{}{"name": "r"},
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{"containers": []interface{}{}},
+			},
+		},
+	}}
+
+	tests := []struct {
+		name     string
+		kind     metav1.GroupVersionKind
+		object   runtime.Object
+		template []string
+	}{
+		{
+			name: "statefulset",
+			kind: metav1.GroupVersionKind{Group: "apps", Version: "v1", Kind: "StatefulSet"},
+			object: &appsv1.StatefulSet{
+				ObjectMeta: metav1.ObjectMeta{Name: "db", Labels: map[string]string{nameLabel: "db"}},
+				Spec:       appsv1.StatefulSetSpec{Template: template},
+			},
+			template: []string{"spec", "template"},
+		},
+		{
+			name: "cronjob",
+			kind: metav1.GroupVersionKind{Group: "batch", Version: "v1", Kind: "CronJob"},
+			object: &batchv1.CronJob{
+				ObjectMeta: metav1.ObjectMeta{Name: "backup"},
+				Spec: batchv1.CronJobSpec{JobTemplate: batchv1.JobTemplateSpec{
+					Spec: batchv1.JobSpec{Template: template},
+				}},
+			},
+			template: []string{"spec", "jobTemplate", "spec", "template"},
+		},
+		{
+			name:     "custom resource without template metadata",
+			kind:     metav1.GroupVersionKind{Group: "argoproj.io", Version: "v1alpha1", Kind: "Rollout"},
+			object:   rollout,
+			template: []string{"spec", "template"},
+		},
+		{
+			name:   "pod",
+			kind:   metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+			object: &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "p"}, Spec: podSpec},
+		},
+		{
+			name:   "configmap",
+			kind:   metav1.GroupVersionKind{Version: "v1", Kind: "ConfigMap"},
+			object: &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mutated := mutateObject(t, tt.kind, tt.object)
+			labels := stringMap(t, mutated, "metadata", "labels")
+			for key := range addLabels {
+				if _, ok := labels[key]; !ok {
+					t.Errorf("label %s was not added: %v", key, labels)
+				}
+			}
+			if status := mutated.GetAnnotations()[admissionWebhookAnnotationStatusKey]; status != "mutated" {
+				t.Errorf("status annotation = %q", status)
+			}
+			if tt.template == nil {
+				return
+			}
+
+			templateLabels := stringMap(t, mutated, append(tt.template, "metadata", "labels")...)
+			for key := range addLabels {
+				if templateLabels[key] != labels[key] {
+					t.Errorf("template label %s = %q, want %q", key, templateLabels[key], labels[key])
+				}
+			}
+			templateAnnotations := stringMap(t, mutated, append(tt.template, "metadata", "annotations")...)
+			if templateAnnotations[admissionWebhookAnnotationStatusKey] != "mutated" {
+				t.Errorf("template annotations = %v", templateAnnotations)
+			}
+		})
+	}
+}
+
+func TestMutatePreservesExistingMetadata(t *testing.T) {
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "web",
+			Labels:      map[string]string{"app": "web", nameLabel: "web", "team": ""},
+			Annotations: map[string]string{"example.com/owner": "ops", admissionWebhookAnnotationStatusKey: "pending"},
+		},
+		Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "web", instanceLabel: "web-1"}},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "c", Image: "nginx"}}},
+		}},
+	}
+	mutated := mutateObject(t, metav1.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, deployment)
+
+	wantLabels := map[string]string{"app": "web", "team": "", nameLabel: "web"}
+	for key := range addLabels {
+		if _, ok := wantLabels[key]; !ok {
+			wantLabels[key] = NA
+		}
+	}
+	if labels := stringMap(t, mutated, "metadata", "labels"); !reflect.DeepEqual(labels, wantLabels) {
+		t.Errorf("labels = %v, want %v", labels, wantLabels)
+	}
+	wantAnnotations := map[string]string{"example.com/owner": "ops", admissionWebhookAnnotationStatusKey: "mutated"}
+	if annotations := mutated.GetAnnotations(); !reflect.DeepEqual(annotations, wantAnnotations) {
+		t.Errorf("annotations = %v, want %v", annotations, wantAnnotations)
+	}
+
+	// 模板中已有的值保持不变，缺失的值取自对象
+	templateLabels := stringMap(t, mutated, "spec", "template", "metadata", "labels")
+	for key, want := range map[string]string{"app": "web", nameLabel: "web", instanceLabel: "web-1", versionLabel: NA} {
+		if templateLabels[key] != want {
+			t.Errorf("template label %s = %q, want %q", key, templateLabels[key], want)
+		}
+	}
+
+	// 其余字段不受影响
+	var original map[string]interface{}
+	raw, _ := json.Marshal(deployment)
+	if err := json.Unmarshal(raw, &original); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(original["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"],
+		mutated.Object["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"]) {
+		t.Error("pod spec changed")
+	}
+}
+
+func TestServeRequestHandling(t *testing.T) {
+	review, err := json.Marshal(admissionReview(t, deploymentKind, &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "d"}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v1 := []byte(`{"apiVersion":"admission.k8s.io/v1","kind":"AdmissionReview",`)
+	review = append(v1, review[1:]...)
+
+	tests := []struct {
+		name        string
+		whsvr       *WebhookServer
+		path        string
+		contentType string
+		body        []byte
+		code        int
+		allowed     bool
+		message     string
+	}{
+		{name: "unknown path", path: "/healthz/x", contentType: "application/json", body: review, code: http.StatusNotFound},
+		{name: "media type with parameters", path: "/validate", contentType: "application/json; charset=utf-8", body: review, code: http.StatusOK, message: "missing label"},
+		{name: "wrong media type", path: "/validate", contentType: "text/plain", body: review, code: http.StatusUnsupportedMediaType},
+		{name: "missing media type", path: "/validate", body: review, code: http.StatusUnsupportedMediaType},
+		{name: "empty body", path: "/validate", contentType: "application/json", code: http.StatusBadRequest},
+		{name: "body too large", path: "/validate", contentType: "application/json", body: bytes.Repeat([]byte(" "), maxRequestBodyBytes+1), code: http.StatusRequestEntityTooLarge},
+		{name: "no request", path: "/mutate", contentType: "application/json", body: []byte(`{"apiVersion":"admission.k8s.io/v1","kind":"AdmissionReview"}`), code: http.StatusOK, message: "AdmissionReview has no request"},
+		{name: "panic in handler", whsvr: &WebhookServer{}, path: "/validate", contentType: "application/json", body: review, code: http.StatusOK, message: "internal error: "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			whsvr := tt.whsvr
+			if whsvr == nil {
+				whsvr = &WebhookServer{policies: NewPolicyStore(DefaultPolicies())}
+			}
+			req := httptest.NewRequest(http.MethodPost, tt.path, bytes.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			w := httptest.NewRecorder()
+			whsvr.serve(w, req)
+			if w.Code != tt.code {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.code, w.Body)
+			}
+			if tt.code != http.StatusOK {
+				return
+			}
+
+			var resp admissionv1.AdmissionReview
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Response == nil {
+				t.Fatal("response is nil")
+			}
+			if resp.Response.Allowed != tt.allowed {
+				t.Errorf("allowed = %v, want %v", resp.Response.Allowed, tt.allowed)
+			}
+			if resp.Response.Result == nil || !strings.Contains(resp.Response.Result.Message, tt.message) {
+				t.Errorf("result = %+v, want a message containing %q", resp.Response.Result, tt.message)
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	v2 "github.com/ashwinyue/kubernetes-examples/webhook/using-kubebuilder/api/v2"
+)
+
+// ConversionDataAnnotation 保存 v1 无法表示的 v2 字段（如小数、多个操作数和表达式），
+// 转换回 v2 时据此恢复，保证 v2 -> v1 -> v2 不丢失数据.
+const ConversionDataAnnotation = "math.superproj.com/conversion-data"
+
+// conversionData 是 ConversionDataAnnotation 的内容.
+type conversionData struct {
+	Spec   v2.CalculateSpec `json:"spec"`
+	Result string           `json:"result,omitempty"`
+}
+
+var _ conversion.Convertible = &Calculate{}
+
+// ConvertTo 把 v1 的 Calculate 转换为 Hub 版本（v2）.
+func (src *Calculate) ConvertTo(dstRaw conversion.Hub) error {
+	dst, ok := dstRaw.(*v2.Calculate)
+	if !ok {
+		return fmt.Errorf("expected a v2 Calculate but got a %T", dstRaw)
+	}
+
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	dst.Spec = specToV2(src.Spec)
+	dst.Status = statusToV2(src.Status)
+
+	data, ok := src.Annotations[ConversionDataAnnotation]
+	if !ok {
+		return nil
+	}
+	delete(dst.Annotations, ConversionDataAnnotation)
+	if len(dst.Annotations) == 0 {
+		dst.Annotations = nil
+	}
+	var restored conversionData
+	if err := json.Unmarshal([]byte(data), &restored); err != nil {
+		return fmt.Errorf("invalid %s annotation: %v", ConversionDataAnnotation, err)
+	}
+	// 只有 v1 的字段自转换以来没有被修改时才恢复，否则以 v1 的字段为准
+	if equality.Semantic.DeepEqual(specFromV2(restored.Spec), src.Spec) {
+		dst.Spec = restored.Spec
+	}
+	if truncate(restored.Result) == src.Status.Result {
+		dst.Status.Result = restored.Result
+	}
+	return nil
+}
+
+// ConvertFrom 把 Hub 版本（v2）的 Calculate 转换为 v1.
+func (dst *Calculate) ConvertFrom(srcRaw conversion.Hub) error {
+	src, ok := srcRaw.(*v2.Calculate)
+	if !ok {
+		return fmt.Errorf("expected a v2 Calculate but got a %T", srcRaw)
+	}
+
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	delete(dst.Annotations, ConversionDataAnnotation)
+	dst.Spec = specFromV2(src.Spec)
+	dst.Status = statusFromV2(src.Status)
+
+	// v1 能完整表示时不需要保存原始数据
+	if equality.Semantic.DeepEqual(specToV2(dst.Spec), src.Spec) &&
+		statusToV2(dst.Status).Result == src.Status.Result {
+		if len(dst.Annotations) == 0 {
+			dst.Annotations = nil
+		}
+		return nil
+	}
+	data, err := json.Marshal(conversionData{Spec: src.Spec, Result: src.Status.Result})
+	if err != nil {
+		return err
+	}
+	if dst.Annotations == nil {
+		dst.Annotations = map[string]string{}
+	}
+	dst.Annotations[ConversionDataAnnotation] = string(data)
+	return nil
+}
+
+// specToV2 把 v1 的 Spec 转换为 v2：FirstFrom 和 SecondFrom 在 v2 中占据第一个和第二个操作数的位置，
+// 没有引用的位置由 Operands 依次填充.
+func specToV2(spec CalculateSpec) v2.CalculateSpec {
+	out := v2.CalculateSpec{
+		Action:     v2.ActionType(spec.Action),
+		FirstFrom:  referenceToV2(spec.FirstFrom),
+		SecondFrom: referenceToV2(spec.SecondFrom),
+	}
+	if spec.FirstFrom == nil {
+		out.Operands = append(out.Operands, strconv.Itoa(spec.First))
+	}
+	if spec.SecondFrom == nil {
+		out.Operands = append(out.Operands, strconv.Itoa(spec.Second))
+	}
+	return out
+}
+
+func referenceToV2(ref *CalculateReference) *v2.CalculateReference {
+	if ref == nil {
+		return nil
+	}
+	return &v2.CalculateReference{Name: ref.Name}
+}
+
+func statusToV2(status CalculateStatus) v2.CalculateStatus {
+	out := v2.CalculateStatus{
+		ObservedGeneration: status.ObservedGeneration,
+		ComputedAt:         status.ComputedAt.DeepCopy(),
+		Conditions:         copyConditions(status.Conditions),
+	}
+	// v1 无法区分结果为 0 和尚未计算，以 ComputedAt 判断
+	if status.Result != 0 || status.ComputedAt != nil {
+		out.Result = strconv.Itoa(status.Result)
+	}
+	return out
+}
+
+// specFromV2 尽量用 v1 表示 v2 的 Spec：表达式不转换，小数向零取整，只保留前两个操作数.
+func specFromV2(spec v2.CalculateSpec) CalculateSpec {
+	if spec.Expression != "" {
+		// 使用 v1 的默认 Action，避免 v1 的 Mutating Webhook 修改对象后无法恢复表达式
+		return CalculateSpec{Action: ActionTypeAdd}
+	}
+	out := CalculateSpec{
+		Action:     ActionType(spec.Action),
+		FirstFrom:  referenceFromV2(spec.FirstFrom),
+		SecondFrom: referenceFromV2(spec.SecondFrom),
+	}
+	operands := spec.Operands
+	if out.FirstFrom == nil && len(operands) > 0 {
+		out.First = truncate(operands[0])
+		operands = operands[1:]
+	}
+	if out.SecondFrom == nil && len(operands) > 0 {
+		out.Second = truncate(operands[0])
+	}
+	return out
+}
+
+func referenceFromV2(ref *v2.CalculateReference) *CalculateReference {
+	if ref == nil {
+		return nil
+	}
+	return &CalculateReference{Name: ref.Name}
+}
+
+func statusFromV2(status v2.CalculateStatus) CalculateStatus {
+	return CalculateStatus{
+		Result:             truncate(status.Result),
+		ObservedGeneration: status.ObservedGeneration,
+		ComputedAt:         status.ComputedAt.DeepCopy(),
+		Conditions:         copyConditions(status.Conditions),
+	}
+}
+
+func copyConditions(conditions []metav1.Condition) []metav1.Condition {
+	if conditions == nil {
+		return nil
+	}
+	out := make([]metav1.Condition, len(conditions))
+	for i := range conditions {
+		conditions[i].DeepCopyInto(&out[i])
+	}
+	return out
+}
+
+// truncate 把十进制数向零取整为 int，无法解析或超出范围时返回 0.
+func truncate(s string) int {
+	r, err := v2.ParseDecimal(s)
+	if err != nil {
+		return 0
+	}
+	n := new(big.Int).Quo(r.Num(), r.Denom())
+	if !n.IsInt64() {
+		return 0
+	}
+	return int(n.Int64())
+}
@@ -0,0 +1,267 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"math"
+	"testing"
+
+	fuzz "github.com/google/gofuzz"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/diff"
+
+	v2 "github.com/ashwinyue/kubernetes-examples/webhook/using-kubebuilder/api/v2"
+)
+
+const fuzzIterations = 1000
+
+// 包含整数、小数、无法解析的字符串和超出 int 范围的数
+var fuzzNumbers = []string{"0", "1", "-1", "42", "007", "+3", "1.5", "-0.25", ".5", "3.", "1e3", "abc", "", "9223372036854775807", "-9223372036854775808", "9223372036854775808", "123456789012345678901234567890"}
+
+var fuzzExpressions = []string{"", "1 + 2", "(1 + 2) * 3.5", "10 / 4", "-(2 - 5)"}
+
+var fuzzActions = []string{"", "add", "sub", "mul", "div", "pow"}
+
+var fuzzReferences = []string{"", "a", "b"}
+
+func newFuzzer() *fuzz.Fuzzer {
+	return fuzz.New().NilChance(0.3).Funcs(
+		// TypeMeta 由转换 Webhook 设置，不参与转换
+		func(*metav1.TypeMeta, fuzz.Continue) {},
+		func(m *metav1.ObjectMeta, c fuzz.Continue) {
+			c.Fuzz(&m.Name)
+			c.Fuzz(&m.Namespace)
+			c.Fuzz(&m.Generation)
+			c.Fuzz(&m.Labels)
+			c.Fuzz(&m.Annotations)
+			delete(m.Annotations, ConversionDataAnnotation)
+		},
+		func(spec *CalculateSpec, c fuzz.Continue) {
+			spec.Action = ActionType(fuzzActions[c.Intn(len(fuzzActions))])
+			spec.First = fuzzInt(c)
+			spec.Second = fuzzInt(c)
+			// Webhook 不允许同时设置常量和引用
+			if spec.FirstFrom = fuzzReference(c); spec.FirstFrom != nil {
+				spec.First = 0
+			}
+			if spec.SecondFrom = fuzzReference(c); spec.SecondFrom != nil {
+				spec.Second = 0
+			}
+		},
+		func(status *CalculateStatus, c fuzz.Continue) {
+			status.Result = fuzzInt(c)
+			status.ObservedGeneration = c.Int63n(3)
+			c.Fuzz(&status.ComputedAt)
+			c.Fuzz(&status.Conditions)
+		},
+		func(spec *v2.CalculateSpec, c fuzz.Continue) {
+			spec.Action = v2.ActionType(fuzzActions[c.Intn(len(fuzzActions))])
+			spec.Expression = fuzzExpressions[c.Intn(len(fuzzExpressions))]
+			if c.RandBool() {
+				spec.Operands = make([]string, c.Intn(4))
+				for i := range spec.Operands {
+					spec.Operands[i] = fuzzNumbers[c.Intn(len(fuzzNumbers))]
+				}
+			}
+			if ref := fuzzReference(c); ref != nil {
+				spec.FirstFrom = &v2.CalculateReference{Name: ref.Name}
+			}
+			if ref := fuzzReference(c); ref != nil {
+				spec.SecondFrom = &v2.CalculateReference{Name: ref.Name}
+			}
+		},
+		func(status *v2.CalculateStatus, c fuzz.Continue) {
+			status.Result = fuzzNumbers[c.Intn(len(fuzzNumbers))]
+			status.ObservedGeneration = c.Int63n(3)
+			c.Fuzz(&status.ComputedAt)
+			c.Fuzz(&status.Conditions)
+		},
+	)
+}
+
+// fuzzReference 返回随机的引用，一半为 nil
+func fuzzReference(c fuzz.Continue) *CalculateReference {
+	if c.RandBool() {
+		return nil
+	}
+	return &CalculateReference{Name: fuzzReferences[c.Intn(len(fuzzReferences))]}
+}
+
+// fuzzInt 返回随机的 int，偏向 0 和边界值
+func fuzzInt(c fuzz.Continue) int {
+	switch c.Intn(4) {
+	case 0:
+		return 0
+	case 1:
+		return []int{math.MinInt, math.MaxInt, -1, 1}[c.Intn(4)]
+	default:
+		return int(c.Int63()) - math.MaxInt/2
+	}
+}
+
+// v1 -> v2 -> v1 不丢失数据
+func TestConversionRoundTripFromSpoke(t *testing.T) {
+	f := newFuzzer()
+	for i := 0; i < fuzzIterations; i++ {
+		original := &Calculate{}
+		f.Fuzz(original)
+
+		hub := &v2.Calculate{}
+		if err := original.DeepCopy().ConvertTo(hub); err != nil {
+			t.Fatalf("ConvertTo(%+v): %v", original, err)
+		}
+		got := &Calculate{}
+		if err := got.ConvertFrom(hub); err != nil {
+			t.Fatalf("ConvertFrom(%+v): %v", hub, err)
+		}
+		if !equality.Semantic.DeepEqual(original, got) {
+			t.Fatalf("v1 -> v2 -> v1 lost data:\n%s", diff.ObjectReflectDiff(original, got))
+		}
+	}
+}
+
+// v2 -> v1 -> v2 不丢失数据，v1 无法表示的字段通过注解恢复
+func TestConversionRoundTripFromHub(t *testing.T) {
+	f := newFuzzer()
+	for i := 0; i < fuzzIterations; i++ {
+		original := &v2.Calculate{}
+		f.Fuzz(original)
+
+		spoke := &Calculate{}
+		if err := spoke.ConvertFrom(original.DeepCopy()); err != nil {
+			t.Fatalf("ConvertFrom(%+v): %v", original, err)
+		}
+		got := &v2.Calculate{}
+		if err := spoke.ConvertTo(got); err != nil {
+			t.Fatalf("ConvertTo(%+v): %v", spoke, err)
+		}
+		if !equality.Semantic.DeepEqual(original, got) {
+			t.Fatalf("v2 -> v1 -> v2 lost data:\n%s", diff.ObjectReflectDiff(original, got))
+		}
+	}
+}
+
+func TestConvertFrom(t *testing.T) {
+	tests := []struct {
+		name           string
+		hub            v2.Calculate
+		want           Calculate
+		wantAnnotation bool
+	}{
+		{
+			name: "integers",
+			hub: v2.Calculate{
+				Spec:   v2.CalculateSpec{Action: v2.ActionTypeMul, Operands: []string{"6", "-7"}},
+				Status: v2.CalculateStatus{Result: "-42", ObservedGeneration: 1},
+			},
+			want: Calculate{
+				Spec:   CalculateSpec{Action: ActionTypeMul, First: 6, Second: -7},
+				Status: CalculateStatus{Result: -42, ObservedGeneration: 1},
+			},
+		},
+		{
+			name: "decimals are truncated",
+			hub: v2.Calculate{
+				Spec:   v2.CalculateSpec{Action: v2.ActionTypeDiv, Operands: []string{"7.9", "-2.5"}},
+				Status: v2.CalculateStatus{Result: "-3.16", ObservedGeneration: 1},
+			},
+			want: Calculate{
+				Spec:   CalculateSpec{Action: ActionTypeDiv, First: 7, Second: -2},
+				Status: CalculateStatus{Result: -3, ObservedGeneration: 1},
+			},
+			wantAnnotation: true,
+		},
+		{
+			name: "extra operands are dropped",
+			hub: v2.Calculate{
+				Spec: v2.CalculateSpec{Action: v2.ActionTypeAdd, Operands: []string{"1", "2", "3"}},
+			},
+			want: Calculate{
+				Spec: CalculateSpec{Action: ActionTypeAdd, First: 1, Second: 2},
+			},
+			wantAnnotation: true,
+		},
+		{
+			name: "references",
+			hub: v2.Calculate{
+				Spec: v2.CalculateSpec{Action: v2.ActionTypeSub, Operands: []string{"3"}, SecondFrom: &v2.CalculateReference{Name: "a"}},
+			},
+			want: Calculate{
+				Spec: CalculateSpec{Action: ActionTypeSub, First: 3, SecondFrom: &CalculateReference{Name: "a"}},
+			},
+		},
+		{
+			name: "operands after references are dropped",
+			hub: v2.Calculate{
+				Spec: v2.CalculateSpec{Action: v2.ActionTypeAdd, Operands: []string{"3"}, FirstFrom: &v2.CalculateReference{Name: "a"}, SecondFrom: &v2.CalculateReference{Name: "b"}},
+			},
+			want: Calculate{
+				Spec: CalculateSpec{Action: ActionTypeAdd, FirstFrom: &CalculateReference{Name: "a"}, SecondFrom: &CalculateReference{Name: "b"}},
+			},
+			wantAnnotation: true,
+		},
+		{
+			name: "expression",
+			hub: v2.Calculate{
+				Spec:   v2.CalculateSpec{Expression: "(1 + 2) * 3"},
+				Status: v2.CalculateStatus{Result: "9", ObservedGeneration: 2},
+			},
+			want: Calculate{
+				Spec:   CalculateSpec{Action: ActionTypeAdd},
+				Status: CalculateStatus{Result: 9, ObservedGeneration: 2},
+			},
+			wantAnnotation: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := &Calculate{}
+			if err := got.ConvertFrom(&tt.hub); err != nil {
+				t.Fatal(err)
+			}
+			if !equality.Semantic.DeepEqual(got.Spec, tt.want.Spec) || !equality.Semantic.DeepEqual(got.Status, tt.want.Status) {
+				t.Errorf("got %+v %+v, want %+v %+v", got.Spec, got.Status, tt.want.Spec, tt.want.Status)
+			}
+			if _, ok := got.Annotations[ConversionDataAnnotation]; ok != tt.wantAnnotation {
+				t.Errorf("annotations = %v, want %s: %v", got.Annotations, ConversionDataAnnotation, tt.wantAnnotation)
+			}
+		})
+	}
+}
+
+// 通过 v1 修改了 v1 能表示的字段后，以 v1 的字段为准
+func TestConvertToIgnoresStaleAnnotation(t *testing.T) {
+	hub := &v2.Calculate{Spec: v2.CalculateSpec{Action: v2.ActionTypeAdd, Operands: []string{"1.5", "2"}}}
+	spoke := &Calculate{}
+	if err := spoke.ConvertFrom(hub); err != nil {
+		t.Fatal(err)
+	}
+	spoke.Spec.Second = 5
+
+	got := &v2.Calculate{}
+	if err := spoke.ConvertTo(got); err != nil {
+		t.Fatal(err)
+	}
+	want := v2.CalculateSpec{Action: v2.ActionTypeAdd, Operands: []string{"1", "5"}}
+	if !equality.Semantic.DeepEqual(got.Spec, want) {
+		t.Errorf("spec = %+v, want %+v", got.Spec, want)
+	}
+	if _, ok := got.Annotations[ConversionDataAnnotation]; ok {
+		t.Errorf("%s was not removed", ConversionDataAnnotation)
+	}
+}
@@ -37,20 +37,62 @@ const (
 	ActionTypeDiv ActionType = ActionType("div")
 )
 
+const (
+	// ConditionTypeReady is True when Status.Result holds the result of the current spec.
+	ConditionTypeReady = "Ready"
+	// ConditionTypeFailed is True when the current spec cannot be calculated. The
+	// controller does not retry until the spec changes.
+	ConditionTypeFailed = "Failed"
+
+	// ReasonCalculated means the result has been computed.
+	ReasonCalculated = "Calculated"
+	// ReasonDivisionByZero means the calculation divides by zero.
+	ReasonDivisionByZero = "DivisionByZero"
+	// ReasonInvalidSpec means the spec cannot be evaluated, such as an unknown action.
+	ReasonInvalidSpec = "InvalidSpec"
+	// ReasonReferenceNotReady means a referenced Calculate does not exist or has no
+	// result yet. The controller calculates again when it changes.
+	ReasonReferenceNotReady = "ReferenceNotReady"
+	// ReasonCyclicReference means the Calculate depends on its own result through
+	// FirstFrom or SecondFrom.
+	ReasonCyclicReference = "CyclicReference"
+)
+
+// CalculateReference refers to another Calculate in the same namespace.
+type CalculateReference struct {
+	// The name of the referenced Calculate.
+	Name string `json:"name"`
+}
+
 // CalculateSpec defines the desired state of Calculate
 type CalculateSpec struct {
 	// The arithmetic action to be performed (add, sub, mul, or div).
 	Action ActionType `json:"action,omitempty"`
 	// The first operand in the calculation.
 	First int `json:"first,omitempty"`
+	// Takes the first operand from the result of another Calculate.
+	// First must be unset when FirstFrom is set.
+	FirstFrom *CalculateReference `json:"firstFrom,omitempty"`
 	// The second operand in the calculation.
 	Second int `json:"second,omitempty"`
+	// Takes the second operand from the result of another Calculate.
+	// Second must be unset when SecondFrom is set.
+	SecondFrom *CalculateReference `json:"secondFrom,omitempty"`
 }
 
 // CalculateStatus defines the observed state of Calculate
 type CalculateStatus struct {
 	// The result of the calculation.
 	Result int `json:"result,omitempty"`
+	// The generation of the spec the controller last processed.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// The time the result was computed. Nil means no result has been computed for
+	// the current spec.
+	ComputedAt *metav1.Time `json:"computedAt,omitempty"`
+	// The latest available observations of the calculation.
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -59,6 +101,9 @@ type CalculateStatus struct {
 // +kubebuilder:printcolumn:name="First",type="integer",JSONPath=".spec.first",description="Input first number"
 // +kubebuilder:printcolumn:name="Second",type="integer",JSONPath=".spec.second",description="Input second number"
 // +kubebuilder:printcolumn:name="Result",type="integer",JSONPath=".status.result",description="Calculate result"
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].status",description="Whether the result is up to date"
+// +kubebuilder:printcolumn:name="Reason",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].reason",description="Why the result is or is not up to date"
+// +kubebuilder:printcolumn:name="Message",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].message",priority=1,description="Details of the Ready condition"
 
 // Calculate is the Schema for the calculates API
 type Calculate struct {
@@ -17,7 +17,11 @@ limitations under the License.
 package v1
 
 import (
+	"fmt"
+	"math"
+
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 	ctrl "sigs.k8s.io/controller-runtime"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
@@ -40,7 +44,8 @@ func (r *Calculate) SetupWebhookWithManager(mgr ctrl.Manager) error {
 
 // 通过 +kubebuilder:webhook 注解，声明了一个 Webhook，指定其路径、是否进行变换、失败策略、以及操作等信息。
 // `make manifests` 命令会根据该注解生成 MutatingWebhookConfiguration
-// +kubebuilder:webhook:path=/mutate-math-superproj-com-v1-calculate,mutating=true,failurePolicy=fail,sideEffects=None,groups=math.superproj.com,resources=calculates,verbs=create;update,versions=v1,name=mcalculate.kb.io,admissionReviewVersions=v1
+// matchPolicy=Exact：v2 对象由 v2 的 Webhook 处理，不能转换成 v1 再处理，转换会截断小数
+// +kubebuilder:webhook:path=/mutate-math-superproj-com-v1-calculate,mutating=true,failurePolicy=fail,sideEffects=None,groups=math.superproj.com,resources=calculates,verbs=create;update,versions=v1,matchPolicy=Exact,name=mcalculate.kb.io,admissionReviewVersions=v1
 
 // 声明一个匿名变量，确保 Calculate 结构体实现了 webhook.Validator 接口。
 var _ webhook.Defaulter = &Calculate{}
@@ -49,7 +54,10 @@ var _ webhook.Defaulter = &Calculate{}
 func (r *Calculate) Default() {
 	calculatelog.Info("default", "name", r.Name)
 
-	// TODO(user): fill in your defaulting logic.
+	// 未指定 Action 时默认执行加法
+	if r.Spec.Action == "" {
+		r.Spec.Action = ActionTypeAdd
+	}
 }
 
 // 通过 +kubebuilder:webhook 注解，声明了一个 Webhook，指定其路径、是否进行变换、失败策略、以及操作等信息。
@@ -57,7 +65,7 @@ func (r *Calculate) Default() {
 // TODO(user): change verbs to "verbs=create;update;delete" if you want to enable deletion validation.
 // NOTE: The 'path' attribute must follow a specific pattern and should not be modified directly here.
 // Modifying the path for an invalid path can cause API server errors; failing to locate the webhook.
-// +kubebuilder:webhook:path=/validate-math-superproj-com-v1-calculate,mutating=false,failurePolicy=fail,sideEffects=None,groups=math.superproj.com,resources=calculates,verbs=create;update,versions=v1,name=vcalculate.kb.io,admissionReviewVersions=v1
+// +kubebuilder:webhook:path=/validate-math-superproj-com-v1-calculate,mutating=false,failurePolicy=fail,sideEffects=None,groups=math.superproj.com,resources=calculates,verbs=create;update,versions=v1,matchPolicy=Exact,name=vcalculate.kb.io,admissionReviewVersions=v1
 
 var _ webhook.Validator = &Calculate{}
 
@@ -72,7 +80,16 @@ func (r *Calculate) ValidateCreate() (admission.Warnings, error) {
 func (r *Calculate) ValidateUpdate(old runtime.Object) (admission.Warnings, error) {
 	calculatelog.Info("validate update", "name", r.Name)
 
-	return r.validate()
+	oldCalculate, ok := old.(*Calculate)
+	if !ok {
+		return nil, fmt.Errorf("expected a Calculate but got a %T", old)
+	}
+
+	warnings, err := r.validate()
+	if err != nil {
+		return warnings, err
+	}
+	return warnings, r.validateImmutable(oldCalculate)
 }
 
 // ValidateDelete 实现了 webhook.Validator 接口中的 ValidateDelete() 方法，用于在删除对象时进行验证.
@@ -90,10 +107,82 @@ func (r *Calculate) validate() (admission.Warnings, error) {
 	allErrs := field.ErrorList{}
 
 	specPath := field.NewPath("spec")
-	// 当 Action 类型为 `div` 时，如果 `second` 字段值为 0，则拒绝，并返回错误信息
-	if r.Spec.Action == ActionTypeDiv && r.Spec.Second == 0 {
-		allErrs = append(allErrs, field.Invalid(specPath.Child("second"), r.Spec.Second, "the divisor cannot be zero whtn action is division"))
+	// 操作数从其他 Calculate 获取时不能同时指定常量
+	if r.Spec.FirstFrom != nil {
+		allErrs = append(allErrs, r.validateReference(specPath.Child("firstFrom"), r.Spec.FirstFrom)...)
+		if r.Spec.First != 0 {
+			allErrs = append(allErrs, field.Forbidden(specPath.Child("first"), "must not be set when firstFrom is set"))
+		}
+	}
+	if r.Spec.SecondFrom != nil {
+		allErrs = append(allErrs, r.validateReference(specPath.Child("secondFrom"), r.Spec.SecondFrom)...)
+		if r.Spec.Second != 0 {
+			allErrs = append(allErrs, field.Forbidden(specPath.Child("second"), "must not be set when secondFrom is set"))
+		}
+	}
+
+	// 引用的结果由 Controller 计算时获取，这里只检查常量操作数
+	switch r.Spec.Action {
+	case ActionTypeAdd, ActionTypeSub:
+	case ActionTypeMul:
+		// 当 Action 类型为 `mul` 时，如果乘积超出 int 的范围，则拒绝，并返回错误信息
+		if r.Spec.FirstFrom == nil && r.Spec.SecondFrom == nil && multiplyOverflows(r.Spec.First, r.Spec.Second) {
+			allErrs = append(allErrs, field.Invalid(specPath.Child("second"), r.Spec.Second,
+				fmt.Sprintf("the product of %d and %d overflows an integer", r.Spec.First, r.Spec.Second)))
+		}
+	case ActionTypeDiv:
+		// 当 Action 类型为 `div` 时，如果 `second` 字段值为 0，则拒绝，并返回错误信息
+		if r.Spec.SecondFrom == nil && r.Spec.Second == 0 {
+			allErrs = append(allErrs, field.Invalid(specPath.Child("second"), r.Spec.Second, "the divisor cannot be zero whtn action is division"))
+		}
+	default:
+		// 拒绝未知的 Action 类型
+		allErrs = append(allErrs, field.NotSupported(specPath.Child("action"), r.Spec.Action,
+			[]string{string(ActionTypeAdd), string(ActionTypeSub), string(ActionTypeMul), string(ActionTypeDiv)}))
 	}
 
 	return nil, allErrs.ToAggregate()
 }
+
+// validateReference 校验对其他 Calculate 的引用：名称必须合法，且不能引用自身.
+func (r *Calculate) validateReference(path *field.Path, ref *CalculateReference) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	namePath := path.Child("name")
+	switch {
+	case ref.Name == "":
+		allErrs = append(allErrs, field.Required(namePath, ""))
+	case ref.Name == r.Name:
+		allErrs = append(allErrs, field.Invalid(namePath, ref.Name, "cannot reference itself"))
+	default:
+		for _, msg := range validation.IsDNS1123Subdomain(ref.Name) {
+			allErrs = append(allErrs, field.Invalid(namePath, ref.Name, msg))
+		}
+	}
+
+	return allErrs
+}
+
+// validateImmutable 包含更新时的不可变规则：计算出结果后，不允许再修改 Action.
+func (r *Calculate) validateImmutable(old *Calculate) error {
+	allErrs := field.ErrorList{}
+
+	if old.Status.ComputedAt != nil && r.Spec.Action != old.Spec.Action {
+		allErrs = append(allErrs, field.Forbidden(field.NewPath("spec", "action"),
+			fmt.Sprintf("cannot change action from %q to %q after the result has been computed", old.Spec.Action, r.Spec.Action)))
+	}
+
+	return allErrs.ToAggregate()
+}
+
+// multiplyOverflows 判断 a*b 是否超出 int 的范围.
+func multiplyOverflows(a, b int) bool {
+	if a == 0 || b == 0 {
+		return false
+	}
+	// math.MinInt * -1 溢出后仍为 math.MinInt，除法无法检测出来
+	if (a == -1 && b == math.MinInt) || (b == -1 && a == math.MinInt) {
+		return true
+	}
+	return (a*b)/b != a
+}
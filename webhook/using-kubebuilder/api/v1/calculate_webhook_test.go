@@ -17,30 +17,178 @@ limitations under the License.
 package v1
 
 import (
+	"fmt"
+	"math"
+
 	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	v2 "github.com/ashwinyue/kubernetes-examples/webhook/using-kubebuilder/api/v2"
 )
 
+// newCalculate 返回 default 命名空间下的 Calculate.
+func newCalculate(name string, action ActionType, first, second int) *Calculate {
+	return &Calculate{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec:       CalculateSpec{Action: action, First: first, Second: second},
+	}
+}
+
 var _ = Describe("Calculate Webhook", func() {
 
+	AfterEach(func() {
+		Expect(k8sClient.DeleteAllOf(ctx, &Calculate{}, client.InNamespace("default"))).To(Succeed())
+	})
+
 	Context("When creating Calculate under Defaulting Webhook", func() {
 		It("Should fill in the default value if a required field is empty", func() {
+			calculate := newCalculate("default-action", "", 1, 2)
+			Expect(k8sClient.Create(ctx, calculate)).To(Succeed())
 
-			// TODO(user): Add your logic here
+			created := &Calculate{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "default-action", Namespace: "default"}, created)).To(Succeed())
+			Expect(created.Spec.Action).To(Equal(ActionTypeAdd))
+		})
 
+		It("Should keep the action if it is set", func() {
+			calculate := newCalculate("keep-action", ActionTypeSub, 1, 2)
+			Expect(k8sClient.Create(ctx, calculate)).To(Succeed())
+			Expect(calculate.Spec.Action).To(Equal(ActionTypeSub))
 		})
 	})
 
 	Context("When creating Calculate under Validating Webhook", func() {
-		It("Should deny if a required field is empty", func() {
+		It("Should deny an unknown action", func() {
+			err := k8sClient.Create(ctx, newCalculate("unknown-action", "pow", 2, 3))
+			Expect(apierrors.IsForbidden(err)).To(BeTrue(), "unexpected error: %v", err)
+			Expect(err.Error()).To(ContainSubstring(`spec.action: Unsupported value: "pow"`))
+		})
 
-			// TODO(user): Add your logic here
+		It("Should deny division by zero", func() {
+			err := k8sClient.Create(ctx, newCalculate("divide-by-zero", ActionTypeDiv, 1, 0))
+			Expect(apierrors.IsForbidden(err)).To(BeTrue(), "unexpected error: %v", err)
+			Expect(err.Error()).To(ContainSubstring("the divisor cannot be zero"))
+		})
 
+		It("Should deny a multiplication that overflows", func() {
+			for i, c := range [][2]int{{math.MaxInt, 2}, {math.MinInt, -1}, {-1, math.MinInt}, {1 << 32, 1 << 31}} {
+				err := k8sClient.Create(ctx, newCalculate(fmt.Sprintf("overflow-%d", i), ActionTypeMul, c[0], c[1]))
+				Expect(apierrors.IsForbidden(err)).To(BeTrue(), "%d * %d: unexpected error: %v", c[0], c[1], err)
+				Expect(err.Error()).To(ContainSubstring("overflows an integer"))
+			}
 		})
 
 		It("Should admit if all required fields are provided", func() {
+			Expect(k8sClient.Create(ctx, newCalculate("add", ActionTypeAdd, 1, 2))).To(Succeed())
+			Expect(k8sClient.Create(ctx, newCalculate("divide", ActionTypeDiv, 4, 2))).To(Succeed())
+			Expect(k8sClient.Create(ctx, newCalculate("multiply", ActionTypeMul, math.MaxInt, 1))).To(Succeed())
+			Expect(k8sClient.Create(ctx, newCalculate("multiply-min", ActionTypeMul, math.MinInt, 1))).To(Succeed())
+		})
+
+		It("Should deny an operand set together with its reference", func() {
+			calculate := newCalculate("first-and-reference", ActionTypeAdd, 1, 2)
+			calculate.Spec.FirstFrom = &CalculateReference{Name: "other"}
+			err := k8sClient.Create(ctx, calculate)
+			Expect(apierrors.IsForbidden(err)).To(BeTrue(), "unexpected error: %v", err)
+			Expect(err.Error()).To(ContainSubstring("spec.first: Forbidden: must not be set when firstFrom is set"))
+		})
+
+		It("Should deny a reference to itself", func() {
+			calculate := newCalculate("self", ActionTypeAdd, 1, 0)
+			calculate.Spec.SecondFrom = &CalculateReference{Name: "self"}
+			err := k8sClient.Create(ctx, calculate)
+			Expect(apierrors.IsForbidden(err)).To(BeTrue(), "unexpected error: %v", err)
+			Expect(err.Error()).To(ContainSubstring("spec.secondFrom.name: Invalid value: \"self\": cannot reference itself"))
+		})
+
+		It("Should admit a division by a reference", func() {
+			// 被引用的结果由 Controller 计算时检查
+			calculate := newCalculate("divide-by-reference", ActionTypeDiv, 1, 0)
+			calculate.Spec.SecondFrom = &CalculateReference{Name: "other"}
+			Expect(k8sClient.Create(ctx, calculate)).To(Succeed())
+		})
+	})
+
+	Context("When updating Calculate under Validating Webhook", func() {
+		It("Should admit an action change before the result is computed", func() {
+			calculate := newCalculate("pending", ActionTypeAdd, 1, 2)
+			Expect(k8sClient.Create(ctx, calculate)).To(Succeed())
+
+			calculate.Spec.Action = ActionTypeMul
+			Expect(k8sClient.Update(ctx, calculate)).To(Succeed())
+		})
+
+		It("Should deny an action change after the result is computed", func() {
+			calculate := newCalculate("computed", ActionTypeAdd, 1, 2)
+			Expect(k8sClient.Create(ctx, calculate)).To(Succeed())
+			now := metav1.Now()
+			calculate.Status = CalculateStatus{Result: 3, ObservedGeneration: calculate.Generation, ComputedAt: &now}
+			Expect(k8sClient.Status().Update(ctx, calculate)).To(Succeed())
+
+			calculate.Spec.Action = ActionTypeMul
+			err := k8sClient.Update(ctx, calculate)
+			Expect(apierrors.IsForbidden(err)).To(BeTrue(), "unexpected error: %v", err)
+			Expect(err.Error()).To(ContainSubstring("cannot change action"))
+
+			// 修改操作数仍然允许
+			calculate.Spec.Action = ActionTypeAdd
+			calculate.Spec.Second = 5
+			Expect(k8sClient.Update(ctx, calculate)).To(Succeed())
+		})
+
+		It("Should validate the new object on update", func() {
+			calculate := newCalculate("update-divisor", ActionTypeDiv, 4, 2)
+			Expect(k8sClient.Create(ctx, calculate)).To(Succeed())
 
-			// TODO(user): Add your logic here
+			calculate.Spec.Second = 0
+			err := k8sClient.Update(ctx, calculate)
+			Expect(apierrors.IsForbidden(err)).To(BeTrue(), "unexpected error: %v", err)
+		})
+	})
+
+	Context("When converting Calculate between versions", func() {
+		It("Should serve v1 objects as v2", func() {
+			Expect(k8sClient.Create(ctx, newCalculate("v1-object", ActionTypeSub, 5, 3))).To(Succeed())
+
+			hub := &v2.Calculate{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "v1-object", Namespace: "default"}, hub)).To(Succeed())
+			Expect(hub.Spec.Action).To(Equal(v2.ActionTypeSub))
+			Expect(hub.Spec.Operands).To(Equal([]string{"5", "3"}))
+		})
+
+		It("Should not validate v2 objects as truncated v1 objects", func() {
+			// v1 的 Webhook 只处理 v1 请求，0.5 转换成 v1 后会被截断为 0
+			hub := &v2.Calculate{
+				ObjectMeta: metav1.ObjectMeta{Name: "v2-decimal-divisor", Namespace: "default"},
+				Spec:       v2.CalculateSpec{Action: v2.ActionTypeDiv, Operands: []string{"1", "0.5"}},
+			}
+			Expect(k8sClient.Create(ctx, hub)).To(Succeed())
+		})
 
+		It("Should keep v2 fields when the object is updated through v1", func() {
+			hub := &v2.Calculate{
+				ObjectMeta: metav1.ObjectMeta{Name: "v2-expression", Namespace: "default"},
+				Spec:       v2.CalculateSpec{Expression: "(1 + 2) * 3.5"},
+			}
+			Expect(k8sClient.Create(ctx, hub)).To(Succeed())
+
+			calculate := &Calculate{}
+			key := types.NamespacedName{Name: "v2-expression", Namespace: "default"}
+			Expect(k8sClient.Get(ctx, key, calculate)).To(Succeed())
+			Expect(calculate.Annotations).To(HaveKey(ConversionDataAnnotation))
+			calculate.Labels = map[string]string{"updated": "true"}
+			Expect(k8sClient.Update(ctx, calculate)).To(Succeed())
+
+			updated := &v2.Calculate{}
+			Expect(k8sClient.Get(ctx, key, updated)).To(Succeed())
+			Expect(updated.Labels).To(HaveKeyWithValue("updated", "true"))
+			Expect(updated.Spec.Expression).To(Equal("(1 + 2) * 3.5"))
+			Expect(updated.Annotations).NotTo(HaveKey(ConversionDataAnnotation))
 		})
 	})
 
@@ -21,6 +21,7 @@ limitations under the License.
 package v1
 
 import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -29,8 +30,8 @@ func (in *Calculate) DeepCopyInto(out *Calculate) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
-	out.Status = in.Status
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Calculate.
@@ -83,9 +84,34 @@ func (in *CalculateList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CalculateReference) DeepCopyInto(out *CalculateReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CalculateReference.
+func (in *CalculateReference) DeepCopy() *CalculateReference {
+	if in == nil {
+		return nil
+	}
+	out := new(CalculateReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CalculateSpec) DeepCopyInto(out *CalculateSpec) {
 	*out = *in
+	if in.FirstFrom != nil {
+		in, out := &in.FirstFrom, &out.FirstFrom
+		*out = new(CalculateReference)
+		**out = **in
+	}
+	if in.SecondFrom != nil {
+		in, out := &in.SecondFrom, &out.SecondFrom
+		*out = new(CalculateReference)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CalculateSpec.
@@ -101,6 +127,17 @@ func (in *CalculateSpec) DeepCopy() *CalculateSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CalculateStatus) DeepCopyInto(out *CalculateStatus) {
 	*out = *in
+	if in.ComputedAt != nil {
+		in, out := &in.ComputedAt, &out.ComputedAt
+		*out = (*in).DeepCopy()
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CalculateStatus.
@@ -0,0 +1,129 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v2
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ActionType is a custom type for representing different calculation actions.
+type ActionType string
+
+const (
+	// ActionTypeAdd represents the "add" action.
+	ActionTypeAdd ActionType = ActionType("add")
+	// ActionTypeSub represents the "subtract" action.
+	ActionTypeSub ActionType = ActionType("sub")
+	// ActionTypeMul represents the "multiply" action.
+	ActionTypeMul ActionType = ActionType("mul")
+	// ActionTypeDiv represents the "divide" action.
+	ActionTypeDiv ActionType = ActionType("div")
+)
+
+const (
+	// ConditionTypeReady is True when Status.Result holds the result of the current spec.
+	ConditionTypeReady = "Ready"
+	// ConditionTypeFailed is True when the current spec cannot be calculated. The
+	// controller does not retry until the spec changes.
+	ConditionTypeFailed = "Failed"
+
+	// ReasonCalculated means the result has been computed.
+	ReasonCalculated = "Calculated"
+	// ReasonDivisionByZero means the calculation divides by zero.
+	ReasonDivisionByZero = "DivisionByZero"
+	// ReasonInvalidSpec means the spec cannot be evaluated, such as an unknown action.
+	ReasonInvalidSpec = "InvalidSpec"
+	// ReasonReferenceNotReady means a referenced Calculate does not exist or has no
+	// result yet. The controller calculates again when it changes.
+	ReasonReferenceNotReady = "ReferenceNotReady"
+	// ReasonCyclicReference means the Calculate depends on its own result through
+	// FirstFrom or SecondFrom.
+	ReasonCyclicReference = "CyclicReference"
+)
+
+// CalculateReference refers to another Calculate in the same namespace.
+type CalculateReference struct {
+	// The name of the referenced Calculate.
+	Name string `json:"name"`
+}
+
+// CalculateSpec defines the desired state of Calculate.
+// Exactly one of the operands (Operands, FirstFrom and SecondFrom) and Expression must be set.
+type CalculateSpec struct {
+	// The arithmetic action applied to the operands from left to right (add, sub, mul, or div).
+	// Must be empty when Expression is set.
+	Action ActionType `json:"action,omitempty"`
+	// The operands of the calculation, as decimal numbers such as "2" or "-1.5".
+	// They fill the positions not taken by FirstFrom and SecondFrom, in order.
+	Operands []string `json:"operands,omitempty"`
+	// Takes the first operand from the result of another Calculate.
+	FirstFrom *CalculateReference `json:"firstFrom,omitempty"`
+	// Takes the second operand from the result of another Calculate. Requires a first
+	// operand, either FirstFrom or Operands.
+	SecondFrom *CalculateReference `json:"secondFrom,omitempty"`
+	// An arithmetic expression over decimal numbers using +, -, *, / and parentheses,
+	// such as "(1 + 2) * 3.5".
+	Expression string `json:"expression,omitempty"`
+}
+
+// CalculateStatus defines the observed state of Calculate
+type CalculateStatus struct {
+	// The result of the calculation as a decimal number, rounded to 10 decimal places.
+	Result string `json:"result,omitempty"`
+	// The generation of the spec the controller last processed.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// The time the result was computed. Nil means no result has been computed for
+	// the current spec.
+	ComputedAt *metav1.Time `json:"computedAt,omitempty"`
+	// The latest available observations of the calculation.
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:storageversion
+// +kubebuilder:printcolumn:name="Action",type="string",JSONPath=".spec.action",description="The math action type"
+// +kubebuilder:printcolumn:name="Operands",type="string",JSONPath=".spec.operands",description="Input numbers"
+// +kubebuilder:printcolumn:name="Expression",type="string",JSONPath=".spec.expression",description="Input expression"
+// +kubebuilder:printcolumn:name="Result",type="string",JSONPath=".status.result",description="Calculate result"
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].status",description="Whether the result is up to date"
+// +kubebuilder:printcolumn:name="Reason",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].reason",description="Why the result is or is not up to date"
+// +kubebuilder:printcolumn:name="Message",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].message",priority=1,description="Details of the Ready condition"
+
+// Calculate is the Schema for the calculates API
+type Calculate struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CalculateSpec   `json:"spec,omitempty"`
+	Status CalculateStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// CalculateList contains a list of Calculate
+type CalculateList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Calculate `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Calculate{}, &CalculateList{})
+}
@@ -0,0 +1,183 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v2
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// log is for logging in this package.
+var calculatelog = logf.Log.WithName("calculate-resource")
+
+// SetupWebhookWithManager 用于设置 Controller Manager 以管理 Webhooks。
+func (r *Calculate) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/mutate-math-superproj-com-v2-calculate,mutating=true,failurePolicy=fail,sideEffects=None,groups=math.superproj.com,resources=calculates,verbs=create;update,versions=v2,name=mcalculate-v2.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Defaulter = &Calculate{}
+
+// Default implements webhook.Defaulter so a webhook will be registered for the type
+func (r *Calculate) Default() {
+	calculatelog.Info("default", "name", r.Name)
+
+	// 未指定 Expression 和 Action 时默认执行加法
+	if r.Spec.Expression == "" && r.Spec.Action == "" {
+		r.Spec.Action = ActionTypeAdd
+	}
+}
+
+// +kubebuilder:webhook:path=/validate-math-superproj-com-v2-calculate,mutating=false,failurePolicy=fail,sideEffects=None,groups=math.superproj.com,resources=calculates,verbs=create;update,versions=v2,name=vcalculate-v2.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Validator = &Calculate{}
+
+// ValidateCreate 实现了 webhook.Validator 接口中的 ValidateCreate() 方法，用于在创建对象时进行验证.
+func (r *Calculate) ValidateCreate() (admission.Warnings, error) {
+	calculatelog.Info("validate create", "name", r.Name)
+
+	return r.validate()
+}
+
+// ValidateUpdate 实现了 webhook.Validator 接口中的 ValidateUpdate() 方法，用于在更新对象时进行验证.
+func (r *Calculate) ValidateUpdate(old runtime.Object) (admission.Warnings, error) {
+	calculatelog.Info("validate update", "name", r.Name)
+
+	oldCalculate, ok := old.(*Calculate)
+	if !ok {
+		return nil, fmt.Errorf("expected a Calculate but got a %T", old)
+	}
+
+	warnings, err := r.validate()
+	if err != nil {
+		return warnings, err
+	}
+	return warnings, r.validateImmutable(oldCalculate)
+}
+
+// ValidateDelete 实现了 webhook.Validator 接口中的 ValidateDelete() 方法，用于在删除对象时进行验证.
+func (r *Calculate) ValidateDelete() (admission.Warnings, error) {
+	calculatelog.Info("validate delete", "name", r.Name)
+
+	return nil, nil
+}
+
+// validate 包含实际的验证逻辑.
+func (r *Calculate) validate() (admission.Warnings, error) {
+	allErrs := field.ErrorList{}
+
+	specPath := field.NewPath("spec")
+	references := r.Spec.References()
+	switch {
+	case r.Spec.Expression != "":
+		// 使用表达式时不能同时指定 Action 和操作数
+		if r.Spec.Action != "" {
+			allErrs = append(allErrs, field.Forbidden(specPath.Child("action"), "must be empty when expression is set"))
+		}
+		if len(r.Spec.Operands) > 0 {
+			allErrs = append(allErrs, field.Forbidden(specPath.Child("operands"), "must be empty when expression is set"))
+		}
+		if r.Spec.FirstFrom != nil {
+			allErrs = append(allErrs, field.Forbidden(specPath.Child("firstFrom"), "must be empty when expression is set"))
+		}
+		if r.Spec.SecondFrom != nil {
+			allErrs = append(allErrs, field.Forbidden(specPath.Child("secondFrom"), "must be empty when expression is set"))
+		}
+		if len(r.Spec.Expression) > MaxExpressionLength {
+			allErrs = append(allErrs, field.TooLong(specPath.Child("expression"), r.Spec.Expression, MaxExpressionLength))
+		}
+	case len(r.Spec.Operands) == 0 && len(references) == 0:
+		allErrs = append(allErrs, field.Required(specPath.Child("operands"), "either operands or expression must be set"))
+	default:
+		switch r.Spec.Action {
+		case ActionTypeAdd, ActionTypeSub, ActionTypeMul, ActionTypeDiv:
+		default:
+			allErrs = append(allErrs, field.NotSupported(specPath.Child("action"), r.Spec.Action,
+				[]string{string(ActionTypeAdd), string(ActionTypeSub), string(ActionTypeMul), string(ActionTypeDiv)}))
+		}
+		for i, operand := range r.Spec.Operands {
+			if _, err := ParseDecimal(operand); err != nil {
+				allErrs = append(allErrs, field.Invalid(specPath.Child("operands").Index(i), operand, err.Error()))
+			}
+		}
+		if r.Spec.FirstFrom != nil {
+			allErrs = append(allErrs, r.validateReference(specPath.Child("firstFrom"), r.Spec.FirstFrom)...)
+		}
+		if r.Spec.SecondFrom != nil {
+			allErrs = append(allErrs, r.validateReference(specPath.Child("secondFrom"), r.Spec.SecondFrom)...)
+			if r.Spec.FirstFrom == nil && len(r.Spec.Operands) == 0 {
+				allErrs = append(allErrs, field.Required(specPath.Child("operands"), "a first operand is required when secondFrom is set"))
+			}
+		}
+	}
+	if len(allErrs) > 0 || len(references) > 0 {
+		// 引用的结果由 Controller 计算时获取，除数为零等错误记录在 Status 中
+		return nil, allErrs.ToAggregate()
+	}
+
+	// 操作数都是常量，可以直接计算出结果，拒绝除数为零和无法解析的表达式
+	if _, err := r.Spec.Evaluate(); err != nil {
+		if r.Spec.Expression != "" {
+			allErrs = append(allErrs, field.Invalid(specPath.Child("expression"), r.Spec.Expression, err.Error()))
+		} else {
+			allErrs = append(allErrs, field.Invalid(specPath.Child("operands"), r.Spec.Operands, err.Error()))
+		}
+	}
+
+	return nil, allErrs.ToAggregate()
+}
+
+// validateReference 校验对其他 Calculate 的引用：名称必须合法，且不能引用自身.
+func (r *Calculate) validateReference(path *field.Path, ref *CalculateReference) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	namePath := path.Child("name")
+	switch {
+	case ref.Name == "":
+		allErrs = append(allErrs, field.Required(namePath, ""))
+	case ref.Name == r.Name:
+		allErrs = append(allErrs, field.Invalid(namePath, ref.Name, "cannot reference itself"))
+	default:
+		for _, msg := range validation.IsDNS1123Subdomain(ref.Name) {
+			allErrs = append(allErrs, field.Invalid(namePath, ref.Name, msg))
+		}
+	}
+
+	return allErrs
+}
+
+// validateImmutable 包含更新时的不可变规则：计算出结果后，不允许再修改 Action.
+func (r *Calculate) validateImmutable(old *Calculate) error {
+	allErrs := field.ErrorList{}
+
+	if old.Status.ComputedAt != nil && r.Spec.Action != old.Spec.Action {
+		allErrs = append(allErrs, field.Forbidden(field.NewPath("spec", "action"),
+			fmt.Sprintf("cannot change action from %q to %q after the result has been computed", old.Spec.Action, r.Spec.Action)))
+	}
+
+	return allErrs.ToAggregate()
+}
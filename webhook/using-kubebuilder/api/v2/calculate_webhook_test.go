@@ -0,0 +1,103 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v2
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// newCalculate 返回 default 命名空间下的 Calculate.
+func newCalculate(name string, spec CalculateSpec) *Calculate {
+	return &Calculate{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec:       spec,
+	}
+}
+
+var _ = Describe("Calculate Webhook", func() {
+
+	AfterEach(func() {
+		Expect(k8sClient.DeleteAllOf(ctx, &Calculate{}, client.InNamespace("default"))).To(Succeed())
+	})
+
+	Context("When creating Calculate under Defaulting Webhook", func() {
+		It("Should default the action when operands are set", func() {
+			calculate := newCalculate("default-action", CalculateSpec{Operands: []string{"1", "2"}})
+			Expect(k8sClient.Create(ctx, calculate)).To(Succeed())
+			Expect(calculate.Spec.Action).To(Equal(ActionTypeAdd))
+		})
+
+		It("Should not default the action when an expression is set", func() {
+			calculate := newCalculate("expression", CalculateSpec{Expression: "1 + 2"})
+			Expect(k8sClient.Create(ctx, calculate)).To(Succeed())
+			Expect(calculate.Spec.Action).To(BeEmpty())
+		})
+	})
+
+	Context("When creating Calculate under Validating Webhook", func() {
+		DescribeTable("Should deny an invalid spec",
+			func(spec CalculateSpec, message string) {
+				err := k8sClient.Create(ctx, newCalculate("invalid", spec))
+				Expect(apierrors.IsForbidden(err)).To(BeTrue(), "unexpected error: %v", err)
+				Expect(err.Error()).To(ContainSubstring(message))
+			},
+			Entry("no operands or expression", CalculateSpec{}, "spec.operands: Required value"),
+			Entry("operands and expression", CalculateSpec{Operands: []string{"1"}, Expression: "1"}, "spec.operands: Forbidden"),
+			Entry("action and expression", CalculateSpec{Action: ActionTypeMul, Expression: "1"}, "spec.action: Forbidden"),
+			Entry("unknown action", CalculateSpec{Action: "pow", Operands: []string{"2", "3"}}, `spec.action: Unsupported value: "pow"`),
+			Entry("invalid operand", CalculateSpec{Operands: []string{"1", "1e3"}}, `spec.operands[1]: Invalid value: "1e3"`),
+			Entry("division by zero", CalculateSpec{Action: ActionTypeDiv, Operands: []string{"1", "0.0"}}, "division by zero"),
+			Entry("invalid expression", CalculateSpec{Expression: "(1 + 2"}, "spec.expression: Invalid value"),
+			Entry("division by zero in an expression", CalculateSpec{Expression: "1 / (2 - 2)"}, "division by zero"),
+			Entry("reference and expression", CalculateSpec{Expression: "1", FirstFrom: &CalculateReference{Name: "other"}}, "spec.firstFrom: Forbidden"),
+			Entry("reference without a name", CalculateSpec{Operands: []string{"1"}, SecondFrom: &CalculateReference{}}, "spec.secondFrom.name: Required value"),
+			Entry("reference to itself", CalculateSpec{FirstFrom: &CalculateReference{Name: "invalid"}}, "cannot reference itself"),
+			Entry("secondFrom without a first operand", CalculateSpec{SecondFrom: &CalculateReference{Name: "other"}}, "spec.operands: Required value: a first operand is required"),
+		)
+
+		It("Should admit a valid spec", func() {
+			Expect(k8sClient.Create(ctx, newCalculate("operands", CalculateSpec{Action: ActionTypeDiv, Operands: []string{"1", "3", "0.5"}}))).To(Succeed())
+			Expect(k8sClient.Create(ctx, newCalculate("expression", CalculateSpec{Expression: "(1 + 2) * 3.5 - 10 / 4"}))).To(Succeed())
+			Expect(k8sClient.Create(ctx, newCalculate("references", CalculateSpec{
+				Action:     ActionTypeDiv,
+				FirstFrom:  &CalculateReference{Name: "operands"},
+				SecondFrom: &CalculateReference{Name: "expression"},
+			}))).To(Succeed())
+		})
+	})
+
+	Context("When updating Calculate under Validating Webhook", func() {
+		It("Should deny an action change after the result is computed", func() {
+			calculate := newCalculate("computed", CalculateSpec{Action: ActionTypeAdd, Operands: []string{"1", "2"}})
+			Expect(k8sClient.Create(ctx, calculate)).To(Succeed())
+			now := metav1.Now()
+			calculate.Status = CalculateStatus{Result: "3", ObservedGeneration: calculate.Generation, ComputedAt: &now}
+			Expect(k8sClient.Status().Update(ctx, calculate)).To(Succeed())
+
+			calculate.Spec.Action = ActionTypeMul
+			err := k8sClient.Update(ctx, calculate)
+			Expect(apierrors.IsForbidden(err)).To(BeTrue(), "unexpected error: %v", err)
+			Expect(err.Error()).To(ContainSubstring("cannot change action"))
+		})
+	})
+
+})
@@ -0,0 +1,290 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v2
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+)
+
+const (
+	// MaxExpressionLength is the maximum length of Spec.Expression.
+	MaxExpressionLength = 1024
+	// ResultScale is the number of decimal places Status.Result is rounded to.
+	ResultScale = 10
+)
+
+// ErrDivisionByZero is returned when a calculation divides by zero.
+var ErrDivisionByZero = errors.New("division by zero")
+
+// decimalPattern matches the decimal numbers accepted as operands, such as "2", "-1.5" or ".5".
+var decimalPattern = regexp.MustCompile(`^[+-]?([0-9]+(\.[0-9]*)?|\.[0-9]+)$`)
+
+// ParseDecimal 解析十进制数，不接受指数、分数和进制前缀.
+func ParseDecimal(s string) (*big.Rat, error) {
+	if !decimalPattern.MatchString(s) {
+		return nil, fmt.Errorf("%q is not a decimal number", s)
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, fmt.Errorf("%q is not a decimal number", s)
+	}
+	return r, nil
+}
+
+// FormatResult 把结果格式化为十进制数，保留 ResultScale 位小数并去掉末尾的 0.
+func FormatResult(r *big.Rat) string {
+	if r.IsInt() {
+		return r.Num().String()
+	}
+	s := r.FloatString(ResultScale)
+	s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	if s == "-0" {
+		return "0"
+	}
+	return s
+}
+
+// Evaluate 计算 Spec 的结果：设置了 Expression 时计算表达式，否则按 Action 从左到右依次计算操作数.
+// 引用了其他 Calculate 的 Spec 需要使用 EvaluateWith.
+func (s *CalculateSpec) Evaluate() (*big.Rat, error) {
+	return s.EvaluateWith(nil)
+}
+
+// EvaluateWith 与 Evaluate 相同，results 是 FirstFrom 和 SecondFrom 引用的 Calculate 的结果，键为名称.
+func (s *CalculateSpec) EvaluateWith(results map[string]string) (*big.Rat, error) {
+	if s.Expression != "" {
+		return EvaluateExpression(s.Expression)
+	}
+	operands, err := s.resolveOperands(results)
+	if err != nil {
+		return nil, err
+	}
+	if len(operands) == 0 {
+		return nil, errors.New("no operands")
+	}
+	result, err := ParseDecimal(operands[0])
+	if err != nil {
+		return nil, err
+	}
+	for _, operand := range operands[1:] {
+		x, err := ParseDecimal(operand)
+		if err != nil {
+			return nil, err
+		}
+		if result, err = apply(s.Action, result, x); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// References 返回 FirstFrom 和 SecondFrom 引用的 Calculate 的名称.
+func (s *CalculateSpec) References() []string {
+	var names []string
+	for _, ref := range []*CalculateReference{s.FirstFrom, s.SecondFrom} {
+		if ref != nil {
+			names = append(names, ref.Name)
+		}
+	}
+	return names
+}
+
+// resolveOperands 按顺序返回全部操作数：FirstFrom 和 SecondFrom 分别是第一个和第二个操作数，
+// Operands 依次填充其余的位置.
+func (s *CalculateSpec) resolveOperands(results map[string]string) ([]string, error) {
+	if s.FirstFrom == nil && s.SecondFrom != nil && len(s.Operands) == 0 {
+		return nil, errors.New("secondFrom requires a first operand")
+	}
+	literals := s.Operands
+	var operands []string
+	for _, ref := range []*CalculateReference{s.FirstFrom, s.SecondFrom} {
+		if ref == nil {
+			if len(literals) == 0 {
+				break
+			}
+			operands = append(operands, literals[0])
+			literals = literals[1:]
+			continue
+		}
+		result, ok := results[ref.Name]
+		if !ok {
+			return nil, fmt.Errorf("the result of Calculate %q is unknown", ref.Name)
+		}
+		operands = append(operands, result)
+	}
+	return append(operands, literals...), nil
+}
+
+func apply(action ActionType, x, y *big.Rat) (*big.Rat, error) {
+	switch action {
+	case ActionTypeAdd:
+		return new(big.Rat).Add(x, y), nil
+	case ActionTypeSub:
+		return new(big.Rat).Sub(x, y), nil
+	case ActionTypeMul:
+		return new(big.Rat).Mul(x, y), nil
+	case ActionTypeDiv:
+		if y.Sign() == 0 {
+			return nil, ErrDivisionByZero
+		}
+		return new(big.Rat).Quo(x, y), nil
+	}
+	return nil, fmt.Errorf("unknown action type %q", action)
+}
+
+// EvaluateExpression 计算由十进制数、+、-、*、/ 和括号组成的表达式.
+//
+//	expression = term { ("+" | "-") term }
+//	term       = factor { ("*" | "/") factor }
+//	factor     = ("+" | "-") factor | number | "(" expression ")"
+func EvaluateExpression(expr string) (*big.Rat, error) {
+	if len(expr) > MaxExpressionLength {
+		return nil, fmt.Errorf("expression is longer than %d characters", MaxExpressionLength)
+	}
+	p := &parser{input: expr}
+	result, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if p.skipSpaces(); p.pos < len(p.input) {
+		return nil, p.errorf("unexpected %q", p.input[p.pos])
+	}
+	return result, nil
+}
+
+// parser 是表达式的递归下降解析器，解析的同时计算结果.
+type parser struct {
+	input string
+	pos   int
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("at position %d: %s", p.pos+1, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) skipSpaces() {
+	for p.pos < len(p.input) && (p.input[p.pos] == ' ' || p.input[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// peek 返回下一个非空白字符，到达末尾时返回 0.
+func (p *parser) peek() byte {
+	p.skipSpaces()
+	if p.pos < len(p.input) {
+		return p.input[p.pos]
+	}
+	return 0
+}
+
+func (p *parser) expression() (*big.Rat, error) {
+	result, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var action ActionType
+		switch p.peek() {
+		case '+':
+			action = ActionTypeAdd
+		case '-':
+			action = ActionTypeSub
+		default:
+			return result, nil
+		}
+		p.pos++
+		y, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		if result, err = apply(action, result, y); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) term() (*big.Rat, error) {
+	result, err := p.factor()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var action ActionType
+		switch p.peek() {
+		case '*':
+			action = ActionTypeMul
+		case '/':
+			action = ActionTypeDiv
+		default:
+			return result, nil
+		}
+		p.pos++
+		pos := p.pos
+		y, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		if result, err = apply(action, result, y); err != nil {
+			return nil, fmt.Errorf("at position %d: %w", pos+1, err)
+		}
+	}
+}
+
+func (p *parser) factor() (*big.Rat, error) {
+	switch c := p.peek(); {
+	case c == '+' || c == '-':
+		p.pos++
+		x, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		if c == '-' {
+			x.Neg(x)
+		}
+		return x, nil
+	case c == '(':
+		p.pos++
+		x, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, p.errorf("missing )")
+		}
+		p.pos++
+		return x, nil
+	case c == '.' || (c >= '0' && c <= '9'):
+		start := p.pos
+		for p.pos < len(p.input) && (p.input[p.pos] == '.' || (p.input[p.pos] >= '0' && p.input[p.pos] <= '9')) {
+			p.pos++
+		}
+		x, err := ParseDecimal(p.input[start:p.pos])
+		if err != nil {
+			p.pos = start
+			return nil, p.errorf("%v", err)
+		}
+		return x, nil
+	case c == 0:
+		return nil, p.errorf("unexpected end of expression")
+	default:
+		return nil, p.errorf("unexpected %q", c)
+	}
+}
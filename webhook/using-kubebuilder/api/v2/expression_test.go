@@ -0,0 +1,141 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v2
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		name string
+		spec CalculateSpec
+		want string
+	}{
+		{"add", CalculateSpec{Action: ActionTypeAdd, Operands: []string{"1", "2", "3.5"}}, "6.5"},
+		{"sub", CalculateSpec{Action: ActionTypeSub, Operands: []string{"1", "2.25"}}, "-1.25"},
+		{"mul", CalculateSpec{Action: ActionTypeMul, Operands: []string{"9223372036854775807", "2"}}, "18446744073709551614"},
+		{"div", CalculateSpec{Action: ActionTypeDiv, Operands: []string{"1", "3"}}, "0.3333333333"},
+		{"div rounds", CalculateSpec{Action: ActionTypeDiv, Operands: []string{"2", "3"}}, "0.6666666667"},
+		{"single operand", CalculateSpec{Action: ActionTypeDiv, Operands: []string{"-.5"}}, "-0.5"},
+		{"tiny result", CalculateSpec{Action: ActionTypeDiv, Operands: []string{"-1", "100000000000"}}, "0"},
+		{"precedence", CalculateSpec{Expression: "1 + 2 * 3"}, "7"},
+		{"parentheses", CalculateSpec{Expression: "(1 + 2) * 3.5 - 10 / 4"}, "8"},
+		{"left associative", CalculateSpec{Expression: "8 / 4 / 2 - 1 - 1"}, "-1"},
+		{"unary", CalculateSpec{Expression: "-(2 - 5) * +-1"}, "-3"},
+		{"spaces", CalculateSpec{Expression: "\t1.5*  2 "}, "3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := tt.spec.Evaluate()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := FormatResult(result); got != tt.want {
+				t.Errorf("result = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		spec CalculateSpec
+		want string
+	}{
+		{"no operands", CalculateSpec{Action: ActionTypeAdd}, "no operands"},
+		{"invalid operand", CalculateSpec{Action: ActionTypeAdd, Operands: []string{"1", "0x10"}}, `"0x10" is not a decimal number`},
+		{"unknown action", CalculateSpec{Action: "pow", Operands: []string{"1", "2"}}, `unknown action type "pow"`},
+		{"division by zero", CalculateSpec{Action: ActionTypeDiv, Operands: []string{"1", "0"}}, "division by zero"},
+		{"empty expression", CalculateSpec{Expression: " "}, "at position 2: unexpected end of expression"},
+		{"missing parenthesis", CalculateSpec{Expression: "(1 + 2"}, "at position 7: missing )"},
+		{"trailing input", CalculateSpec{Expression: "1 + 2)"}, `at position 6: unexpected ')'`},
+		{"unknown operator", CalculateSpec{Expression: "2 ^ 3"}, `at position 3: unexpected '^'`},
+		{"invalid number", CalculateSpec{Expression: "1.2.3"}, `at position 1: "1.2.3" is not a decimal number`},
+		{"division by zero in expression", CalculateSpec{Expression: "1 / (2 - 2)"}, "at position 4: division by zero"},
+		{"too long", CalculateSpec{Expression: strings.Repeat("1+", MaxExpressionLength) + "1"}, "expression is longer than 1024 characters"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.spec.Evaluate()
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("error = %v, want %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateWith(t *testing.T) {
+	results := map[string]string{"a": "10", "b": "0.5"}
+	tests := []struct {
+		name string
+		spec CalculateSpec
+		want string
+	}{
+		{"first", CalculateSpec{Action: ActionTypeSub, FirstFrom: &CalculateReference{Name: "a"}, Operands: []string{"1", "2"}}, "7"},
+		{"second", CalculateSpec{Action: ActionTypeSub, SecondFrom: &CalculateReference{Name: "a"}, Operands: []string{"1", "2"}}, "-11"},
+		{"both", CalculateSpec{Action: ActionTypeDiv, FirstFrom: &CalculateReference{Name: "a"}, SecondFrom: &CalculateReference{Name: "b"}}, "20"},
+		{"both with operands", CalculateSpec{Action: ActionTypeDiv, FirstFrom: &CalculateReference{Name: "b"}, SecondFrom: &CalculateReference{Name: "a"}, Operands: []string{"4"}}, "0.0125"},
+		{"same reference", CalculateSpec{Action: ActionTypeMul, FirstFrom: &CalculateReference{Name: "a"}, SecondFrom: &CalculateReference{Name: "a"}}, "100"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := tt.spec.EvaluateWith(results)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := FormatResult(result); got != tt.want {
+				t.Errorf("result = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateWithErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    CalculateSpec
+		results map[string]string
+		want    string
+	}{
+		{"unknown result", CalculateSpec{Action: ActionTypeAdd, FirstFrom: &CalculateReference{Name: "a"}}, nil, `the result of Calculate "a" is unknown`},
+		{"no first operand", CalculateSpec{Action: ActionTypeAdd, SecondFrom: &CalculateReference{Name: "a"}}, map[string]string{"a": "1"}, "secondFrom requires a first operand"},
+		{"division by zero", CalculateSpec{Action: ActionTypeDiv, Operands: []string{"1"}, SecondFrom: &CalculateReference{Name: "a"}}, map[string]string{"a": "0"}, "division by zero"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.spec.EvaluateWith(tt.results)
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("error = %v, want %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDivisionByZeroIsDetectable(t *testing.T) {
+	for _, spec := range []CalculateSpec{
+		{Action: ActionTypeDiv, Operands: []string{"1", "0"}},
+		{Expression: "1 / 0"},
+	} {
+		if _, err := spec.Evaluate(); !errors.Is(err, ErrDivisionByZero) {
+			t.Errorf("%+v: error = %v, want ErrDivisionByZero", spec, err)
+		}
+	}
+}
@@ -36,6 +36,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	mathv1 "github.com/ashwinyue/kubernetes-examples/webhook/using-kubebuilder/api/v1"
+	mathv2 "github.com/ashwinyue/kubernetes-examples/webhook/using-kubebuilder/api/v2"
 	"github.com/ashwinyue/kubernetes-examples/webhook/using-kubebuilder/internal/controller"
 	// +kubebuilder:scaffold:imports
 )
@@ -49,6 +50,7 @@ func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
 	utilruntime.Must(mathv1.AddToScheme(scheme))
+	utilruntime.Must(mathv2.AddToScheme(scheme))
 	// +kubebuilder:scaffold:scheme
 }
 
@@ -140,8 +142,9 @@ func main() {
 	}
 
 	if err = (&controller.CalculateReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("calculate-controller"),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Calculate")
 		os.Exit(1)
@@ -151,6 +154,10 @@ func main() {
 			setupLog.Error(err, "unable to create webhook", "webhook", "Calculate")
 			os.Exit(1)
 		}
+		if err = (&mathv2.Calculate{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Calculate")
+			os.Exit(1)
+		}
 	}
 	// +kubebuilder:scaffold:builder
 
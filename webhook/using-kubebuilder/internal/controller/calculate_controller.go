@@ -18,25 +18,52 @@ package controller
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
-	mathv1 "github.com/ashwinyue/kubernetes-examples/webhook/using-kubebuilder/api/v1"
+	mathv2 "github.com/ashwinyue/kubernetes-examples/webhook/using-kubebuilder/api/v2"
 )
 
+// calculateReferenceField 是 Calculate 的索引字段，值为 FirstFrom 和 SecondFrom 引用的名称.
+const calculateReferenceField = ".spec.references"
+
 // CalculateReconciler reconciles a Calculate object
 type CalculateReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+}
+
+// outcome 是一次计算的结果，用于设置 Status、Condition 和 Event.
+type outcome struct {
+	// 计算结果，ready 为 false 时为空
+	result string
+	ready  bool
+	// 无法通过重试解决的错误，如除数为零和循环引用
+	err     error
+	reason  string
+	message string
 }
 
 // +kubebuilder:rbac:groups=math.superproj.com,resources=calculates,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=math.superproj.com,resources=calculates/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=math.superproj.com,resources=calculates/finalizers,verbs=update
+// +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -48,29 +75,44 @@ type CalculateReconciler struct {
 // For more details, check Reconcile and its Result here:
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.18.4/pkg/reconcile
 func (r *CalculateReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
-	var cal mathv1.Calculate
+	// 在 Hub 版本（v2）上计算，v1 的对象由转换 Webhook 转换
+	var cal mathv2.Calculate
 	if err := r.Get(ctx, req.NamespacedName, &cal); err != nil {
 		klog.Error(err, "unable to fetch calculate")
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 	klog.Infof("Found the calculate object %v", cal)
 
-	klog.Infof("Calculating the calculate of %d and %d with action %s", cal.Spec.First, cal.Spec.Second, cal.Spec.Action)
-	switch cal.Spec.Action {
-	case mathv1.ActionTypeAdd:
-		cal.Status.Result = cal.Spec.First + cal.Spec.Second
-	case mathv1.ActionTypeSub:
-		cal.Status.Result = cal.Spec.First - cal.Spec.Second
-	case mathv1.ActionTypeMul:
-		cal.Status.Result = cal.Spec.First * cal.Spec.Second
-	case mathv1.ActionTypeDiv:
-		if cal.Spec.Second == 0 {
-			return ctrl.Result{}, fmt.Errorf("the divisor cannot be zero whtn action is division")
+	if cal.Spec.Expression != "" {
+		klog.Infof("Calculating the expression %q", cal.Spec.Expression)
+	} else {
+		klog.Infof("Calculating the calculate of %v with action %s", cal.Spec.Operands, cal.Spec.Action)
+	}
+	o, err := r.calculate(ctx, &cal)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	status := cal.Status.DeepCopy()
+	status.ObservedGeneration = cal.Generation
+	if o.ready {
+		// 结果没有变化时保留原来的计算时间
+		if status.ComputedAt == nil || status.Result != o.result || cal.Status.ObservedGeneration != cal.Generation {
+			now := metav1.Now()
+			status.ComputedAt = &now
 		}
-		cal.Status.Result = cal.Spec.First / cal.Spec.Second
-	default:
-		return ctrl.Result{}, fmt.Errorf("unknown action type")
+		status.Result = o.result
+	} else {
+		status.Result = ""
+		status.ComputedAt = nil
+	}
+	setConditions(status, cal.Generation, o)
+
+	// 写入 Status 和被引用的对象变化都会触发调谐，Status 没有变化时不再更新，也不重复记录 Event
+	if equality.Semantic.DeepEqual(status, &cal.Status) {
+		return ctrl.Result{}, nil
 	}
+	cal.Status = *status
 
 	klog.Info("Updating the result of calculation")
 	if err := r.Status().Update(ctx, &cal); err != nil {
@@ -78,12 +120,154 @@ func (r *CalculateReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		return ctrl.Result{}, err
 	}
 
+	if o.err != nil {
+		// 计算错误是永久性的，重试也不会成功：记录到 Status 和 Event 后不再重新入队，
+		// 直到 spec 或被引用的对象被修改
+		klog.Errorf("Failed to calculate %s: %v", req.NamespacedName, o.err)
+		r.Recorder.Event(&cal, corev1.EventTypeWarning, o.reason, o.message)
+		return ctrl.Result{}, reconcile.TerminalError(o.err)
+	}
+	r.Recorder.Event(&cal, corev1.EventTypeNormal, o.reason, o.message)
+
 	return ctrl.Result{}, nil
 }
 
+// calculate 计算 cal 的结果，返回的错误只包括读取被引用的对象时出现的可重试的错误.
+func (r *CalculateReconciler) calculate(ctx context.Context, cal *mathv2.Calculate) (outcome, error) {
+	cycle, err := r.findCycle(ctx, cal)
+	if err != nil {
+		return outcome{}, err
+	}
+	if cycle != nil {
+		err := fmt.Errorf("cyclic reference: %s", strings.Join(cycle, " -> "))
+		return outcome{err: err, reason: mathv2.ReasonCyclicReference, message: err.Error()}, nil
+	}
+
+	results := map[string]string{}
+	for _, name := range cal.Spec.References() {
+		var ref mathv2.Calculate
+		if err := r.Get(ctx, types.NamespacedName{Namespace: cal.Namespace, Name: name}, &ref); err != nil {
+			if apierrors.IsNotFound(err) {
+				// 被引用的对象创建后会重新调谐
+				return outcome{reason: mathv2.ReasonReferenceNotReady, message: fmt.Sprintf("waiting for Calculate %q to be created", name)}, nil
+			}
+			return outcome{}, err
+		}
+		if !isReady(&ref) {
+			return outcome{reason: mathv2.ReasonReferenceNotReady, message: fmt.Sprintf("waiting for the result of Calculate %q", name)}, nil
+		}
+		results[name] = ref.Status.Result
+	}
+
+	result, err := cal.Spec.EvaluateWith(results)
+	if err != nil {
+		reason := mathv2.ReasonInvalidSpec
+		if errors.Is(err, mathv2.ErrDivisionByZero) {
+			reason = mathv2.ReasonDivisionByZero
+		}
+		return outcome{err: err, reason: reason, message: err.Error()}, nil
+	}
+	value := mathv2.FormatResult(result)
+	return outcome{result: value, ready: true, reason: mathv2.ReasonCalculated, message: "The result is " + value}, nil
+}
+
+// findCycle 沿 FirstFrom 和 SecondFrom 查找从 cal 出发又回到 cal 的引用链，没有时返回 nil.
+// 不经过 cal 的循环由循环中的对象各自报告.
+func (r *CalculateReconciler) findCycle(ctx context.Context, cal *mathv2.Calculate) ([]string, error) {
+	visited := map[string]bool{}
+	var visit func(name string, path []string) ([]string, error)
+	visit = func(name string, path []string) ([]string, error) {
+		path = append(path[:len(path):len(path)], name)
+		if name == cal.Name {
+			return path, nil
+		}
+		if visited[name] {
+			return nil, nil
+		}
+		visited[name] = true
+
+		var ref mathv2.Calculate
+		if err := r.Get(ctx, types.NamespacedName{Namespace: cal.Namespace, Name: name}, &ref); err != nil {
+			return nil, client.IgnoreNotFound(err)
+		}
+		for _, next := range ref.Spec.References() {
+			if cycle, err := visit(next, path); cycle != nil || err != nil {
+				return cycle, err
+			}
+		}
+		return nil, nil
+	}
+
+	for _, name := range cal.Spec.References() {
+		if cycle, err := visit(name, []string{cal.Name}); cycle != nil || err != nil {
+			return cycle, err
+		}
+	}
+	return nil, nil
+}
+
+// setConditions 根据计算结果设置 Ready 和 Failed 两个 Condition.
+func setConditions(status *mathv2.CalculateStatus, generation int64, o outcome) {
+	ready, failed := metav1.ConditionFalse, metav1.ConditionFalse
+	if o.ready {
+		ready = metav1.ConditionTrue
+	}
+	if o.err != nil {
+		failed = metav1.ConditionTrue
+	}
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               mathv2.ConditionTypeReady,
+		Status:             ready,
+		ObservedGeneration: generation,
+		Reason:             o.reason,
+		Message:            o.message,
+	})
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               mathv2.ConditionTypeFailed,
+		Status:             failed,
+		ObservedGeneration: generation,
+		Reason:             o.reason,
+		Message:            o.message,
+	})
+}
+
+// isReady 判断 Status.Result 是否为当前 spec 的结果.
+func isReady(cal *mathv2.Calculate) bool {
+	if cal.Status.ObservedGeneration != cal.Generation {
+		return false
+	}
+	ready := meta.FindStatusCondition(cal.Status.Conditions, mathv2.ConditionTypeReady)
+	return ready != nil && ready.Status == metav1.ConditionTrue && ready.ObservedGeneration == cal.Generation
+}
+
+// findDependents 返回引用了 obj 的 Calculate，obj 变化时需要重新计算它们.
+func (r *CalculateReconciler) findDependents(ctx context.Context, obj client.Object) []reconcile.Request {
+	var dependents mathv2.CalculateList
+	if err := r.List(ctx, &dependents, client.InNamespace(obj.GetNamespace()),
+		client.MatchingFields{calculateReferenceField: obj.GetName()}); err != nil {
+		klog.Error(err, "unable to list dependent calculates")
+		return nil
+	}
+
+	requests := make([]reconcile.Request, len(dependents.Items))
+	for i, item := range dependents.Items {
+		requests[i] = reconcile.Request{NamespacedName: types.NamespacedName{Namespace: item.Namespace, Name: item.Name}}
+	}
+	return requests
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *CalculateReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	// 按引用的名称索引 Calculate，被引用的对象变化时据此找到引用它的对象
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &mathv2.Calculate{}, calculateReferenceField,
+		func(obj client.Object) []string {
+			return obj.(*mathv2.Calculate).Spec.References()
+		}); err != nil {
+		return err
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&mathv1.Calculate{}).
+		For(&mathv2.Calculate{}).
+		Watches(&mathv2.Calculate{}, handler.EnqueueRequestsFromMapFunc(r.findDependents)).
 		Complete(r)
 }
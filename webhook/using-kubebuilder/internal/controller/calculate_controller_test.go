@@ -22,12 +22,15 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
-	mathv1 "github.com/superproj/webhook-with-kubebuilder/api/v1"
+	mathv2 "github.com/ashwinyue/kubernetes-examples/webhook/using-kubebuilder/api/v2"
 )
 
 var _ = Describe("Calculate Controller", func() {
@@ -40,18 +43,21 @@ var _ = Describe("Calculate Controller", func() {
 			Name:      resourceName,
 			Namespace: "default", // TODO(user):Modify as needed
 		}
-		calculate := &mathv1.Calculate{}
+		calculate := &mathv2.Calculate{}
 
 		BeforeEach(func() {
 			By("creating the custom resource for the Kind Calculate")
 			err := k8sClient.Get(ctx, typeNamespacedName, calculate)
 			if err != nil && errors.IsNotFound(err) {
-				resource := &mathv1.Calculate{
+				resource := &mathv2.Calculate{
 					ObjectMeta: metav1.ObjectMeta{
 						Name:      resourceName,
 						Namespace: "default",
 					},
-					// TODO(user): Specify other spec details if needed.
+					Spec: mathv2.CalculateSpec{
+						Action:   mathv2.ActionTypeDiv,
+						Operands: []string{"1", "4"},
+					},
 				}
 				Expect(k8sClient.Create(ctx, resource)).To(Succeed())
 			}
@@ -59,7 +65,7 @@ var _ = Describe("Calculate Controller", func() {
 
 		AfterEach(func() {
 			// TODO(user): Cleanup logic after each test, like removing the resource instance.
-			resource := &mathv1.Calculate{}
+			resource := &mathv2.Calculate{}
 			err := k8sClient.Get(ctx, typeNamespacedName, resource)
 			Expect(err).NotTo(HaveOccurred())
 
@@ -68,17 +74,178 @@ var _ = Describe("Calculate Controller", func() {
 		})
 		It("should successfully reconcile the resource", func() {
 			By("Reconciling the created resource")
+			recorder := record.NewFakeRecorder(10)
+			controllerReconciler := &CalculateReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Recorder: recorder,
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, calculate)).To(Succeed())
+			Expect(calculate.Status.Result).To(Equal("0.25"))
+			Expect(calculate.Status.ObservedGeneration).To(Equal(calculate.Generation))
+			Expect(calculate.Status.ComputedAt).NotTo(BeNil())
+			Expect(meta.IsStatusConditionTrue(calculate.Status.Conditions, mathv2.ConditionTypeReady)).To(BeTrue())
+			Expect(meta.IsStatusConditionFalse(calculate.Status.Conditions, mathv2.ConditionTypeFailed)).To(BeTrue())
+			Expect(recorder.Events).To(Receive(Equal("Normal Calculated The result is 0.25")))
+
+			By("Reconciling the resource again without changes")
+			computedAt := calculate.Status.ComputedAt
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, calculate)).To(Succeed())
+			Expect(calculate.Status.ComputedAt).To(Equal(computedAt))
+			Expect(recorder.Events).NotTo(Receive())
+		})
+	})
+
+	Context("When the calculation fails", func() {
+		const resourceName = "divide-by-zero"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		BeforeEach(func() {
+			// Controller 测试没有启动 Webhook，可以直接创建除数为零的对象
+			resource := &mathv2.Calculate{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+				},
+				Spec: mathv2.CalculateSpec{
+					Action:   mathv2.ActionTypeDiv,
+					Operands: []string{"1", "0"},
+				},
+			}
+			Expect(k8sClient.Create(ctx, resource)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			resource := &mathv2.Calculate{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+		})
+
+		It("should record the failure and stop requeuing", func() {
+			recorder := record.NewFakeRecorder(10)
 			controllerReconciler := &CalculateReconciler{
-				Client: k8sClient,
-				Scheme: k8sClient.Scheme(),
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Recorder: recorder,
 			}
 
 			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
 				NamespacedName: typeNamespacedName,
 			})
+			Expect(err).To(MatchError(reconcile.TerminalError(nil)))
+
+			calculate := &mathv2.Calculate{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, calculate)).To(Succeed())
+			Expect(calculate.Status.Result).To(BeEmpty())
+			Expect(calculate.Status.ComputedAt).To(BeNil())
+			Expect(calculate.Status.ObservedGeneration).To(Equal(calculate.Generation))
+
+			ready := meta.FindStatusCondition(calculate.Status.Conditions, mathv2.ConditionTypeReady)
+			Expect(ready).NotTo(BeNil())
+			Expect(ready.Status).To(Equal(metav1.ConditionFalse))
+			Expect(ready.Reason).To(Equal(mathv2.ReasonDivisionByZero))
+			Expect(meta.IsStatusConditionTrue(calculate.Status.Conditions, mathv2.ConditionTypeFailed)).To(BeTrue())
+			Expect(recorder.Events).To(Receive(HavePrefix("Warning DivisionByZero")))
+		})
+	})
+
+	Context("When a calculation references other calculations", func() {
+		ctx := context.Background()
+
+		var controllerReconciler *CalculateReconciler
+
+		newCalculate := func(name string, spec mathv2.CalculateSpec) *mathv2.Calculate {
+			return &mathv2.Calculate{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+				Spec:       spec,
+			}
+		}
+
+		reconcileCalculate := func(name string) (*mathv2.Calculate, error) {
+			key := types.NamespacedName{Name: name, Namespace: "default"}
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+			calculate := &mathv2.Calculate{}
+			Expect(k8sClient.Get(ctx, key, calculate)).To(Succeed())
+			return calculate, err
+		}
+
+		BeforeEach(func() {
+			controllerReconciler = &CalculateReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Recorder: record.NewFakeRecorder(10),
+			}
+		})
+
+		AfterEach(func() {
+			Expect(k8sClient.DeleteAllOf(ctx, &mathv2.Calculate{}, client.InNamespace("default"))).To(Succeed())
+		})
+
+		It("should wait for the referenced result and then use it", func() {
+			Expect(k8sClient.Create(ctx, newCalculate("base", mathv2.CalculateSpec{
+				Action:   mathv2.ActionTypeAdd,
+				Operands: []string{"1", "2"},
+			}))).To(Succeed())
+			Expect(k8sClient.Create(ctx, newCalculate("chained", mathv2.CalculateSpec{
+				Action:    mathv2.ActionTypeSub,
+				FirstFrom: &mathv2.CalculateReference{Name: "base"},
+				Operands:  []string{"10"},
+			}))).To(Succeed())
+
+			By("Reconciling the dependent before the referenced result is computed")
+			chained, err := reconcileCalculate("chained")
+			Expect(err).NotTo(HaveOccurred())
+			ready := meta.FindStatusCondition(chained.Status.Conditions, mathv2.ConditionTypeReady)
+			Expect(ready).NotTo(BeNil())
+			Expect(ready.Status).To(Equal(metav1.ConditionFalse))
+			Expect(ready.Reason).To(Equal(mathv2.ReasonReferenceNotReady))
+			Expect(meta.IsStatusConditionFalse(chained.Status.Conditions, mathv2.ConditionTypeFailed)).To(BeTrue())
+
+			By("Reconciling the dependent after the referenced result is computed")
+			base, err := reconcileCalculate("base")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(base.Status.Result).To(Equal("3"))
+			chained, err = reconcileCalculate("chained")
 			Expect(err).NotTo(HaveOccurred())
-			// TODO(user): Add more specific assertions depending on your controller's reconciliation logic.
-			// Example: If you expect a certain status condition after reconciliation, verify it here.
+			Expect(chained.Status.Result).To(Equal("-7"))
+			Expect(meta.IsStatusConditionTrue(chained.Status.Conditions, mathv2.ConditionTypeReady)).To(BeTrue())
+		})
+
+		It("should report a cyclic reference", func() {
+			Expect(k8sClient.Create(ctx, newCalculate("left", mathv2.CalculateSpec{
+				Action:    mathv2.ActionTypeAdd,
+				FirstFrom: &mathv2.CalculateReference{Name: "right"},
+				Operands:  []string{"1"},
+			}))).To(Succeed())
+			Expect(k8sClient.Create(ctx, newCalculate("right", mathv2.CalculateSpec{
+				Action:    mathv2.ActionTypeAdd,
+				FirstFrom: &mathv2.CalculateReference{Name: "left"},
+				Operands:  []string{"1"},
+			}))).To(Succeed())
+
+			left, err := reconcileCalculate("left")
+			Expect(err).To(MatchError(reconcile.TerminalError(nil)))
+			Expect(err.Error()).To(ContainSubstring("cyclic reference: left -> right -> left"))
+			failed := meta.FindStatusCondition(left.Status.Conditions, mathv2.ConditionTypeFailed)
+			Expect(failed).NotTo(BeNil())
+			Expect(failed.Status).To(Equal(metav1.ConditionTrue))
+			Expect(failed.Reason).To(Equal(mathv2.ReasonCyclicReference))
 		})
 	})
 })